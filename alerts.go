@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// alertRule is one Prometheus alerting rule.
+type alertRule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// promDuration formats d the way Prometheus rule files expect, e.g. 720h
+// rather than Go's 720h0m0s.
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// stalenessRules alerts on controllers that stayed below the baseline for
+// longer than the update SLA, and on the checks feeding those alerts.
+func stalenessRules(sla, staleAfter time.Duration, severity string) []alertRule {
+	return []alertRule{
+		{
+			Alert:  "JenkinsPluginBelowBaseline",
+			Expr:   "jenkins_wrapper_baseline_violation == 1",
+			For:    promDuration(sla),
+			Labels: map[string]string{"severity": severity},
+			Annotations: map[string]string{
+				"summary":     "{{ $labels.plugin }} on {{ $labels.controller }} is below the baseline",
+				"description": fmt.Sprintf("{{ $labels.plugin }} on {{ $labels.controller }} has been missing or below the baseline {{ $labels.minimum }} for more than the %s update SLA. Run jenkins-wrapper baseline enforce.", promDuration(sla)),
+			},
+		},
+		{
+			Alert:  "JenkinsBaselineCheckFailing",
+			Expr:   "jenkins_wrapper_baseline_check_success == 0",
+			For:    promDuration(staleAfter),
+			Labels: map[string]string{"severity": severity},
+			Annotations: map[string]string{
+				"summary":     "The baseline check of {{ $labels.controller }} fails",
+				"description": "jenkins-wrapper baseline alerts could not list the plugins of {{ $labels.controller }}, so its staleness is unknown.",
+			},
+		},
+		{
+			Alert:  "JenkinsBaselineDataStale",
+			Expr:   fmt.Sprintf("time() - jenkins_wrapper_baseline_check_timestamp_seconds > %d", int64(staleAfter.Seconds())),
+			For:    "0m",
+			Labels: map[string]string{"severity": severity},
+			Annotations: map[string]string{
+				"summary":     "No baseline check of {{ $labels.controller }} for " + promDuration(staleAfter),
+				"description": "The job running jenkins-wrapper baseline alerts stopped, so staleness alerts are not reliable.",
+			},
+		},
+	}
+}
+
+// writeRules writes a Prometheus rule file. JSON is valid YAML, so both
+// formats load into Prometheus; json also suits monitoring stacks that
+// take rules through an API.
+func writeRules(path, format string, rules []alertRule) error {
+	type group struct {
+		Name  string      `json:"name"`
+		Rules []alertRule `json:"rules"`
+	}
+	file := struct {
+		Groups []group `json:"groups"`
+	}{[]group{{"jenkins-wrapper-plugin-staleness", rules}}}
+
+	var data []byte
+	switch format {
+	case "json":
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	case "yaml":
+		var b strings.Builder
+		b.WriteString("# Generated by jenkins-wrapper baseline alerts\ngroups:\n")
+		for _, g := range file.Groups {
+			fmt.Fprintf(&b, "  - name: %s\n    rules:\n", g.Name)
+			for _, r := range g.Rules {
+				fmt.Fprintf(&b, "      - alert: %s\n        expr: %s\n        for: %s\n", r.Alert, yamlQuote(r.Expr), r.For)
+				for _, section := range []struct {
+					name   string
+					values map[string]string
+				}{{"labels", r.Labels}, {"annotations", r.Annotations}} {
+					fmt.Fprintf(&b, "        %s:\n", section.name)
+					for _, k := range sortedKeys(section.values) {
+						fmt.Fprintf(&b, "          %s: %s\n", k, yamlQuote(section.values[k]))
+					}
+				}
+			}
+		}
+		data = []byte(b.String())
+	default:
+		return fmt.Errorf("unknown -format %q, use yaml or json", format)
+	}
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return writeFileAtomic(path, data, 0o644)
+}
+
+// yamlQuote quotes s as a YAML double-quoted scalar, which has the escapes
+// of a JSON string.
+func yamlQuote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// baselineMetrics renders the baseline state of the fleet for the
+// node_exporter textfile collector.
+func baselineMetrics(results map[string][]baselineViolation, failures map[string]string, checked time.Time) string {
+	var b strings.Builder
+	b.WriteString("# HELP jenkins_wrapper_baseline_violation 1 for each plugin that is missing or older than the baseline.\n")
+	b.WriteString("# TYPE jenkins_wrapper_baseline_violation gauge\n")
+	for _, url := range sortedKeys(results) {
+		for _, v := range results[url] {
+			// Not labelled with the installed version, so an update that is
+			// still too old does not restart the SLA clock
+			fmt.Fprintf(&b, "jenkins_wrapper_baseline_violation{controller=%q,plugin=%q,minimum=%q} 1\n", url, v.plugin, v.minimum)
+		}
+	}
+	b.WriteString("# HELP jenkins_wrapper_baseline_violations Plugins of the controller below the baseline.\n")
+	b.WriteString("# TYPE jenkins_wrapper_baseline_violations gauge\n")
+	for _, url := range sortedKeys(results) {
+		fmt.Fprintf(&b, "jenkins_wrapper_baseline_violations{controller=%q} %d\n", url, len(results[url]))
+	}
+
+	controllers := sortedKeys(results)
+	controllers = append(controllers, sortedKeys(failures)...)
+	b.WriteString("# HELP jenkins_wrapper_baseline_check_success 1 if the plugins of the controller could be checked.\n")
+	b.WriteString("# TYPE jenkins_wrapper_baseline_check_success gauge\n")
+	for _, url := range controllers {
+		_, failed := failures[url]
+		fmt.Fprintf(&b, "jenkins_wrapper_baseline_check_success{controller=%q} %g\n", url, boolGauge(!failed))
+	}
+	b.WriteString("# HELP jenkins_wrapper_baseline_check_timestamp_seconds When the controller was last checked.\n")
+	b.WriteString("# TYPE jenkins_wrapper_baseline_check_timestamp_seconds gauge\n")
+	for _, url := range controllers {
+		fmt.Fprintf(&b, "jenkins_wrapper_baseline_check_timestamp_seconds{controller=%q} %d\n", url, checked.Unix())
+	}
+	return b.String()
+}
+
+// baselineAlerts checks the fleet against the baseline and exports the
+// result as metrics, together with the alerting rules that page when a
+// controller stays below the baseline for longer than the update SLA.
+// Prometheus' "for" does the SLA bookkeeping, so no state is kept here:
+// run it from cron and point the textfile collector at -metrics.
+func baselineAlerts(args []string) error {
+	fs := flag.NewFlagSet("baseline alerts", flag.ContinueOnError)
+	controllers := fs.String("controllers", "", "Comma-separated controller URLs (default: -jenkinsURL)")
+	sla := fs.Duration("sla", 30*24*time.Hour, "How long a controller may stay below the baseline before alerting")
+	staleAfter := fs.Duration("stale-after", 24*time.Hour, "Alert when the controllers were not checked for this long")
+	severity := fs.String("severity", "warning", "Severity label of the alerts")
+	metricsPath := fs.String("metrics", "", "Write the fleet metrics here, e.g. /var/lib/node_exporter/textfile/jenkins_baseline.prom")
+	rulesPath := fs.String("rules", "-", "Write the alerting rules here, - for stdout")
+	format := fs.String("format", "yaml", "Format of the rules: yaml or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sla <= 0 || *staleAfter <= 0 {
+		return usageError{fmt.Errorf("-sla and -stale-after must be positive")}
+	}
+	if *rulesPath == "" || *rulesPath == "-" {
+		console = os.Stderr // The rules go to stdout
+	}
+	if err := writeRules(*rulesPath, *format, stalenessRules(*sla, *staleAfter, *severity)); err != nil {
+		return err
+	}
+	if *metricsPath == "" {
+		return nil
+	}
+
+	minimums, err := readBaseline(baselineFile)
+	if err != nil {
+		return err
+	}
+	urls := strings.Split(*controllers, ",")
+	if *controllers == "" {
+		if err := ensureJenkinsURL(); err != nil {
+			return err
+		}
+		urls = []string{jenkinsURL}
+	}
+	results := map[string][]baselineViolation{}
+	failures := map[string]string{}
+	for _, url := range urls {
+		jenkinsURL = strings.TrimRight(strings.TrimSpace(url), "/")
+		violations, err := checkBaseline(minimums)
+		if err != nil {
+			notify("⚠️", "%s: %v", jenkinsURL, err)
+			failures[jenkinsURL] = err.Error()
+			continue
+		}
+		results[jenkinsURL] = violations
+	}
+	if err := writeFileAtomic(*metricsPath, []byte(baselineMetrics(results, failures, time.Now())), 0o644); err != nil {
+		return err
+	}
+	notify("📈", "Wrote baseline metrics of %d controllers to %s (%d unreachable)", len(urls), *metricsPath, len(failures))
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// artifactCache is the content-addressed cache of downloaded plugins and
+// WARs, e.g. a directory shared by the machines of a fleet or the runs of a
+// test matrix.
+var artifactCache string
+
+// artifactRoot returns the directory of the artifact cache.
+func artifactRoot() (string, error) {
+	if artifactCache == "" {
+		return cacheDir("artifacts")
+	}
+	return artifactCache, os.MkdirAll(artifactCache, 0o755)
+}
+
+// artifactDir returns the cache directory of a release of an artifact.
+// Releases are stored by kind, name, version and SHA-256, e.g.
+// plugins/NAME/VERSION/SHA256/NAME.hpi, so a file keeps its usual name and
+// two downloads of the same release can only ever be the same file.
+func artifactDir(kind, name, version string) (string, error) {
+	root, err := artifactRoot()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, kind, name, version)
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// cachedArtifact returns a cached file of a release: the one with the given
+// SHA-256, or any when want is empty. Its modification time is the last use,
+// which cache gc goes by.
+func cachedArtifact(dir, file, want string) (string, bool) {
+	pattern := filepath.Join(dir, "*", file)
+	if want != "" {
+		pattern = filepath.Join(dir, strings.ToLower(want), file)
+	}
+	cached, _ := filepath.Glob(pattern)
+	if len(cached) == 0 {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(cached[0], now, now)
+	return cached[0], true
+}
+
+// storeArtifact downloads a file into the cache directory of a release,
+// keeping it only when its SHA-256 is the expected one.
+func storeArtifact(dir, file, want string, download func(path string) error) (string, error) {
+	tmp, err := os.CreateTemp(dir, "download-*.unverified") // Unique even when machines share the cache
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := download(tmp.Name()); err != nil {
+		return "", err
+	}
+	got, err := fileSha256(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	want = strings.ToLower(want)
+	if got != want {
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", file, want, got)
+	}
+	path := filepath.Join(dir, want, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// CreateTemp makes it private, but the cache is shared like its directories
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// cachedPlugin returns a plugin release from the artifact cache, downloading
+// it from -plugin-mirrors on first use. want is its SHA-256 when the
+// caller knows it; otherwise any cached copy is taken, or the checksum the
+// download mirrors publish is looked up, falling back to the update center's
+// for its latest release. Only verified files enter the cache.
+func cachedPlugin(name, version, want string) (string, error) {
+	if name == "" || version == "" || strings.Contains(name+version, "..") || strings.ContainsAny(name+version, `/\`) {
+		return "", fmt.Errorf("invalid plugin release %s:%s", name, version)
+	}
+	dir, err := artifactDir("plugins", name, version)
+	if err != nil {
+		return "", err
+	}
+	file := name + ".hpi"
+	if path, ok := cachedArtifact(dir, file, want); ok {
+		return path, nil
+	}
+	if want == "" {
+		if want, err = pluginChecksum(name, version); err != nil {
+			uc, ucErr := fetchUpdateCenter()
+			if ucErr != nil {
+				return "", err
+			}
+			sum, ok := uc.checksum(name, version)
+			if !ok {
+				return "", err
+			}
+			want = sum
+		}
+		if path, ok := cachedArtifact(dir, file, want); ok {
+			return path, nil
+		}
+	}
+
+	notify("⬇️", "Downloading %s %s...", name, version)
+	return storeArtifact(dir, file, want, func(path string) error {
+		err := errors.New("no -plugin-mirrors to download from")
+		var failed []error
+		for _, u := range pluginDownloadURLs(name, version) {
+			if err = downloadFile(u, path); err == nil {
+				return nil
+			}
+			failed = append(failed, err)
+		}
+		if len(failed) == 0 {
+			return err
+		}
+		return errors.Join(failed...)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backupGenerations is how many previous versions writeFileAtomic keeps, as
+// path.bak (newest), path.bak.1 and so on.
+const backupGenerations = 3
+
+// writeFileAtomic replaces path with data so that readers, and a crash at any
+// point, see either the old or the new content but never a truncated file.
+// The previous content is kept as a rotating .bak and an existing file's
+// permissions are preserved.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+		if err := rotateBackups(path); err != nil {
+			return fmt.Errorf("failed to back up %s: %v", path, err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rotateBackups shifts path.bak.N up by one and copies the current file to
+// path.bak. Copying rather than renaming keeps path in place until the new
+// content is renamed over it.
+func rotateBackups(path string) error {
+	backup := func(n int) string {
+		if n == 0 {
+			return path + ".bak"
+		}
+		return fmt.Sprintf("%s.bak.%d", path, n)
+	}
+	for n := backupGenerations - 2; n >= 0; n-- {
+		if err := os.Rename(backup(n), backup(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backup(0), data, 0o600)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readBaseline parses the baseline file: one "name:minimum-version" per
+// line, like plugins.txt, with # comments.
+func readBaseline(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	minimums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		name, version, ok := strings.Cut(text, ":")
+		if !ok || name == "" || version == "" {
+			return nil, fmt.Errorf("%s:%d: expected name:version, got %q", path, line, text)
+		}
+		minimums[strings.TrimSpace(name)] = strings.TrimSpace(version)
+	}
+	return minimums, scanner.Err()
+}
+
+// baselineViolation is a plugin that is missing or older than the baseline.
+type baselineViolation struct {
+	plugin, installed, minimum string
+}
+
+// checkBaseline compares the plugins of the current controller with the
+// baseline minimums.
+func checkBaseline(minimums map[string]string) ([]baselineViolation, error) {
+	plugins, err := listPlugins()
+	if err != nil {
+		return nil, err
+	}
+	installed := map[string]string{}
+	for _, p := range plugins {
+		if !p.Deleted {
+			installed[p.ShortName] = p.Version
+		}
+	}
+
+	var violations []baselineViolation
+	for _, name := range sortedKeys(minimums) {
+		version, ok := installed[name]
+		if !ok {
+			violations = append(violations, baselineViolation{name, "missing", minimums[name]})
+		} else if compareVersions(version, minimums[name]) < 0 {
+			violations = append(violations, baselineViolation{name, version, minimums[name]})
+		}
+	}
+	return violations, nil
+}
+
+// installFromUpdateCenter asks the controller to install the latest update
+// center release of each plugin, which takes effect after a restart.
+func installFromUpdateCenter(violations []baselineViolation) error {
+	var xml strings.Builder
+	xml.WriteString("<jenkins>")
+	for _, v := range violations {
+		fmt.Fprintf(&xml, `<install plugin="%s@%s"/>`, v.plugin, v.minimum)
+	}
+	xml.WriteString("</jenkins>")
+
+	req, err := newJenkinsRequest("POST", "/pluginManager/installNecessaryPlugins", strings.NewReader(xml.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return newHTTPStatusError("failed to install baseline plugins", resp)
+	}
+	return nil
+}
+
+// baselineCommand checks or enforces the org baseline on one or more
+// controllers, which share the configured credentials.
+func baselineCommand(args []string) error {
+	if len(args) > 0 && args[0] == "alerts" {
+		return baselineAlerts(args[1:])
+	}
+	if len(args) == 0 || (args[0] != "check" && args[0] != "enforce") {
+		return fmt.Errorf("usage: baseline check|enforce|alerts [-controllers url,...] [-restart]")
+	}
+	enforce := args[0] == "enforce"
+	fs := flag.NewFlagSet("baseline "+args[0], flag.ContinueOnError)
+	controllers := fs.String("controllers", "", "Comma-separated controller URLs (default: -jenkinsURL)")
+	restart := fs.Bool("restart", false, "Safe-restart controllers after enforcing, so upgrades take effect")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	minimums, err := readBaseline(baselineFile)
+	if err != nil {
+		return err
+	}
+	urls := strings.Split(*controllers, ",")
+	if *controllers == "" {
+		if err := ensureJenkinsURL(); err != nil {
+			return err
+		}
+		urls = []string{jenkinsURL}
+	}
+
+	failed := map[string]string{}
+	for _, url := range urls {
+		jenkinsURL = strings.TrimRight(strings.TrimSpace(url), "/")
+		violations, err := checkBaseline(minimums)
+		if err != nil {
+			failed[jenkinsURL] = err.Error()
+			continue
+		}
+		if len(violations) == 0 {
+			notify("✅", "%s meets the baseline", jenkinsURL)
+			continue
+		}
+		for _, v := range violations {
+			notify("⚠️", "%s: %s is %s, baseline requires %s", jenkinsURL, v.plugin, v.installed, v.minimum)
+		}
+		if !enforce {
+			failed[jenkinsURL] = fmt.Sprintf("%d plugins below baseline", len(violations))
+			continue
+		}
+		if err := installFromUpdateCenter(violations); err != nil {
+			failed[jenkinsURL] = err.Error()
+			continue
+		}
+		if *restart {
+			if err := safeRestart(); err != nil {
+				failed[jenkinsURL] = err.Error()
+				continue
+			}
+			notify("🔁", "%s: upgraded %d plugins, restarting when idle", jenkinsURL, len(violations))
+		} else {
+			notify("⬆️", "%s: upgraded %d plugins, restart to activate them", jenkinsURL, len(violations))
+		}
+	}
+
+	if len(failed) > 0 {
+		var lines []string
+		for _, url := range sortedKeys(failed) {
+			lines = append(lines, url+": "+failed[url])
+		}
+		return fmt.Errorf("baseline %s failed on %d of %d controllers:\n%s", args[0], len(failed), len(urls), strings.Join(lines, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+var (
+	benchEnabled   = flag.Bool("bench", false, "Measure API latency before and after the update and report regressions")
+	benchSamples   = flag.Int("bench-samples", 5, "Requests per endpoint when measuring latency")
+	benchThreshold = flag.Float64("bench-threshold", 1.5, "Flag endpoints that got this many times slower")
+)
+
+// benchEndpoints is the standard set of API calls measured by bench, covering
+// the views that plugins most often slow down.
+var benchEndpoints = []string{
+	"/api/json",
+	"/pluginManager/api/json?depth=1",
+	"/computer/api/json",
+	"/queue/api/json",
+	"/whoAmI/api/json",
+	"/login",
+}
+
+// benchResult compares the median latency of an endpoint before and after.
+type benchResult struct {
+	Endpoint   string  `json:"endpoint"`
+	BeforeMs   float64 `json:"beforeMs"`
+	AfterMs    float64 `json:"afterMs"`
+	Ratio      float64 `json:"ratio"`
+	Regression bool    `json:"regression"`
+}
+
+var benchBefore map[string]time.Duration
+
+// measureLatency returns the median latency of every benchmark endpoint.
+func measureLatency(samples int) (map[string]time.Duration, error) {
+	medians := map[string]time.Duration{}
+	for _, endpoint := range benchEndpoints {
+		var durations []time.Duration
+		for i := 0; i < samples; i++ {
+			req, err := newJenkinsRequest("GET", endpoint, nil)
+			if err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			io.Copy(io.Discard, limitBody(resp))
+			resp.Body.Close()
+			durations = append(durations, time.Since(start))
+		}
+		slices.Sort(durations)
+		medians[endpoint] = durations[len(durations)/2]
+	}
+	return medians, nil
+}
+
+func benchBaseline() {
+	var err error
+	if benchBefore, err = measureLatency(*benchSamples); err != nil {
+		notify("⚠️", "Could not measure API latency: %v", err)
+	}
+}
+
+// benchCompare measures again after the update and records any endpoint that
+// got significantly slower in the run report.
+func benchCompare() error {
+	if benchBefore == nil {
+		return nil
+	}
+	after, err := measureLatency(*benchSamples)
+	if err != nil {
+		notify("⚠️", "Could not measure API latency: %v", err)
+		return nil
+	}
+	for _, endpoint := range benchEndpoints {
+		before := benchBefore[endpoint]
+		r := benchResult{
+			Endpoint: endpoint,
+			BeforeMs: float64(before.Microseconds()) / 1000,
+			AfterMs:  float64(after[endpoint].Microseconds()) / 1000,
+		}
+		if before > 0 {
+			r.Ratio = float64(after[endpoint]) / float64(before)
+		}
+		r.Regression = r.Ratio >= *benchThreshold
+		report.Benchmark = append(report.Benchmark, r)
+		if r.Regression {
+			notify("⚠️", "%s got %.1fx slower (%.0fms -> %.0fms)", endpoint, r.Ratio, r.BeforeMs, r.AfterMs)
+		}
+	}
+	return nil
+}
+
+// benchCommand prints the current latency of the benchmark endpoints.
+func benchCommand(args []string) error {
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+	medians, err := measureLatency(*benchSamples)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range benchEndpoints {
+		fmt.Printf("%-36s %8.1f ms\n", endpoint, float64(medians[endpoint].Microseconds())/1000)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+var (
+	buildWith = flag.String("build-with", "", "Build the plugin from source with maven or gradle before deploying it")
+	sourceDir = flag.String("source-dir", ".", "Plugin source directory for -build-with")
+)
+
+// pluginBuilds describes how each -build-with tool is run and where it leaves
+// the plugin archive.
+var pluginBuilds = map[string]struct {
+	tool, wrapper string
+	args          []string
+	outputDir     string
+}{
+	"maven":  {"mvn", "mvnw", []string{"-B", "package"}, "target"},
+	"gradle": {"gradle", "gradlew", []string{"assemble"}, filepath.Join("build", "libs")},
+}
+
+// buildPlugin runs the plugin build in -source-dir, preferring the project's
+// own wrapper script, and returns the newest .hpi it produced.
+func buildPlugin() (string, error) {
+	build, ok := pluginBuilds[*buildWith]
+	if !ok {
+		return "", fmt.Errorf("unsupported -build-with %q, expected maven or gradle", *buildWith)
+	}
+
+	tool := build.tool
+	wrapper := build.wrapper
+	if runtime.GOOS == "windows" {
+		wrapper += ".cmd"
+	}
+	if path := filepath.Join(*sourceDir, wrapper); fileExists(path) {
+		// Absolute, so exec runs the project's wrapper rather than looking it up on PATH
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		tool = abs
+	}
+
+	if err := checkLaunch(tool); err != nil {
+		return "", err
+	}
+	notify("🔨", "Building plugin in %s with %s...", *sourceDir, tool)
+	cmd := exec.Command(tool, build.args...)
+	cmd.Dir = *sourceDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("plugin build failed: %v\nOutput: %s", err, output)
+	}
+
+	archives, err := filepath.Glob(filepath.Join(*sourceDir, build.outputDir, "*.hpi"))
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestTime int64
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return "", err
+		}
+		if t := info.ModTime().UnixNano(); newest == "" || t > newestTime {
+			newest, newestTime = archive, t
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("plugin build produced no .hpi in %s", filepath.Join(*sourceDir, build.outputDir))
+	}
+	notify("✅", "Built %s", newest)
+	return newest, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	runtimedebug "runtime/debug"
+	"strings"
+)
+
+// Build metadata, stamped by the release build:
+//
+//	go build -ldflags "-X main.buildVersion=1.4.0 -X main.buildCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to what the Go toolchain recorded. The
+// release build also stamps the oldest and newest core of the matrix it
+// tested against (-X main.minSupportedCore=<oldest core> -X
+// main.maxTestedCore=<newest LTS line>); builds without them claim no range.
+var (
+	buildVersion     string
+	buildCommit      string
+	buildDate        string
+	minSupportedCore string
+	maxTestedCore    string
+)
+
+var showVersion = flag.Bool("version", false, "Print the version of the wrapper and exit, like the version command")
+
+// buildInfo identifies the wrapper build in run reports, so a report can be
+// tied to the binary that wrote it once several versions circulate.
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Built   string `json:"built,omitempty"`
+	Go      string `json:"go"`
+}
+
+func currentBuild() buildInfo {
+	return buildInfo{wrapperVersion(), wrapperCommit(), wrapperBuildDate(), runtime.Version()}
+}
+
+// supportedCoreRange describes the core versions the release was tested
+// against, "unknown" when the build was not stamped with them.
+func supportedCoreRange() string {
+	if minSupportedCore == "" || maxTestedCore == "" {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s to %s.x", minSupportedCore, maxTestedCore)
+}
+
+// coreSupport tells how a core version relates to the tested range, ""
+// when it is inside or no range is known.
+func coreSupport(core string) string {
+	switch {
+	case minSupportedCore == "" || maxTestedCore == "":
+		return ""
+	case compareVersions(core, minSupportedCore) < 0:
+		return "older than tested"
+	case compareVersions(core, maxTestedCore+".999") > 0:
+		return "newer than tested"
+	}
+	return ""
+}
+
+// buildSetting returns a setting the toolchain embedded, e.g. vcs.revision.
+func buildSetting(key string) string {
+	if info, ok := runtimedebug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == key {
+				return s.Value
+			}
+		}
+	}
+	return ""
+}
+
+// wrapperVersion is the version the binary was built as: the stamped one,
+// else the module version, else "(devel)" for a build from a working tree.
+func wrapperVersion() string {
+	if buildVersion != "" {
+		return buildVersion
+	}
+	if info, ok := runtimedebug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+func wrapperCommit() string {
+	if buildCommit != "" {
+		return buildCommit
+	}
+	commit := buildSetting("vcs.revision")
+	if commit != "" && buildSetting("vcs.modified") == "true" {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+func wrapperBuildDate() string {
+	if buildDate != "" {
+		return buildDate
+	}
+	return buildSetting("vcs.time") // Commit time, the closest there is
+}
+
+// versionCommand prints how the wrapper was built, and the core version of
+// the controller when one is configured, as that is usually asked next.
+func versionCommand(args []string) error {
+	if len(args) > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))}
+	}
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	lines := []string{
+		"jenkins-wrapper " + wrapperVersion(),
+		"commit:  " + unknown(wrapperCommit()),
+		"built:   " + unknown(wrapperBuildDate()),
+		fmt.Sprintf("go:      %s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH),
+		"lts:     " + supportedCoreRange(),
+	}
+	if jenkinsURL != "" {
+		core := controllerVersion()
+		switch {
+		case core == "":
+			core = "unreachable"
+		case coreSupport(core) != "":
+			core += " (" + coreSupport(core) + ")"
+		}
+		lines = append(lines, fmt.Sprintf("jenkins: %s at %s", core, jenkinsURL))
+	}
+	printOutput(strings.Join(lines, "\n"))
+	return nil
+}
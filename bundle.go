@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// supportBundleLogLines is how much of the Jenkins console log goes into a
+// support bundle.
+const supportBundleLogLines = 200
+
+type bundleFile struct {
+	name    string
+	content []byte
+}
+
+// writeSupportBundle collects everything needed to investigate a failed run
+// into a single zip file in the current directory and returns its name.
+func writeSupportBundle(runErr error) (string, error) {
+	// Named after the run too, so concurrent runs failing in the same
+	// second do not overwrite each other's bundle
+	name := fmt.Sprintf("jenkins-wrapper-support-%s-%s.zip", time.Now().Format("20060102-150405"), runCorrelationID())
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Take the plugin snapshot first so its request shows up in the trace
+	plugins := pluginListSnapshot()
+
+	report.Error = runErr.Error()
+	report.Category = categorize(runErr)
+	reportJSON, _ := json.MarshalIndent(report, "", "  ")
+	tracesJSON, _ := json.MarshalIndent(traces.snapshot(), "", "  ")
+	logTail, err := tailFile(jenkinsLogPath, supportBundleLogLines)
+	if err != nil {
+		logTail = fmt.Sprintf("could not read %s: %v", jenkinsLogPath, err)
+	}
+
+	zw := zip.NewWriter(f)
+	files := []bundleFile{
+		{"config.txt", []byte(redactedConfig())},
+		{"report.json", reportJSON},
+		{"http-trace.json", tracesJSON},
+		{"jenkins-log-tail.txt", []byte(logTail)},
+		{"plugins.json", plugins},
+	}
+	if accessLogPath != "" {
+		files = append(files, bundleFile{"access-log.txt", correlatedAccessLog()})
+	}
+	// A controller that did not come back is usually stuck, not dead
+	if errors.Is(runErr, errRestartTimeout) {
+		threads, histogram := jvmDumps()
+		files = append(files, bundleFile{"thread-dump.txt", threads}, bundleFile{"heap-histogram.txt", histogram})
+	}
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(file.content); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// redactedConfig renders the wrapper settings with secrets masked.
+func redactedConfig() string {
+	var sb strings.Builder
+	for _, s := range settings {
+		value := *s.value
+		if s.secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", s.flag, value)
+	}
+	return sb.String()
+}
+
+// pluginListSnapshot returns the raw plugin manager listing, or a note on why
+// it could not be fetched (Jenkins is often down when a run fails).
+func pluginListSnapshot() []byte {
+	req, err := newJenkinsRequest("GET", "/pluginManager/api/json?depth=1", nil)
+	if err != nil {
+		return []byte(err.Error())
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return []byte(fmt.Sprintf("could not fetch plugin list: %v", err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(limitBody(resp))
+	if err != nil {
+		return []byte(fmt.Sprintf("could not read plugin list: %v", err))
+	}
+	return body
+}
+
+// correlatedAccessLog returns the access log entries of this run, found by
+// its correlation ID, or a note on why there are none. The log is scanned
+// rather than read whole, as a busy controller's runs into gigabytes.
+func correlatedAccessLog() []byte {
+	f, err := target.openFile(accessLogPath)
+	if err != nil {
+		return []byte(fmt.Sprintf("could not read %s: %v", accessLogPath, err))
+	}
+	defer f.Close()
+	id := runCorrelationID()
+	var sb strings.Builder
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20) // Long query strings make long lines
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.Contains(line, id) {
+			sb.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(&sb, "stopped reading %s: %v\n", accessLogPath, err)
+	}
+	if sb.Len() == 0 {
+		return []byte(fmt.Sprintf("no entries with correlation ID %s in %s; the log has to record the User-Agent or the %s header", id, accessLogPath, *correlationHeader))
+	}
+	return []byte(sb.String())
+}
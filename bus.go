@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	busURL    = flag.String("bus-url", "", "Publish step events and run results to a message bus: nats://host:4222/subject or kafka://broker:9092[,broker...]/topic")
+	busFormat = flag.String("bus-format", "json", "Serialization of -bus-url messages: json (the -output json records) or cloudevents")
+)
+
+// eventPublisher delivers serialized events to one destination.
+type eventPublisher interface {
+	send(payload []byte) error
+	close() error
+}
+
+// publishingSink serializes step events and run results and hands them to
+// a publisher in the background, so a slow receiver never holds up the
+// pipeline. Status lines are not sent.
+type publishingSink struct {
+	pub    eventPublisher
+	format string // json or cloudevents
+	queue  chan []byte
+	done   chan struct{}
+}
+
+func newPublishingSink(pub eventPublisher, format string) *publishingSink {
+	s := &publishingSink{pub: pub, format: format, queue: make(chan []byte, 100), done: make(chan struct{})}
+	go s.deliver()
+	return s
+}
+
+// newBusSink connects the publisher for -bus-url.
+func newBusSink(rawURL, format string) (*publishingSink, error) {
+	if format != "json" && format != "cloudevents" {
+		return nil, fmt.Errorf("unknown -bus-format %q, use json or cloudevents", format)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	subject := strings.TrimPrefix(u.Path, "/")
+	if subject == "" {
+		return nil, fmt.Errorf("%s: missing subject or topic", u.Redacted())
+	}
+	var pub eventPublisher
+	switch u.Scheme {
+	case "nats":
+		pub = &natsPublisher{addr: u.Host, user: u.User, subject: subject}
+	case "kafka":
+		pub = &kafkaPublisher{brokers: strings.Split(u.Host, ","), topic: subject}
+	default:
+		return nil, fmt.Errorf("unsupported bus %q, use nats or kafka", u.Scheme)
+	}
+	return newPublishingSink(pub, format), nil
+}
+
+func (s *publishingSink) write(event) {}
+
+func (s *publishingSink) step(r stepResult) {
+	if s.format == "cloudevents" {
+		s.enqueue(newCloudEvent(cloudEventTypes[r.Status], r.Name, r))
+	} else {
+		s.enqueue(jsonRecord{Type: "step", stepResult: &r})
+	}
+}
+
+func (s *publishingSink) run(r *runReport) {
+	if s.format == "cloudevents" {
+		s.enqueue(newCloudEvent(runFinishedType, "", r))
+	} else {
+		s.enqueue(struct {
+			Type string `json:"type"`
+			*runReport
+		}{"run", r})
+	}
+}
+
+func (s *publishingSink) enqueue(v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case s.queue <- payload:
+	default:
+		// The receiver is too far behind; dropping beats blocking the run
+	}
+}
+
+func (s *publishingSink) deliver() {
+	defer close(s.done)
+	for payload := range s.queue {
+		if err := s.pub.send(payload); err != nil {
+			// Reported on stderr: notify would end up back in this sink's lock
+			fmt.Fprintf(os.Stderr, "event delivery failed: %v\n", err)
+		}
+	}
+}
+
+// close delivers what is still queued, giving up after a few seconds.
+func (s *publishingSink) close() error {
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+	return s.pub.close()
+}
+
+// natsPublisher speaks the NATS client protocol: CONNECT once, then one PUB
+// per event. The server's PINGs are answered so long-running daemons keep
+// their connection; a broken connection is redialed on the next event.
+type natsPublisher struct {
+	addr    string
+	user    *url.Userinfo
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (p *natsPublisher) send(payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", p.subject, len(payload), payload)
+	if _, err := p.conn.Write([]byte(msg)); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return fmt.Errorf("nats %s: %v", p.addr, err)
+	}
+	return nil
+}
+
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("nats %s: %v", p.addr, err)
+	}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	info, err := r.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats %s: no INFO from server", p.addr)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "jenkins-wrapper", "lang": "go"}
+	if p.user != nil {
+		if pass, ok := p.user.Password(); ok {
+			options["user"], options["pass"] = p.user.Username(), pass
+		} else {
+			options["auth_token"] = p.user.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", connect); err != nil {
+		conn.Close()
+		return fmt.Errorf("nats %s: %v", p.addr, err)
+	}
+	p.conn = conn
+	go p.answerPings(conn, r)
+	return nil
+}
+
+// answerPings reads what the server sends until the connection closes,
+// replying to its keepalive PINGs and reporting -ERR lines.
+func (p *natsPublisher) answerPings(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			conn.Write([]byte("PONG\r\n"))
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			fmt.Fprintf(os.Stderr, "nats %s: %s", p.addr, line)
+		}
+	}
+}
+
+func (p *natsPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	busyLookback    = 14 * 24 * time.Hour // How much build history defines "usual" activity
+	busyFactor      = 1.5                 // An hour is busy when it sees this many times the average
+	busyMinBuilds   = 10                  // Ignore hours with fewer builds than this over the lookback
+	busyMaxBuilds   = 1000                // Builds fetched per job
+	busyFolderDepth = 5                   // Levels of folders searched for jobs
+)
+
+var errBusyPeriod = errors.New("jenkins is in a historically busy period")
+
+// hourlyBuildCounts counts builds started in each hour of the day over the
+// lookback window, using the local time zone.
+func hourlyBuildCounts() ([24]int, error) {
+	var counts [24]int
+	err := forEachBuildSince(time.Now().Add(-busyLookback), func(started time.Time) {
+		counts[started.Hour()]++
+	})
+	return counts, err
+}
+
+// busyJob is a job or folder with the start times of its recent builds.
+type busyJob struct {
+	Jobs      []busyJob `json:"jobs"`
+	AllBuilds []struct {
+		Timestamp int64 `json:"timestamp"`
+	} `json:"allBuilds"`
+}
+
+// busyTree asks for the recent build start times of every job, down to
+// busyFolderDepth levels of folders. Folders have no builds and jobs have no
+// jobs, so each level simply asks for both.
+func busyTree(depth int) string {
+	fields := fmt.Sprintf("allBuilds[timestamp]{0,%d}", busyMaxBuilds)
+	if depth > 0 {
+		fields += "," + busyTree(depth-1)
+	}
+	return "jobs[" + fields + "]"
+}
+
+// forEachBuildSince calls fn with the start time of every build started
+// after since, of the jobs in folders too. The whole history is fetched in
+// one request; each job's newest busyMaxBuilds builds are enough to cover
+// the lookback of all but the busiest jobs.
+func forEachBuildSince(since time.Time, fn func(started time.Time)) error {
+	var root busyJob
+	if err := getJSON("/api/json?tree="+url.QueryEscape(busyTree(busyFolderDepth)), &root); err != nil {
+		return err
+	}
+	var walk func(jobs []busyJob)
+	walk = func(jobs []busyJob) {
+		for _, job := range jobs {
+			for _, build := range job.AllBuilds {
+				if started := time.UnixMilli(build.Timestamp); started.After(since) {
+					fn(started)
+				}
+			}
+			walk(job.Jobs)
+		}
+	}
+	walk(root.Jobs)
+	return nil
+}
+
+// checkBusyHours warns when the current hour usually sees far more builds
+// than average, and refuses to continue unless -ignore-busy is set.
+func checkBusyHours() error {
+	counts, err := hourlyBuildCounts()
+	if err != nil {
+		notify("⚠️", "Could not inspect build activity: %v", err)
+		return nil
+	}
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	average := float64(total) / 24
+	hour := time.Now().Hour()
+	current := counts[hour]
+	if current < busyMinBuilds || float64(current) < average*busyFactor {
+		return nil
+	}
+
+	notify("⚠️", "%02d:00-%02d:59 is usually busy: %d builds started in this hour over the last %d days (average %.0f per hour)",
+		hour, hour, current, int(busyLookback.Hours()/24), average)
+	if *ignoreBusy {
+		notify("⚠️", "Restarting anyway because -ignore-busy is set.")
+		return nil
+	}
+	return fmt.Errorf("%w, deferring restart (use -ignore-busy to override)", errBusyPeriod)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cacheEntry is a release in the artifact cache.
+type cacheEntry struct {
+	kind, name, version, sum string
+	path                     string
+	size                     int64
+	lastUsed                 time.Time
+}
+
+// listArtifacts returns the cached releases, least recently used first.
+func listArtifacts() ([]cacheEntry, error) {
+	root, err := artifactRoot()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(root, "*", "*", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		rel, _ := filepath.Rel(root, file)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		entries = append(entries, cacheEntry{
+			kind: parts[0], name: parts[1], version: parts[2], sum: parts[3],
+			path: file, size: info.Size(), lastUsed: info.ModTime(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].lastUsed.Before(entries[j].lastUsed) })
+	return entries, nil
+}
+
+// removeArtifact deletes a cached release with the directories it leaves
+// empty.
+func removeArtifact(e cacheEntry) error {
+	if err := os.Remove(e.path); err != nil {
+		return err
+	}
+	dir := filepath.Dir(e.path)
+	for i := 0; i < 3; i++ { // SHA-256, version and name
+		if os.Remove(dir) != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// cacheCommand manages the artifact cache: ls, verify and gc.
+func cacheCommand(args []string) error {
+	usage := usageError{errors.New("usage: cache ls | verify | gc [-max-age <duration>] [-max-size-mb <n>]")}
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "ls":
+		if len(args) > 1 {
+			return usage
+		}
+		return cacheList()
+	case "verify":
+		if len(args) > 1 {
+			return usage
+		}
+		return cacheVerify()
+	case "gc":
+		return cacheGC(args[1:])
+	}
+	return usage
+}
+
+func cacheList() error {
+	entries, err := listArtifacts()
+	if err != nil {
+		return err
+	}
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tVERSION\tSIZE\tLAST USED\tSHA-256")
+	for _, e := range entries {
+		total += e.size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1f MB\t%s\t%.12s\n", e.kind, e.name, e.version, float64(e.size)/(1<<20), e.lastUsed.Format("2006-01-02 15:04"), e.sum)
+	}
+	fmt.Fprintf(w, "\t\t\t%.1f MB\t\t%d files\n", float64(total)/(1<<20), len(entries))
+	return w.Flush()
+}
+
+// cacheVerify checks every cached file against the SHA-256 it is stored
+// under and removes the ones that do not match, e.g. after a disk error, so
+// they are downloaded again.
+func cacheVerify() error {
+	entries, err := listArtifacts()
+	if err != nil {
+		return err
+	}
+	corrupt := 0
+	for _, e := range entries {
+		got, err := fileSha256(e.path)
+		if err != nil {
+			return err
+		}
+		if got == e.sum {
+			continue
+		}
+		corrupt++
+		notify("❌", "%s %s %s is corrupt: stored as %.12s, content is %.12s", e.kind, e.name, e.version, e.sum, got)
+		if dryRunning("remove %s", e.path) {
+			continue
+		}
+		if err := removeArtifact(e); err != nil {
+			return err
+		}
+	}
+	if corrupt > 0 {
+		return fmt.Errorf("%d of %d cached files were corrupt", corrupt, len(entries))
+	}
+	notify("✅", "All %d cached files are intact", len(entries))
+	return nil
+}
+
+// cacheGC removes releases not used for -max-age, then the least recently
+// used ones until the cache fits -max-size-mb, and leftovers of interrupted
+// downloads.
+func cacheGC(args []string) error {
+	fs := flag.NewFlagSet("cache gc", flag.ContinueOnError)
+	maxAge := fs.Duration("max-age", 30*24*time.Hour, "Remove releases not used for this long, 0 to keep them regardless of age")
+	maxSize := fs.Int64("max-size-mb", 0, "Then remove the least recently used releases until the cache is at most this large, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))}
+	}
+
+	entries, err := listArtifacts()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	removed, freed := 0, int64(0)
+	for _, e := range entries {
+		old := *maxAge > 0 && time.Since(e.lastUsed) > *maxAge
+		large := *maxSize > 0 && total-freed > *maxSize<<20
+		if !old && !large {
+			continue
+		}
+		removed++
+		freed += e.size
+		if dryRunning("remove %s %s %s, last used %s", e.kind, e.name, e.version, e.lastUsed.Format("2006-01-02")) {
+			continue
+		}
+		if err := removeArtifact(e); err != nil {
+			return err
+		}
+		debug(1, "Removed %s", e.path)
+	}
+
+	// Downloads of the last hour may still be running, on another machine too
+	root, err := artifactRoot()
+	if err != nil {
+		return err
+	}
+	partial, _ := filepath.Glob(filepath.Join(root, "*", "*", "*", "download-*.unverified"))
+	for _, path := range partial {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > time.Hour && !dryRunning("remove %s", path) {
+			os.Remove(path)
+		}
+	}
+	if *dryRun {
+		return nil
+	}
+	notify("🧹", "Removed %d of %d cached files, freeing %.1f MB", removed, len(entries), float64(freed)/(1<<20))
+	return nil
+}
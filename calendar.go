@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	maintenanceCalendar string // iCal feed or file of approved maintenance windows
+	ignoreCalendar      = flag.Bool("ignore-calendar", false, "Only warn when running disruptive steps outside the maintenance windows of -maintenance-calendar")
+)
+
+var errOutsideWindow = errors.New("outside the approved maintenance windows")
+
+// maintenanceWindow is one occurrence of an approved window.
+type maintenanceWindow struct {
+	summary    string
+	start, end time.Time
+}
+
+// calendarEvent is a VEVENT with the parts that define when it happens.
+// One with a recurrenceID replaces that occurrence of the series with the
+// same uid.
+type calendarEvent struct {
+	uid, summary string
+	start, end   time.Time
+	rrule        map[string]string
+	exdates      []time.Time
+	recurrenceID time.Time
+	cancelled    bool
+}
+
+// unfoldICal joins the continuation lines of an iCal file (RFC 5545 3.1).
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalTime reads a DATE or DATE-TIME value: UTC with a Z, in the
+// TZID of its parameters, or floating in the local time zone.
+func parseICalTime(params, value string) (time.Time, error) {
+	loc := time.Local
+	for _, p := range strings.Split(params, ";") {
+		if tzid, ok := strings.CutPrefix(p, "TZID="); ok {
+			if l, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, loc)
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// parseICalDuration reads the DURATION values events use, e.g. PT4H or P1D.
+func parseICalDuration(value string) (time.Duration, error) {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(value, "+"), "P")
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	n := ""
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == 'T':
+		case c >= '0' && c <= '9':
+			n += string(c)
+		default:
+			v, err := strconv.Atoi(n)
+			if err != nil || units[c] == 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			d += time.Duration(v) * units[c]
+			n = ""
+		}
+	}
+	return d, nil
+}
+
+// parseCalendar reads the events of an iCal file.
+func parseCalendar(r io.Reader) ([]calendarEvent, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []calendarEvent
+	var e *calendarEvent
+	var duration time.Duration
+	for _, line := range lines {
+		nameParams, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(nameParams, ";")
+		switch {
+		case line == "BEGIN:VEVENT":
+			e, duration = &calendarEvent{}, 0
+		case e == nil:
+		case line == "END:VEVENT":
+			if e.end.IsZero() {
+				e.end = e.start.Add(duration)
+			}
+			if !e.start.IsZero() && e.end.After(e.start) {
+				events = append(events, *e)
+			}
+			e = nil
+		case name == "UID":
+			e.uid = value
+		case name == "SUMMARY":
+			e.summary = value
+		case name == "STATUS":
+			e.cancelled = value == "CANCELLED"
+		case name == "RECURRENCE-ID":
+			e.recurrenceID, err = parseICalTime(params, value)
+		case name == "DTSTART":
+			e.start, err = parseICalTime(params, value)
+		case name == "DTEND":
+			e.end, err = parseICalTime(params, value)
+		case name == "DURATION":
+			duration, err = parseICalDuration(value)
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, exErr := parseICalTime(params, v)
+				if exErr != nil {
+					return nil, exErr
+				}
+				e.exdates = append(e.exdates, t)
+			}
+		case name == "RRULE":
+			e.rrule = map[string]string{}
+			for _, part := range strings.Split(value, ";") {
+				k, v, _ := strings.Cut(part, "=")
+				e.rrule[k] = v
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", line, err)
+		}
+	}
+	return applyOverrides(events), nil
+}
+
+// applyOverrides applies the occurrences that were moved or cancelled: the
+// original occurrence leaves its series, and the override stands on its own
+// unless it is cancelled. Cancelled events are dropped.
+func applyOverrides(events []calendarEvent) []calendarEvent {
+	for _, o := range events {
+		if o.recurrenceID.IsZero() {
+			continue
+		}
+		for i := range events {
+			if events[i].uid == o.uid && events[i].recurrenceID.IsZero() {
+				events[i].exdates = append(events[i].exdates, o.recurrenceID)
+			}
+		}
+	}
+	var kept []calendarEvent
+	for _, e := range events {
+		if e.cancelled {
+			continue
+		}
+		if !e.recurrenceID.IsZero() {
+			e.rrule = nil // Just this occurrence
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+var icalWeekdays = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+
+// occurrenceAt returns the occurrence of the event that is open at t. Of
+// recurrence rules, DAILY and WEEKLY with INTERVAL, COUNT, UNTIL and (for
+// WEEKLY) BYDAY are understood, which covers maintenance windows; other
+// rules are reported rather than guessed at.
+func (e calendarEvent) occurrenceAt(t time.Time) (*maintenanceWindow, error) {
+	length := e.end.Sub(e.start)
+	open := func(start time.Time) *maintenanceWindow {
+		for _, ex := range e.exdates {
+			if ex.Equal(start) {
+				return nil
+			}
+		}
+		if !t.Before(start) && t.Before(start.Add(length)) {
+			return &maintenanceWindow{e.summary, start, start.Add(length)}
+		}
+		return nil
+	}
+	if e.rrule == nil {
+		return open(e.start), nil
+	}
+
+	freq := e.rrule["FREQ"]
+	if freq != "DAILY" && freq != "WEEKLY" {
+		return nil, fmt.Errorf("event %q repeats %s, only DAILY and WEEKLY are supported", e.summary, freq)
+	}
+	interval := 1
+	if v, ok := e.rrule["INTERVAL"]; ok {
+		interval, _ = strconv.Atoi(v)
+		interval = max(interval, 1)
+	}
+	count := -1
+	if v, ok := e.rrule["COUNT"]; ok {
+		count, _ = strconv.Atoi(v)
+	}
+	var until time.Time
+	if v, ok := e.rrule["UNTIL"]; ok {
+		until, _ = parseICalTime("", v)
+	}
+	days := map[time.Weekday]bool{e.start.Weekday(): true}
+	if v, ok := e.rrule["BYDAY"]; ok && freq == "WEEKLY" {
+		days = map[time.Weekday]bool{}
+		for _, d := range strings.Split(v, ",") {
+			days[icalWeekdays[d]] = true
+		}
+	}
+
+	// Walk the days of the series up to t; windows are short, so this
+	// stays cheap even for series that started years ago
+	n := 0
+	for day := 0; ; day++ {
+		start := e.start.AddDate(0, 0, day)
+		if start.After(t) || (!until.IsZero() && start.After(until)) || (count >= 0 && n >= count) {
+			return nil, nil
+		}
+		period := day
+		if freq == "WEEKLY" {
+			period = (day + (int(e.start.Weekday())+6)%7) / 7 // Weeks start on Monday
+		}
+		if period%interval != 0 || (freq == "WEEKLY" && !days[start.Weekday()]) {
+			continue
+		}
+		n++
+		if w := open(start); w != nil {
+			return w, nil
+		}
+	}
+}
+
+// loadCalendar reads the maintenance calendar from a URL or a file.
+func loadCalendar(source string) ([]calendarEvent, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseCalendar(f)
+	}
+	resp, err := httpClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newHTTPStatusError("failed to fetch the maintenance calendar", resp)
+	}
+	return parseCalendar(resp.Body)
+}
+
+// currentWindow returns the maintenance window open at t, if any.
+func currentWindow(events []calendarEvent, t time.Time) (*maintenanceWindow, error) {
+	for _, e := range events {
+		w, err := e.occurrenceAt(t)
+		if err != nil || w != nil {
+			return w, err
+		}
+	}
+	return nil, nil
+}
+
+// checkMaintenanceWindow refuses disruptive steps outside the windows of
+// the maintenance calendar unless -ignore-calendar is set. A calendar that
+// cannot be read refuses too: the change calendar must not be bypassed by a
+// network problem.
+func checkMaintenanceWindow() error {
+	events, err := loadCalendar(maintenanceCalendar)
+	if err != nil {
+		err = fmt.Errorf("cannot read the maintenance calendar %s: %w", maintenanceCalendar, err)
+	} else {
+		var w *maintenanceWindow
+		if w, err = currentWindow(events, time.Now()); err == nil && w != nil {
+			notify("🗓️", "In maintenance window %q until %s", w.summary, w.end.Local().Format("Mon 15:04"))
+			return nil
+		}
+		if err == nil {
+			err = errOutsideWindow
+		}
+	}
+	if *ignoreCalendar {
+		notify("⚠️", "%v, going ahead because -ignore-calendar is set", err)
+		return nil
+	}
+	return fmt.Errorf("refusing disruptive steps: %w (use -ignore-calendar to override)", err)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// capability is a feature of the controller, or of its surroundings, that
+// some steps depend on.
+type capability struct {
+	name  string // As shown to the operator
+	probe string // Answers 200 when the feature is usable: a controller path, or a URL; empty for -update-center
+	fix   string // What makes it available
+}
+
+var capabilityList = map[string]capability{
+	"crumbIssuer":   {"CSRF crumb issuer", "/crumbIssuer/api/json", "nothing, requests then go without a crumb"},
+	"cli":           {"CLI over HTTP", "/cli", "enable the CLI on the controller (it is off when jenkins.CLI.disabled is set)"},
+	"scriptConsole": {"script console", "/script", "grant -jenkinsUser Overall/Administer"},
+	"pluginManager": {"plugin manager", "/pluginManager/api/json?tree=plugins[shortName]", "grant -jenkinsUser Overall/Administer"},
+	"updateCenter":  {"update center", "", "allow this machine to reach -update-center, e.g. through HTTPS_PROXY, or set it to one it can reach"},
+}
+
+// stepCapabilities lists what each step cannot do without. The install step
+// is not listed: it picks its mechanism, see installMechanism.
+var stepCapabilities = map[string][]string{
+	"deps":           {"updateCenter", "pluginManager"},
+	"uninstall":      {"pluginManager"},
+	"verify":         {"pluginManager"},
+	"monitors":       {"scriptConsole"},
+	"discardOldData": {"scriptConsole"},
+}
+
+// optionalSteps only report on the run; without their prerequisites they are
+// left out with a warning instead of stopping the run.
+var optionalSteps = map[string]bool{"monitors": true}
+
+var (
+	capabilitiesMu sync.Mutex
+	capabilities   = map[string]error{} // Probed capabilities, nil when available
+)
+
+// hasCapability probes a capability once per run and returns why it is not
+// available, nil when it is.
+func hasCapability(name string) error {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	if err, ok := capabilities[name]; ok {
+		return err
+	}
+	c := capabilityList[name]
+	var req *http.Request
+	var err error
+	switch {
+	case c.probe == "":
+		if c.probe, err = updateCenterSource(); err == nil {
+			req, err = http.NewRequest("HEAD", c.probe, nil)
+		}
+	case strings.HasPrefix(c.probe, "https://") || strings.HasPrefix(c.probe, "http://"):
+		req, err = http.NewRequest("HEAD", c.probe, nil)
+	default:
+		req, err = newJenkinsRequest("GET", c.probe, nil)
+	}
+	if err == nil {
+		var resp *http.Response
+		if resp, err = pollClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				err = newHTTPStatusError(req.Method+" "+c.probe, resp)
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("no %s (%v); to use it, %s", c.name, err, c.fix)
+	}
+	capabilities[name] = err
+	debug(1, "Capability %s: %v", name, err == nil)
+	return err
+}
+
+// installMechanism picks how the install step works: as -install-with says,
+// or with auto, an upload when the plugin manager accepts this user and the
+// CLI when it does not.
+func installMechanism() (string, error) {
+	switch *installWith {
+	case "http":
+		return "http", hasCapability("pluginManager")
+	case "cli":
+		return "cli", hasCapability("cli")
+	}
+	upload := hasCapability("pluginManager")
+	if upload == nil {
+		return "http", nil
+	}
+	cli := hasCapability("cli")
+	if cli == nil {
+		return "cli", nil
+	}
+	return "", fmt.Errorf("cannot install: %v; %v", upload, cli)
+}
+
+// checkCapabilities probes what the steps need before any of them runs, so a
+// missing prerequisite is reported up front rather than half way through an
+// update. Optional steps that cannot run are left out.
+func checkCapabilities(steps []string) ([]string, error) {
+	var kept []string
+	var problems []error
+	for _, step := range steps {
+		var missing error
+		for _, name := range stepCapabilities[step] {
+			if err := hasCapability(name); err != nil {
+				missing = err
+				break
+			}
+		}
+		if step == "install" || strings.HasPrefix(step, "install:") {
+			_, missing = installMechanism()
+		}
+		switch {
+		case missing == nil:
+			kept = append(kept, step)
+		case optionalSteps[step]:
+			notify("⚠️", "Leaving out %s: %v", step, missing)
+		default:
+			problems = append(problems, fmt.Errorf("step %s: %w", step, missing))
+		}
+	}
+	return kept, errors.Join(problems...)
+}
+
+// capabilitiesCommand prints which features the controller offers and what
+// the steps that need a missing one would do.
+func capabilitiesCommand(args []string) error {
+	if len(args) > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))}
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+	var lines []string
+	for _, name := range sortedKeys(capabilityList) {
+		if err := hasCapability(name); err != nil {
+			lines = append(lines, "❌ "+err.Error())
+		} else {
+			lines = append(lines, "✅ "+capabilityList[name].name)
+		}
+	}
+	if mechanism, err := installMechanism(); err == nil {
+		lines = append(lines, "Plugins are installed with "+mechanism)
+	} else {
+		lines = append(lines, err.Error())
+	}
+	printOutput(strings.Join(lines, "\n"))
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	stateFile = flag.String("state-file", ".jenkins-wrapper-state.json", "Where a run records its progress, so an interrupted run can be resumed; empty to disable")
+	resume    = flag.Bool("resume", false, "Continue the interrupted run recorded in -state-file after its last finished step")
+)
+
+// runState is the progress of a pipeline run, written after every step.
+type runState struct {
+	CorrelationID string    `json:"correlationId"`
+	Started       time.Time `json:"started"`
+	Updated       time.Time `json:"updated"`
+	JenkinsURL    string    `json:"jenkinsUrl"`
+	Plugin        string    `json:"plugin"`
+	PluginPath    string    `json:"pluginPath"`
+	PluginSHA256  string    `json:"pluginSha256"`
+	Steps         []string  `json:"steps"`
+	Done          int       `json:"done"` // Steps finished, in order
+}
+
+// checkpoint is the state of the running pipeline command, nil when
+// progress is not recorded.
+var checkpoint *runState
+
+// startCheckpoint begins recording a run of steps. With -resume, it picks up
+// the recorded run instead and returns the steps still to do; the recorded
+// run must be for the same controller and plugin file.
+func startCheckpoint(steps []string) ([]string, error) {
+	if *stateFile == "" {
+		if *resume {
+			return nil, usageError{errors.New("-resume needs -state-file")}
+		}
+		return steps, nil
+	}
+	if *dryRun && !*resume {
+		return steps, nil
+	}
+	sum, _ := fileSha256(pluginPath) // Commands like restart need no plugin file
+
+	if !*resume {
+		if old, err := readRunState(); err == nil && old.Done < len(old.Steps) {
+			notify("⚠️", "Run %s was interrupted after %s, starting over; use -resume to continue it instead", old.CorrelationID, old.lastStep())
+		}
+		checkpoint = &runState{
+			CorrelationID: runCorrelationID(),
+			Started:       time.Now(),
+			JenkinsURL:    jenkinsURL,
+			Plugin:        pluginName,
+			PluginPath:    pluginPath,
+			PluginSHA256:  sum,
+			Steps:         steps,
+		}
+		return steps, checkpoint.save()
+	}
+
+	state, err := readRunState()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no interrupted run to resume in %s", *stateFile)
+	} else if err != nil {
+		return nil, err
+	}
+	switch {
+	case state.JenkinsURL != jenkinsURL:
+		return nil, fmt.Errorf("the interrupted run was on %s, not %s", state.JenkinsURL, jenkinsURL)
+	case state.Plugin != pluginName || state.PluginSHA256 != sum:
+		return nil, fmt.Errorf("the interrupted run installed %s from %s, not this %s", state.Plugin, state.PluginPath, pluginPath)
+	case state.Done >= len(state.Steps):
+		return nil, fmt.Errorf("the run recorded in %s finished, nothing to resume", *stateFile)
+	}
+	for _, name := range state.Steps[state.Done:] {
+		if _, ok := stepLibrary[name]; !ok && !strings.HasPrefix(name, "sleep:") {
+			return nil, fmt.Errorf("the interrupted run has step %s, which this run does not; resume it with the same plugins", name)
+		}
+	}
+	notify("⏯️", "Resuming run %s after %s: %s", state.CorrelationID, state.lastStep(), strings.Join(state.Steps[state.Done:], ", "))
+	checkpoint = state
+	return state.Steps[state.Done:], nil
+}
+
+func readRunState() (*runState, error) {
+	data, err := os.ReadFile(*stateFile)
+	if err != nil {
+		return nil, err
+	}
+	var s runState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", *stateFile, err)
+	}
+	return &s, nil
+}
+
+func (s *runState) lastStep() string {
+	if s.Done == 0 {
+		return "no step"
+	}
+	return s.Steps[s.Done-1]
+}
+
+// advance records that a step finished. Steps are matched forward, so
+// skipping one from the rescue prompt is recorded too.
+func (s *runState) advance(name string) {
+	if s == nil {
+		return
+	}
+	i := slices.Index(s.Steps[s.Done:], name)
+	if i < 0 {
+		return // Not part of the recorded run, e.g. a rollback
+	}
+	s.Done += i + 1
+	if err := s.save(); err != nil {
+		notify("⚠️", "Cannot record progress in %s: %v", *stateFile, err)
+	}
+}
+
+// rewind records that the run starts over after step done, as a retry
+// of the whole pipeline does, so advance matches its steps again from there.
+func (s *runState) rewind(done int) {
+	if s == nil || s.Done == done {
+		return
+	}
+	s.Done = done
+	if err := s.save(); err != nil {
+		notify("⚠️", "Cannot record progress in %s: %v", *stateFile, err)
+	}
+}
+
+// save replaces the state file without ever leaving it half written.
+func (s *runState) save() error {
+	if *dryRun {
+		return nil
+	}
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(*stateFile), "."+filepath.Base(*stateFile)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), *stateFile)
+}
+
+// finish removes the state of a run that completed, so only interrupted
+// runs leave one behind.
+func (s *runState) finish(err error) {
+	if s == nil || *dryRun {
+		return
+	}
+	if err != nil {
+		notify("💾", "Progress saved in %s, continue with -resume after fixing the cause", *stateFile)
+		return
+	}
+	os.Remove(*stateFile)
+}
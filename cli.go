@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// ensureCLIJar points jenkinsCLIPath at the jenkins-cli.jar the controller
+// serves when none is configured. The jar is cached per core version, so it
+// follows controller upgrades without a manually kept copy going stale; a
+// controller that does not say its version gets a fresh download.
+func ensureCLIJar() error {
+	if jenkinsCLIPath != "" {
+		return nil
+	}
+	version := controllerVersion()
+	if version == "" {
+		version = "unknown"
+	}
+	dir, err := cacheDir("cli", version)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "jenkins-cli.jar")
+	if version == "unknown" || !fileExists(path) {
+		notify("⬇️", "Downloading jenkins-cli.jar from %s...", jenkinsURL)
+		if err := downloadFile(jenkinsURL+"/jnlpJars/jenkins-cli.jar", path); err != nil {
+			return err
+		}
+	}
+	jenkinsCLIPath = path
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	cloudEventsURL    = flag.String("cloudevents-url", "", "POST every pipeline step start and finish as a CloudEvent to this URL, e.g. a broker or a Kafka REST proxy")
+	cloudEventsSource = flag.String("cloudevents-source", "", "CloudEvents source attribute (default: jenkins-wrapper/<hostname>)")
+)
+
+// cloudEventTypes maps step statuses to the CloudEvents type of the event.
+var cloudEventTypes = map[string]string{
+	"running": "io.jenkins-wrapper.step.started",
+	"ok":      "io.jenkins-wrapper.step.succeeded",
+	"failed":  "io.jenkins-wrapper.step.failed",
+}
+
+// runFinishedType is the CloudEvents type of the record of a whole run.
+const runFinishedType = "io.jenkins-wrapper.run.finished"
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON mode.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	JenkinsURL      string    `json:"jenkinsurl,omitempty"` // Extension attribute
+	Plugin          string    `json:"plugin,omitempty"`     // Extension attribute
+	CorrelationID   string    `json:"correlationid"`        // Extension attribute
+	Data            any       `json:"data"`
+}
+
+func newCloudEvent(eventType, subject string, data any) cloudEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          cloudEventSource(),
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		JenkinsURL:      jenkinsURL,
+		Plugin:          pluginName,
+		CorrelationID:   runCorrelationID(),
+		Data:            data,
+	}
+}
+
+func cloudEventSource() string {
+	if *cloudEventsSource != "" {
+		return *cloudEventsSource
+	}
+	host, _ := os.Hostname()
+	return "jenkins-wrapper/" + host
+}
+
+// httpPublisher POSTs each event in CloudEvents structured mode.
+type httpPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPPublisher(url string) *httpPublisher {
+	return &httpPublisher{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *httpPublisher) send(payload []byte) error {
+	resp, err := p.client.Post(p.url, "application/cloudevents+json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newHTTPStatusError("failed to deliver event", resp)
+	}
+	return nil
+}
+
+func (p *httpPublisher) close() error { return nil }
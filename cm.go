@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// exitChanged is the exit code of a -output cm run that changed the
+// controller, so config management tools can tell "nothing to do" from
+// "changed" by the exit code alone (Ansible: changed_when: rc == 10,
+// failed_when: rc not in [0, 10]). Failures keep their usual codes; it is
+// not Puppet's 2, which flag already exits with on a bad command line.
+const exitChanged = 10
+
+// changingSteps are the pipeline steps that change the controller. A run
+// that completed one of them reports changed.
+var changingSteps = map[string]bool{
+	"uninstall":       true,
+	"install":         true,
+	"enable":          true,
+	"quietDown":       true,
+	"cancelQuietDown": true,
+	"stop":            true,
+	"safeRestart":     true,
+	"reload":          true,
+	"start":           true,
+	"discardOldData":  true,
+}
+
+// changesController reports whether a step is one of changingSteps,
+// counting the install:NAME steps of install -plugins-file as install.
+func changesController(step string) bool {
+	return changingSteps[step] || strings.HasPrefix(step, "install:")
+}
+
+// cmDiff is the state of the plugin before and after the run, in the
+// before/after shape Ansible shows with --diff.
+type cmDiff struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// cmResult is the single JSON object -output cm prints when the run ends.
+type cmResult struct {
+	Changed  bool     `json:"changed"`
+	Failed   bool     `json:"failed"`
+	DryRun   bool     `json:"dryRun,omitempty"` // Nothing was changed, changed says what would have been
+	Actions  []string `json:"actions"`
+	Diff     *cmDiff  `json:"diff,omitempty"`
+	Msg      string   `json:"msg,omitempty"` // The error, or the last status line
+	Messages []string `json:"messages,omitempty"`
+	ExitCode int      `json:"rc"`
+}
+
+// cmSink replaces the console sink with -output cm. It keeps the status
+// lines for the final object instead of printing them.
+type cmSink struct {
+	mu       sync.Mutex
+	messages []string
+	msg      string
+	failure  string
+	before   *string // Plugin state before the first change, nil until then
+}
+
+// cm is the sink of -output cm, nil in the other output formats.
+var cm *cmSink
+
+func (s *cmSink) write(e event) {
+	if e.Level == "DEBUG" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, e.Text)
+	if e.Level == "ERROR" {
+		s.failure = e.Text
+	} else {
+		s.msg = e.Text
+	}
+}
+
+func (*cmSink) close() error { return nil }
+
+// pluginSnapshot describes the state of the configured plugin on the
+// controller for the diff.
+func pluginSnapshot() string {
+	p, err := findPlugin(pluginName)
+	if err != nil {
+		return "unknown: " + err.Error()
+	}
+	if p == nil {
+		return pluginName + " not installed"
+	}
+	return fmt.Sprintf("%s %s %s", pluginName, p.Version, p.state())
+}
+
+// beforeChange records the plugin state when the first changing step of the
+// run is about to start.
+func (s *cmSink) beforeChange(step string) {
+	if !changesController(step) || pluginName == "" {
+		return
+	}
+	s.mu.Lock()
+	captured := s.before != nil
+	s.mu.Unlock()
+	if captured {
+		return
+	}
+	before := pluginSnapshot()
+	s.mu.Lock()
+	s.before = &before
+	s.mu.Unlock()
+}
+
+// finish prints the result object and returns the exit code for it.
+func (s *cmSink) finish(code int) int {
+	result := cmResult{Failed: code != exitOK, DryRun: *dryRun, Actions: []string{}}
+	for _, step := range report.Steps {
+		if step.Status == "ok" && changesController(step.Name) {
+			result.Actions = append(result.Actions, step.Name)
+		}
+	}
+	result.Changed = len(result.Actions) > 0
+
+	s.mu.Lock()
+	result.Messages, result.Msg = s.messages, s.msg
+	if result.Failed && s.failure != "" {
+		result.Msg = s.failure
+	}
+	before := s.before
+	s.mu.Unlock()
+	if before != nil {
+		result.Diff = &cmDiff{Before: *before, After: pluginSnapshot()}
+	}
+
+	if code == exitOK && result.Changed {
+		code = exitChanged
+	}
+	result.ExitCode = code
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+	return code
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commands are dispatched on the first command line argument; without one,
+// update runs.
+var commands = map[string]func(args []string) error{
+	"update":           pipelineCommand(nil),
+	"install":          installCommand,
+	"uninstall":        pipelineCommand([]string{"uninstall"}),
+	"restart":          pipelineCommand(restartPipeline),
+	"reload":           pipelineCommand(reloadPipeline),
+	"config":           configCommand,
+	"daemon":           daemonCommand,
+	"promote":          promoteCommand,
+	"stats":            statsCommand,
+	"bench":            benchCommand,
+	"lint-jenkinsfile": lintJenkinsfileCommand,
+	"baseline":         baselineCommand,
+	"init":             initCommand,
+	"status":           statusCommand,
+	"instance":         instanceCommand,
+	"test-matrix":      testMatrixCommand,
+	"mirror":           mirrorCommand,
+	"load-times":       loadTimesCommand,
+	"tui":              tuiCommand,
+	"watch":            watchCommand,
+	"ensure-plugin":    ensurePluginCommand,
+	"doctor":           doctorCommand,
+	"self-update":      selfUpdateCommand,
+	"version":          versionCommand,
+	"fix-perms":        fixPermsCommand,
+	"plan":             planCommand,
+	"apply":            applyCommand,
+	"capabilities":     capabilitiesCommand,
+	"install-plugin":   installPluginCommand,
+	"template":         templateCommand,
+	"cache":            cacheCommand,
+}
+
+// run-template dispatches commands itself, so it is added here rather than
+// in the initializer, which must not refer back to commands.
+func init() {
+	commands["run-template"] = runTemplateCommand
+}
+
+func runCommand(args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return usageError{fmt.Errorf("unknown command %q, available: %s", args[0], strings.Join(names, ", "))}
+	}
+	return command(args[1:])
+}
+
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config schema|validate [command]")
+	}
+	switch args[0] {
+	case "schema":
+		return printConfigSchema()
+	case "validate":
+		return validateConfigCommand(args[1:])
+	}
+	return fmt.Errorf("unknown config command %q", args[0])
+}
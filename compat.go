@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// actionForm is the body the confirmation pages of action endpoints
+// submit: an f:form with a single f:submit button, to which Stapler adds the
+// json field of structured forms. Cores that read neither ignore them, so
+// the same body suits every version.
+var actionForm = url.Values{"Submit": {"Yes"}, "json": {"{}"}}
+
+var (
+	knownVersionsMu sync.Mutex
+	// knownVersions caches the X-Jenkins header per controller URL; a
+	// controller is only recorded once it answered.
+	knownVersions = map[string]string{}
+)
+
+// controllerVersion returns the core version of the controller, or "" when
+// it cannot be told, e.g. because Jenkins is down.
+func controllerVersion() string {
+	knownVersionsMu.Lock()
+	v, ok := knownVersions[jenkinsURL]
+	knownVersionsMu.Unlock()
+	if ok {
+		return v
+	}
+	resp, err := pollClient.Get(jenkinsURL + "/login")
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	v = resp.Header.Get("X-Jenkins")
+	knownVersionsMu.Lock()
+	knownVersions[jenkinsURL] = v
+	knownVersionsMu.Unlock()
+	return v
+}
+
+// forgetControllerVersion drops the cached version of the controller, for
+// when it is about to run a different core.
+func forgetControllerVersion() {
+	knownVersionsMu.Lock()
+	defer knownVersionsMu.Unlock()
+	delete(knownVersions, jenkinsURL)
+}
+
+// newActionRequest builds the POST to an action endpoint with the form
+// its confirmation page submits.
+func newActionRequest(path string) (*http.Request, error) {
+	req, err := newJenkinsRequest("POST", path, strings.NewReader(actionForm.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
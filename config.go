@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// setting is a configuration value that can be given as a flag, an
+// environment variable, an entry in the .env file or in the YAML config file,
+// in that order of precedence.
+type setting struct {
+	flag   string
+	env    string
+	yaml   string // Dotted path in the YAML config file, section.key
+	usage  string
+	value  *string
+	def    string
+	secret bool // Masked whenever the configuration is displayed
+}
+
+var settings = []setting{
+	{flag: "jenkinsURL", env: "JENKINS_URL", yaml: "server.url", usage: "Jenkins URL (discovered on this machine when unset)", value: &jenkinsURL},
+	{flag: "jenkinsUser", env: "JENKINS_USER", yaml: "auth.user", usage: "Jenkins username", value: &jenkinsUser},
+	{flag: "jenkinsToken", env: "JENKINS_TOKEN", yaml: "auth.token", usage: "Jenkins API token", value: &jenkinsToken, secret: true},
+	{flag: "jenkinsCLIPath", env: "JENKINS_CLI_PATH", yaml: "server.cli", usage: "Path to jenkins-cli.jar for -install-with cli, by default downloaded from the controller", value: &jenkinsCLIPath},
+	{flag: "pluginName", env: "PLUGIN_NAME", yaml: "plugin.name", usage: "Plugin name", value: &pluginName},
+	{flag: "pluginPath", env: "PLUGIN_PATH", yaml: "plugin.path", usage: "Path to the new plugin .hpi file", value: &pluginPath},
+	{flag: "pluginURL", env: "PLUGIN_URL", yaml: "plugin.url", usage: "Download the plugin .hpi from this URL instead of using -pluginPath", value: &pluginURL},
+	{flag: "pluginURLHeader", env: "PLUGIN_URL_HEADER", yaml: "plugin.url-header", usage: "Header sent with the -pluginURL download, e.g. Authorization: Bearer <token>", value: &pluginURLHeader, secret: true},
+	{flag: "pluginGAV", env: "PLUGIN_GAV", yaml: "plugin.gav", usage: "Resolve the plugin from -maven-repo by groupId:artifactId[:version] instead of using -pluginPath", value: &pluginGAV},
+	{flag: "maven-repo", env: "MAVEN_REPO", yaml: "plugin.maven-repo", usage: "Maven repository -pluginGAV resolves from, e.g. an Artifactory or Nexus repository URL", value: &mavenRepo, def: "https://repo.jenkins-ci.org/releases/"},
+	{flag: "maven-user", env: "MAVEN_USER", yaml: "auth.maven-user", usage: "User for -maven-repo", value: &mavenUser},
+	{flag: "maven-password", env: "MAVEN_PASSWORD", yaml: "auth.maven-password", usage: "Password or API key for -maven-repo", value: &mavenPassword, secret: true},
+	{flag: "jenkinsWarPath", env: "JENKINS_WAR_PATH", yaml: "server.war", usage: "Path to jenkins.war", value: &jenkinsWarPath},
+	{flag: "war-sha256", env: "JENKINS_WAR_SHA256", yaml: "server.war-sha256", usage: "Expected SHA-256 of -jenkinsWarPath, for custom builds; by default the WAR must match the official checksum of its version", value: &warSHA256},
+	{flag: "jenkinsLogPath", env: "JENKINS_LOG_PATH", yaml: "server.log", usage: "Where the started Jenkins writes its console output", value: &jenkinsLogPath, def: "jenkins.log"},
+	{flag: "jenkinsHome", env: "JENKINS_HOME", yaml: "server.home", usage: "JENKINS_HOME, when Jenkins runs on this machine; the started WAR uses it and it is created if missing", value: &jenkinsHome},
+	{flag: "jenkinsOptions", env: "JENKINS_OPTS", yaml: "server.options", usage: "Extra Winstone options for the started Jenkins, e.g. --httpPort=8080; secret ones are passed through a private file", value: &jenkinsOptions, secret: true},
+	{flag: "pipeline", env: "PIPELINE_STEPS", yaml: "lifecycle.pipeline", usage: "Comma-separated custom step sequence, empty for the default update", value: &pipelineSteps},
+	{flag: "stabilize-wait", env: "STABILIZE_WAIT", yaml: "lifecycle.stabilize-wait", usage: "Pause after uninstalling or reloading, letting Jenkins settle (sleep:stabilize in -pipeline)", value: &stabilizeWait, def: "5s"},
+	{flag: "startup-wait", env: "STARTUP_WAIT", yaml: "lifecycle.startup-wait", usage: "Longest wait for Jenkins to come online after a start or restart (the wait step)", value: &startupWait, def: "60s"},
+	{flag: "settle-wait", env: "SETTLE_WAIT", yaml: "lifecycle.settle-wait", usage: "Pause after Jenkins is back up and before verifying the plugin (sleep:settle in -pipeline)", value: &settleWait, def: "10s"},
+	{flag: "shutdown-wait", env: "SHUTDOWN_WAIT", yaml: "lifecycle.shutdown-wait", usage: "Longest wait for Jenkins to shut down before starting it again (the stopped step), and the pause of sleep:shutdown", value: &shutdownWait, def: "10s"},
+	{flag: "schedule", env: "SCHEDULE", yaml: "lifecycle.schedule", usage: "Recurring tasks for the daemon command, e.g. check=1h:verify;restart=168h:safeRestart,wait", value: &scheduleSpec},
+	{flag: "githubToken", env: "GITHUB_TOKEN", yaml: "auth.github-token", usage: "GitHub token for -plugin github: sources in private repositories", value: &githubToken, secret: true},
+	{flag: "env", env: "DEPLOY_ENV", yaml: "lifecycle.env", usage: "Environment this run targets; installs must be promoted from the previous one", value: &deployEnv},
+	{flag: "promotion-order", env: "PROMOTION_ORDER", yaml: "lifecycle.promotion-order", usage: "Environments artifacts are promoted through, in order", value: &promotionOrder, def: "dev,staging,prod"},
+	{flag: "promotion-ledger", env: "PROMOTION_LEDGER", yaml: "lifecycle.promotion-ledger", usage: "File recording promoted artifacts", value: &promotionLedger, def: "promotions.json"},
+	{flag: "backup-dir", env: "BACKUP_DIR", yaml: "plugin.backup-dir", usage: "Where to back up the installed plugin before updating (default: JENKINS_HOME/plugins)", value: &backupDir},
+	{flag: "baseline", env: "PLUGIN_BASELINE", yaml: "plugin.baseline", usage: "File of org-mandated minimum plugin versions, name:version per line", value: &baselineFile, def: "baseline.txt"},
+	{flag: "access-log", env: "JENKINS_ACCESS_LOG", yaml: "server.access-log", usage: "Access log of the controller or its reverse proxy on the Jenkins host; the run's entries go into support bundles", value: &accessLogPath},
+	{flag: "maintenance-calendar", env: "MAINTENANCE_CALENDAR", yaml: "lifecycle.maintenance-calendar", usage: "iCal feed (URL or file) of approved maintenance windows, e.g. the secret address of a Google Calendar; uninstalls and restarts are refused outside them", value: &maintenanceCalendar},
+	{flag: "run-history", env: "RUN_HISTORY", yaml: "lifecycle.run-history", usage: "File of completed deployments, shared by scheduled and manual runs so a plugin already deployed is not deployed again; empty to disable", value: &runHistory, def: "deployments.json"},
+	{flag: "update-center", env: "UPDATE_CENTER_URL", yaml: "plugin.update-center", usage: "update-center.json plugins and their dependencies are resolved from, e.g. of an internal update center (default: the one of -channel)", value: &updateCenterURL},
+	{flag: "channel", env: "UPDATE_CENTER_CHANNEL", yaml: "plugin.channel", usage: "Update center channel of updates.jenkins.io: stable, or experimental for alpha and beta releases of plugins", value: &updateCenterChannel, def: "stable"},
+	{flag: "plugin-mirrors", env: "PLUGIN_MIRRORS", yaml: "plugin.mirrors", usage: "Comma-separated sites plugins are downloaded from, tried in order, laid out like https://updates.jenkins.io/download/", value: &pluginMirrors, def: "https://updates.jenkins.io/download/"},
+	{flag: "artifact-cache", env: "ARTIFACT_CACHE", yaml: "plugin.artifact-cache", usage: "Content-addressed cache of downloaded plugins, e.g. a directory the machines of a fleet share (default: the user cache directory)", value: &artifactCache},
+	{flag: "templates-dir", env: "TEMPLATES_DIR", yaml: "lifecycle.templates-dir", usage: "Where saved templates are kept, e.g. a directory in a repository the team shares (default: the user config directory)", value: &templatesDir},
+	{flag: "reports-dir", env: "REPORTS_DIR", yaml: "lifecycle.reports-dir", usage: "Where the daemon writes task reports", value: &reportsDir, def: "reports"},
+}
+
+var (
+	envFile    = flag.String("env-file", ".env", "File with KEY=VALUE defaults for the settings")
+	configFile = flag.String("config", "jenkins-wrapper.yaml", "YAML file with defaults for the settings, in server, auth, plugin and lifecycle sections")
+	profile    = flag.String("profile", os.Getenv("JENKINS_WRAPPER_PROFILE"), "Profile in the YAML config file whose sections override the top-level ones, e.g. prod (env JENKINS_WRAPPER_PROFILE)")
+)
+
+func init() {
+	for _, s := range settings {
+		flag.StringVar(s.value, s.flag, "", s.usage+" (env "+s.env+")")
+	}
+}
+
+// loadSettings fills every setting not given on the command line from the
+// selected profile, then the environment, then the .env file, then the
+// top level of the YAML config file, then its default. A profile names the
+// controller to work on, so the environment of the shell it runs in must
+// not send part of the run elsewhere.
+func loadSettings() error {
+	fileValues, err := loadEnv(*envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %v", *envFile, err)
+	}
+	yamlValues, err := loadYAML(*configFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %v", *configFile, err)
+	}
+	fromProfile := map[string]bool{}
+	for key := range yamlValues {
+		if setting, ok := strings.CutPrefix(key, "profiles."+*profile+"."); ok && *profile != "" {
+			fromProfile[setting] = true
+		}
+	}
+	if yamlValues, err = applyProfile(yamlValues, *profile); err != nil {
+		return fmt.Errorf("%s: %v", *configFile, err)
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, s := range settings {
+		if given[s.flag] {
+			continue
+		}
+		if fromProfile[s.yaml] {
+			*s.value = yamlValues[s.yaml]
+			if v, ok := os.LookupEnv(s.env); ok && v != *s.value {
+				notify("⚠️", "%s is set in the environment, profile %s overrides it", s.env, *profile)
+			}
+		} else if v, ok := os.LookupEnv(s.env); ok {
+			*s.value = v
+		} else if v, ok := fileValues[s.env]; ok {
+			*s.value = v
+		} else if v, ok := yamlValues[s.yaml]; ok {
+			*s.value = v
+		} else {
+			*s.value = s.def
+		}
+	}
+	return nil
+}
+
+// applyProfile checks the YAML config file values and returns the top-level
+// ones with the selected profile's laid over them. Profiles live under
+// profiles.<name> and use the same sections as the top level.
+func applyProfile(values map[string]string, name string) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, s := range settings {
+		known[s.yaml] = true
+	}
+	merged := map[string]string{}
+	profiles := map[string]bool{}
+	for _, key := range sortedKeys(values) {
+		setting := key
+		if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+			var p string
+			p, setting, _ = strings.Cut(rest, ".")
+			profiles[p] = true
+		}
+		if !known[setting] {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		if setting == key {
+			merged[key] = values[key]
+		}
+	}
+	if name == "" {
+		return merged, nil
+	}
+	if !profiles[name] {
+		return nil, fmt.Errorf("no profile %q, available: %s", name, strings.Join(sortedKeys(profiles), ", "))
+	}
+	prefix := "profiles." + name + "."
+	for key, value := range values {
+		if setting, ok := strings.CutPrefix(key, prefix); ok {
+			merged[setting] = value
+		}
+	}
+	return merged, nil
+}
+
+// validateSettings checks that the settings the steps use are set, naming
+// the steps that need each missing one, and that -install-with is known.
+func validateSettings(steps []string) error {
+	if !slices.Contains([]string{"auto", "http", "cli"}, *installWith) {
+		return usageError{fmt.Errorf("unknown -install-with %q, use auto, http or cli", *installWith)}
+	}
+	neededBy := map[string][]string{}
+	for _, step := range steps {
+		for _, name := range stepSettings[step] {
+			neededBy[name] = append(neededBy[name], step)
+		}
+	}
+	var missing []string
+	for _, s := range settings {
+		if by := neededBy[s.flag]; len(by) > 0 && *s.value == "" {
+			missing = append(missing, fmt.Sprintf("-%s (needed by %s)", s.flag, strings.Join(by, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		return usageError{fmt.Errorf("missing %s", strings.Join(missing, ", "))}
+	}
+	return nil
+}
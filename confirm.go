@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var assumeYes bool
+
+func init() {
+	flag.BoolVar(&assumeYes, "yes", false, "Do not ask before uninstalling the plugin or stopping Jenkins")
+	flag.BoolVar(&assumeYes, "y", false, "Shorthand for -yes")
+}
+
+// destructiveSteps are the steps an operator is asked about first, with what
+// they do for the prompt.
+var destructiveSteps = map[string]func() string{
+	"uninstall":   func() string { return "uninstall " + pluginName },
+	"stop":        func() string { return "stop Jenkins" },
+	"safeRestart": func() string { return "restart Jenkins once running builds finish" },
+}
+
+// confirmed is set once the operator agreed, so retries, rescues and later
+// rounds of watch do not ask again.
+var confirmed bool
+
+var errNotConfirmed = errors.New("not confirmed, nothing was changed")
+
+// confirmDestructive asks on the terminal before a pipeline uninstalls the
+// plugin or takes Jenkins down, naming the controller so a wrong -jenkinsURL
+// is caught. Without a terminal, as in CI or cron, nobody can be asked and
+// the run goes ahead as before.
+func confirmDestructive(names []string) error {
+	if assumeYes || confirmed || *dryRun || !interactive() {
+		return nil
+	}
+	var actions []string
+	for _, name := range names {
+		if describe, ok := destructiveSteps[name]; ok {
+			actions = append(actions, describe())
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+
+	// On stderr, so -output json and cm keep stdout to themselves
+	fmt.Fprintf(os.Stderr, "This will %s on %s. Continue? [y/N] ", strings.Join(actions, ", then "), jenkinsURL)
+	answer, ok := <-readRescueInput()
+	if !ok || (!strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes")) {
+		return errNotConfirmed
+	}
+	confirmed = true
+	return nil
+}
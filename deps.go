@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pluginManifest is what the wrapper reads from an .hpi's MANIFEST.MF.
+type pluginManifest struct {
+	ShortName    string
+	Version      string
+	CoreVersion  string // Oldest Jenkins core the plugin supports
+	Dependencies []ucDependency
+}
+
+// readPluginManifest extracts META-INF/MANIFEST.MF from a plugin archive into
+// the run workspace and parses it.
+func readPluginManifest(path string) (*pluginManifest, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %v", path, err)
+	}
+	defer zr.Close()
+
+	f, err := zr.Open("META-INF/MANIFEST.MF")
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s has no manifest: %v", path, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if ws != nil {
+		os.WriteFile(ws.path(manifestsDir, filepath.Base(path)+".MF"), data, 0o644)
+	}
+
+	attrs := parseManifest(string(data))
+	m := &pluginManifest{ShortName: attrs["Short-Name"], Version: attrs["Plugin-Version"], CoreVersion: attrs["Jenkins-Version"]}
+	for _, entry := range strings.Split(attrs["Plugin-Dependencies"], ",") {
+		if entry == "" {
+			continue
+		}
+		spec, resolution, _ := strings.Cut(entry, ";")
+		name, version, _ := strings.Cut(spec, ":")
+		m.Dependencies = append(m.Dependencies, ucDependency{
+			Name:     name,
+			Version:  version,
+			Optional: strings.Contains(resolution, "optional"),
+		})
+	}
+	return m, nil
+}
+
+// parseManifest reads main attributes of a JAR manifest, joining the
+// continuation lines (starting with a space) that wrap long values.
+func parseManifest(data string) map[string]string {
+	attrs := map[string]string{}
+	var key string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && key != "" {
+			attrs[key] += line[1:]
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			key = k
+			attrs[key] = v
+		}
+	}
+	return attrs
+}
+
+// dependencyGraph is the transitive set of required plugins for a request,
+// with the minimum version each one is needed at.
+type dependencyGraph struct {
+	Timestamp string              `json:"timestamp"` // generationTimestamp of the update center used
+	Requested []string            `json:"requested"`
+	Versions  map[string]string   `json:"versions"`
+	Edges     map[string][]string `json:"edges"`
+}
+
+// resolveDependencies resolves the required (non-optional) dependencies of
+// the given requirements transitively. Results are cached per update center
+// source, generation and requested set, so repeat runs skip the walk entirely
+// and a new update center publication invalidates them automatically.
+func resolveDependencies(uc *updateCenter, requested []ucDependency) (*dependencyGraph, error) {
+	source, err := updateCenterSource()
+	if err != nil {
+		return nil, err
+	}
+	key := dependencyCacheKey(source, uc.GenerationTimestamp, requested)
+	dir, err := cacheDir("deps")
+	if err != nil {
+		return nil, err
+	}
+	cachePath := filepath.Join(dir, key+".json")
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var graph dependencyGraph
+		if json.Unmarshal(data, &graph) == nil && graph.Timestamp == uc.GenerationTimestamp {
+			return &graph, nil
+		}
+	}
+
+	graph := &dependencyGraph{Timestamp: uc.GenerationTimestamp, Versions: map[string]string{}, Edges: map[string][]string{}}
+	queue := append([]ucDependency(nil), requested...)
+	for _, r := range requested {
+		graph.Requested = append(graph.Requested, r.Name)
+	}
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		if dep.Optional {
+			continue
+		}
+		if _, deprecated := uc.Deprecations[dep.Name]; deprecated {
+			// A version of the old plugin says nothing about the successor:
+			// require the release the update center has
+			name, err := uc.resolvePluginName(dep.Name)
+			if err != nil {
+				return nil, err
+			}
+			if name != dep.Name {
+				dep = ucDependency{Name: name, Version: uc.Plugins[name].Version}
+			}
+		}
+		if current, seen := graph.Versions[dep.Name]; seen {
+			if compareVersions(dep.Version, current) > 0 {
+				graph.Versions[dep.Name] = dep.Version
+			}
+			continue
+		}
+		graph.Versions[dep.Name] = dep.Version
+
+		plugin, ok := uc.Plugins[dep.Name]
+		if !ok {
+			return nil, fmt.Errorf("plugin %s is not in the update center", dep.Name)
+		}
+		for _, child := range plugin.Dependencies {
+			if !child.Optional {
+				graph.Edges[dep.Name] = append(graph.Edges[dep.Name], child.Name)
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	if data, err := json.Marshal(graph); err == nil {
+		os.WriteFile(cachePath, data, 0o644)
+	}
+	return graph, nil
+}
+
+func dependencyCacheKey(source, timestamp string, requested []ucDependency) string {
+	specs := make([]string, 0, len(requested))
+	for _, r := range requested {
+		specs = append(specs, fmt.Sprintf("%s:%s:%t", r.Name, r.Version, r.Optional))
+	}
+	sort.Strings(specs)
+	sum := sha256.Sum256([]byte(source + "\n" + timestamp + "\n" + strings.Join(specs, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkDependencies makes sure everything the new plugin needs is installed
+// at a recent enough version before the old one is removed.
+func checkDependencies() error {
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return err
+	}
+	uc, err := fetchUpdateCenter()
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies: %v", err)
+	}
+	graph, err := resolveDependencies(uc, manifest.Dependencies)
+	if err != nil {
+		return err
+	}
+	installed, err := listPlugins()
+	if err != nil {
+		return err
+	}
+	versions := map[string]string{}
+	for _, p := range installed {
+		if !p.Deleted {
+			versions[p.ShortName] = p.Version
+		}
+	}
+
+	var problems []string
+	for _, name := range sortedKeys(graph.Versions) {
+		need := graph.Versions[name]
+		have, ok := versions[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s %s is not installed", name, need))
+		case compareVersions(have, need) < 0:
+			problems = append(problems, fmt.Sprintf("%s %s is installed, %s or newer is required", name, have, need))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("plugin %s has unmet dependencies:\n  %s", manifest.ShortName, strings.Join(problems, "\n  "))
+	}
+	notify("✅", "All %d dependencies of %s are installed", len(graph.Versions), manifest.ShortName)
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var iKnowWhatImDoing = flag.Bool("i-know-what-im-doing", false, "Uninstall the plugin even though it was split from core or other plugins need it")
+
+// replacing is set while the pipeline running installs the plugin again
+// after uninstalling it, which is an update rather than a removal.
+var replacing bool
+
+// detachedPlugins were split out of Jenkins core (core's split-plugins.txt),
+// with what stops working without them. Controllers install them on upgrade
+// and plugins built against older cores depend on them implicitly.
+var detachedPlugins = map[string]string{
+	"maven-plugin":              "Maven project jobs",
+	"subversion":                "Subversion checkouts",
+	"cvs":                       "CVS checkouts",
+	"ant":                       "Ant build steps and installations",
+	"javadoc":                   "Javadoc publishing",
+	"external-monitor-job":      "external job monitoring",
+	"ldap":                      "LDAP logins: users of an LDAP security realm are locked out",
+	"pam-auth":                  "Unix user/group logins: users of that security realm are locked out",
+	"mailer":                    "e-mail notifications and the mail server configuration",
+	"matrix-auth":               "matrix-based and project-based authorization: permissions fall back to nothing",
+	"windows-slaves":            "Windows agents launched through DCOM",
+	"antisamy-markup-formatter": "safe HTML in descriptions",
+	"matrix-project":            "multi-configuration (matrix) jobs",
+	"junit":                     "JUnit test results and trends",
+	"bouncycastle-api":          "PEM keys and certificates used by credentials and SSH",
+	"command-launcher":          "agents launched by a command on the controller",
+	"jdk-tool":                  "automatic JDK installation",
+	"jaxb":                      "JAXB for plugins on Java 11 and newer",
+	"trilead-api":               "SSH connections of plugins built against older cores",
+	"sshd":                      "the built-in SSH server and CLI over SSH",
+	"javax-activation-api":      "JavaBeans Activation for plugins built against older cores",
+	"javax-mail-api":            "JavaMail for plugins built against older cores",
+	"instance-identity":         "the instance identity key: inbound agents cannot connect",
+}
+
+// removalImpact lists what stops working when the plugin goes: the core
+// feature of a detached or bundled plugin, and the installed plugins that
+// require it.
+func removalImpact(plugin *installedPlugin, installed []installedPlugin) []string {
+	var impact []string
+	if feature, ok := detachedPlugins[plugin.ShortName]; ok {
+		impact = append(impact, "split from core: "+feature)
+	} else if plugin.Bundled {
+		impact = append(impact, "bundled with the Jenkins WAR")
+	}
+	for _, p := range installed {
+		if p.Deleted {
+			continue
+		}
+		for _, d := range p.Dependencies {
+			if d.ShortName == plugin.ShortName && !d.Optional {
+				impact = append(impact, fmt.Sprintf("required by %s %s", p.ShortName, p.Version))
+			}
+		}
+	}
+	return impact
+}
+
+// guardRemoval refuses to uninstall a plugin others rely on unless the
+// operator acknowledged with -i-know-what-im-doing what will stop working.
+func guardRemoval(plugin *installedPlugin, installed []installedPlugin) error {
+	if replacing {
+		return nil
+	}
+	impact := removalImpact(plugin, installed)
+	if len(impact) == 0 {
+		return nil
+	}
+	if *iKnowWhatImDoing {
+		notify("⚠️", "Uninstalling %s although:\n  %s", plugin.ShortName, strings.Join(impact, "\n  "))
+		return nil
+	}
+	return usageError{fmt.Errorf("refusing to uninstall %s, it is still needed:\n  %s\npass -i-know-what-im-doing to uninstall it anyway", plugin.ShortName, strings.Join(impact, "\n  "))}
+}
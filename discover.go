@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Where local Jenkins instances usually listen.
+var (
+	discoveryPorts    = []int{8080, 8081, 8090, 9090, 8888}
+	discoveryContexts = []string{"", "/jenkins"}
+)
+
+// discoverJenkinsURL fills in jenkinsURL for a controller on this machine (or
+// -remote-host), first from JENKINS_HOME configuration and then by probing
+// common ports. A discovered URL is saved to the .env file when one is in use.
+func discoverJenkinsURL() error {
+	notify("🔎", "No Jenkins URL configured, looking for a local Jenkins...")
+
+	var candidates []string
+	if jenkinsHome != "" {
+		candidates = append(candidates, urlsFromHome(jenkinsHome)...)
+	}
+	for _, port := range discoveryPorts {
+		for _, context := range discoveryContexts {
+			candidates = append(candidates, fmt.Sprintf("http://%s:%d%s", discoveryHost(), port, context))
+		}
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	for _, candidate := range candidates {
+		resp, err := client.Get(candidate + "/login")
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.Header.Get("X-Jenkins") == "" {
+			continue
+		}
+
+		jenkinsURL = candidate
+		notify("✅", "Found Jenkins %s at %s", resp.Header.Get("X-Jenkins"), jenkinsURL)
+		saveDiscoveredURL()
+		return nil
+	}
+	return errors.New("no Jenkins URL configured and none found on this machine, set -jenkinsURL")
+}
+
+// urlsFromHome derives candidate URLs from a local JENKINS_HOME: the root URL
+// configured in Jenkins itself and the port from a Windows service jenkins.xml.
+func urlsFromHome(home string) []string {
+	var urls []string
+
+	if data, err := target.readFile(filepath.Join(home, "jenkins.model.JenkinsLocationConfiguration.xml")); err == nil {
+		var location struct {
+			JenkinsURL string `xml:"jenkinsUrl"`
+		}
+		if xml.Unmarshal(data, &location) == nil && location.JenkinsURL != "" {
+			urls = append(urls, strings.TrimSuffix(location.JenkinsURL, "/"))
+		}
+	}
+
+	if data, err := target.readFile(filepath.Join(home, "jenkins.xml")); err == nil {
+		if m := regexp.MustCompile(`--httpPort=(\d+)`).FindSubmatch(data); m != nil {
+			prefix := ""
+			if p := regexp.MustCompile(`--prefix=(\S+)`).FindSubmatch(data); p != nil {
+				prefix = "/" + strings.Trim(string(p[1]), `/"`)
+			}
+			urls = append(urls, fmt.Sprintf("http://%s:%s%s", discoveryHost(), m[1], prefix))
+		}
+	}
+	return urls
+}
+
+// discoveryHost is the machine Jenkins is expected on.
+func discoveryHost() string {
+	if *remoteHost != "" {
+		return *remoteHost
+	}
+	return "localhost"
+}
+
+func saveDiscoveredURL() {
+	values, err := loadEnv(*envFile)
+	if err != nil {
+		return
+	}
+	values["JENKINS_URL"] = jenkinsURL
+	if err := saveEnv(*envFile, values); err != nil {
+		notify("⚠️", "Failed to save JENKINS_URL to %s: %v", *envFile, err)
+		return
+	}
+	notify("💾", "Saved JENKINS_URL to %s", *envFile)
+}
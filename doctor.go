@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// minJavaVersion is the oldest Java that current Jenkins LTS lines run on.
+const minJavaVersion = 17
+
+// javaVersionPattern matches the version in `java -version` output, e.g.
+// `openjdk version "21.0.2"` or `java version "1.8.0_392"`.
+var javaVersionPattern = regexp.MustCompile(`version "(\d+)(?:\.(\d+))?[^"]*"`)
+
+// doctorCheck is one diagnosis: what was found, or what is wrong and how to
+// fix it.
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+	hint string // Shown when the check fails
+}
+
+var doctorChecks = []doctorCheck{
+	{"java", checkJava, "install Java 17 or newer and put it on the PATH; only needed to start Jenkins or with -install-with cli"},
+	{"jenkins-cli.jar", checkCLIJar, "only needed with -install-with cli; leave -jenkinsCLIPath empty to use the one the controller serves"},
+	{"plugin", checkPluginFile, "point -pluginPath at the .hpi your build produced, e.g. target/<name>.hpi"},
+	{"jenkins.war", checkWar, "only needed when the wrapper starts Jenkins itself"},
+	{"controller", checkController, "check -jenkinsURL, the network path and any proxy settings"},
+	{"credentials", checkCredentials, "create an API token under <jenkins>/me/configure and set -jenkinsUser and -jenkinsToken"},
+}
+
+// checkCLIJar accepts an unset -jenkinsCLIPath, the jar then comes from
+// the controller.
+func checkCLIJar() (string, error) {
+	if jenkinsCLIPath == "" {
+		return "downloaded from the controller when needed", nil
+	}
+	return checkFile(jenkinsCLIPath, "-jenkinsCLIPath")
+}
+
+func checkJava() (string, error) {
+	path, err := exec.LookPath("java")
+	if err != nil {
+		return "", errors.New("java not found on the PATH")
+	}
+	if err := checkLaunch("java"); err != nil {
+		return path, nil
+	}
+	out, err := exec.Command(path, "-version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s -version failed: %v", path, err)
+	}
+	m := javaVersionPattern.FindStringSubmatch(string(out))
+	if m == nil {
+		return "", fmt.Errorf("cannot tell the version of %s", path)
+	}
+	major, _ := strconv.Atoi(m[1])
+	if major == 1 { // 1.8 and older
+		major, _ = strconv.Atoi(m[2])
+	}
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if major < minJavaVersion {
+		return "", fmt.Errorf("%s is Java %d, Jenkins needs %d or newer", version, major, minJavaVersion)
+	}
+	return version, nil
+}
+
+func checkFile(path, setting string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%s is not set", setting)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", setting, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s %s is a directory", setting, path)
+	}
+	return path, nil
+}
+
+// checkWar only checks a configured -jenkinsWarPath, on the host Jenkins is
+// started on: without one the wrapper never starts Jenkins itself.
+func checkWar() (string, error) {
+	switch {
+	case jenkinsWarPath == "":
+		return "not set, Jenkins is started by something else", nil
+	case *remoteHost == "":
+		return checkFile(jenkinsWarPath, "-jenkinsWarPath")
+	}
+	ok, err := target.exists(jenkinsWarPath)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("-jenkinsWarPath on %s: %v", *remoteHost, err)
+	case !ok:
+		return "", fmt.Errorf("-jenkinsWarPath %s does not exist on %s", jenkinsWarPath, *remoteHost)
+	}
+	return jenkinsWarPath + " on " + *remoteHost, nil
+}
+
+func checkPluginFile() (string, error) {
+	if _, err := checkFile(pluginPath, "-pluginPath"); err != nil {
+		return "", err
+	}
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return "", err
+	}
+	if pluginName != "" && manifest.ShortName != pluginName {
+		return "", fmt.Errorf("%s is plugin %s, not -pluginName %s", pluginPath, manifest.ShortName, pluginName)
+	}
+	if core := controllerVersion(); core != "" && manifest.CoreVersion != "" && compareVersions(core, manifest.CoreVersion) < 0 {
+		return "", fmt.Errorf("%s %s needs Jenkins %s, the controller runs %s", manifest.ShortName, manifest.Version, manifest.CoreVersion, core)
+	}
+	return fmt.Sprintf("%s %s", manifest.ShortName, manifest.Version), nil
+}
+
+func checkController() (string, error) {
+	if err := ensureJenkinsURL(); err != nil {
+		return "", err
+	}
+	resp, err := pollClient.Get(jenkinsURL + "/login")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	version := resp.Header.Get("X-Jenkins")
+	if version == "" {
+		return "", fmt.Errorf("%s answered %s but is not Jenkins", jenkinsURL, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", jenkinsURL, resp.Status)
+	}
+	return fmt.Sprintf("Jenkins %s at %s", version, jenkinsURL), nil
+}
+
+func checkCredentials() (string, error) {
+	if jenkinsUser == "" || jenkinsToken == "" {
+		return "", errors.New("-jenkinsUser and -jenkinsToken are required")
+	}
+	if jenkinsURL == "" {
+		return "", errors.New("no controller to check them against")
+	}
+	name, err := whoAmI()
+	if err != nil {
+		return "", err
+	}
+	return "authenticated as " + name, nil
+}
+
+// doctorCommand runs every diagnosis and reports each with a hint on how to
+// fix it, failing when any check failed.
+func doctorCommand(args []string) error {
+	if len(args) > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))}
+	}
+	failed := 0
+	for _, check := range doctorChecks {
+		detail, err := check.run()
+		if err != nil {
+			failed++
+			notify("❌", "%s: %v\n   %s", check.name, err, check.hint)
+			continue
+		}
+		notify("✅", "%s: %s", check.name, detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(doctorChecks))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var dryRun = flag.Bool("dry-run", false, "Print every request and command that would change Jenkins instead of running it; reads still go through")
+
+// dryRunning reports the action and returns true when it must be skipped
+// because of -dry-run.
+func dryRunning(format string, args ...any) bool {
+	if !*dryRun {
+		return false
+	}
+	notify("📝", "Would "+format, args...)
+	return true
+}
+
+// dryRunTransport answers every request but GET and HEAD with an empty 200
+// instead of sending it. It sits below read-only checks and tracing.
+type dryRunTransport struct {
+	next http.RoundTripper
+}
+
+func (t dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || !dryRunning("%s %s", req.Method, req.URL.Redacted()) {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// dryRunExecutor lets reads and diagnostics through to the wrapped executor
+// and only reports what it would start or write.
+type dryRunExecutor struct {
+	executor
+}
+
+func (dryRunExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	dryRunning("start %s", strings.Join(append(env, args...), " "))
+	return newJenkinsProcess(0), nil
+}
+
+func (dryRunExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	dryRunning("write %s (%d bytes)", path, len(data))
+	return nil
+}
+
+func (dryRunExecutor) mkdir(path string) error {
+	dryRunning("create %s", path)
+	return nil
+}
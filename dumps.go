@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jenkinsPID returns the process ID of the Jenkins JVM: the one this run
+// launched, or the first JVM jcmd lists as running jenkins.war.
+func jenkinsPID() (int, error) {
+	if launched != nil {
+		return launched.pid, nil
+	}
+	out, err := target.output([]string{"jcmd", "-l"})
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		pid, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if strings.Contains(command, "jenkins.war") || strings.Contains(command, "winstone") {
+			return strconv.Atoi(pid)
+		}
+	}
+	return 0, fmt.Errorf("no Jenkins JVM in jcmd -l output")
+}
+
+// jvmDumps captures a thread dump and a heap histogram of a hanging
+// controller for the support bundle. jcmd runs where Jenkins runs, through
+// the execution backend; when that is not possible the thread dump comes
+// from the /threadDump page, which needs Jenkins to still serve requests.
+func jvmDumps() (threads, histogram []byte) {
+	pid, err := jenkinsPID()
+	if err == nil {
+		threads, err = target.output([]string{"jcmd", strconv.Itoa(pid), "Thread.print", "-l"})
+	}
+	if err == nil {
+		if histogram, err = target.output([]string{"jcmd", strconv.Itoa(pid), "GC.class_histogram"}); err != nil {
+			histogram = []byte(fmt.Sprintf("could not capture heap histogram: %v", err))
+		}
+		return threads, histogram
+	}
+
+	histogram = []byte(fmt.Sprintf("could not capture heap histogram: %v", err))
+	threads = threadDumpPage(err)
+	return threads, histogram
+}
+
+func threadDumpPage(jcmdErr error) []byte {
+	req, err := newJenkinsRequest("GET", "/threadDump", nil)
+	if err != nil {
+		return []byte(err.Error())
+	}
+	resp, err := pollClient.Do(req)
+	if err != nil {
+		return []byte(fmt.Sprintf("jcmd failed (%v) and /threadDump is unreachable: %v", jcmdErr, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return []byte(fmt.Sprintf("jcmd failed (%v) and /threadDump answered %s", jcmdErr, resp.Status))
+	}
+	body, err := io.ReadAll(limitBody(resp))
+	if err != nil {
+		return []byte(fmt.Sprintf("could not read /threadDump: %v", err))
+	}
+	return body
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// workflowRun is the class of Pipeline builds; other builds on one-off
+// executors, such as matrix parents, do not resume.
+const workflowRun = "org.jenkinsci.plugins.workflow.job.WorkflowRun"
+
+// runningBuild is a Pipeline build that was running before a restart.
+type runningBuild struct {
+	Name string `json:"fullDisplayName"`
+	URL  string `json:"url"`
+}
+
+// pipelinesBefore holds the Pipeline builds running before the pipeline
+// restarted Jenkins, nil when they were not recorded.
+var pipelinesBefore []runningBuild
+
+// runningPipelines lists the running Pipeline builds. Their flyweight
+// executors sit on the built-in node, as one-off executors.
+func runningPipelines() ([]runningBuild, error) {
+	var computers struct {
+		Computer []struct {
+			OneOffExecutors []struct {
+				CurrentExecutable *struct {
+					Class string `json:"_class"`
+					runningBuild
+				} `json:"currentExecutable"`
+			} `json:"oneOffExecutors"`
+		} `json:"computer"`
+	}
+	err := getJSON("/computer/api/json?depth=2&tree=computer[oneOffExecutors[currentExecutable[fullDisplayName,url]]]", &computers)
+	if err != nil {
+		return nil, err
+	}
+	builds := []runningBuild{}
+	for _, c := range computers.Computer {
+		for _, e := range c.OneOffExecutors {
+			if b := e.CurrentExecutable; b != nil && b.Class == workflowRun {
+				builds = append(builds, b.runningBuild)
+			}
+		}
+	}
+	return builds, nil
+}
+
+// snapshotPipelines records the Pipeline builds running before the restart.
+func snapshotPipelines() {
+	var err error
+	if pipelinesBefore, err = runningPipelines(); err != nil {
+		notify("⚠️", "Could not list running Pipeline builds: %v", err)
+	}
+}
+
+// controllerPath turns an absolute URL from the API into a path below
+// jenkinsURL; the root URL configured in Jenkins may differ from it.
+func controllerPath(abs string) string {
+	u, err := url.Parse(abs)
+	if err != nil {
+		return abs
+	}
+	base, _ := url.Parse(jenkinsURL)
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/")), "/")
+}
+
+// checkPipelineDurability reports the Pipeline builds that were running
+// before the restart and did not survive it: gone, or ended without success
+// since. Builds lost like this fail silently, long after the update looked
+// fine. A build that is still running or ended well has resumed.
+func checkPipelineDurability() error {
+	if pipelinesBefore == nil {
+		notify("⚠️", "Running Pipeline builds were not recorded before the restart, cannot check they resumed")
+		return nil
+	}
+	for _, b := range pipelinesBefore {
+		var after buildStatus
+		err := getJSON(controllerPath(b.URL)+"api/json?tree=building,result", &after)
+		var status *httpStatusError
+		switch {
+		case errors.As(err, &status) && status.statusCode == 404:
+			report.LostPipelines = append(report.LostPipelines, b.Name+" (gone)")
+		case err != nil:
+			return err
+		case after.Building, after.Result == "SUCCESS", after.Result == "UNSTABLE":
+			continue
+		default:
+			report.LostPipelines = append(report.LostPipelines, fmt.Sprintf("%s (%s)", b.Name, after.Result))
+		}
+	}
+	for _, lost := range report.LostPipelines {
+		notify("⚠️", "Pipeline build did not survive the restart: %s", lost)
+	}
+	if len(report.LostPipelines) == 0 {
+		notify("✅", "All %d running Pipeline builds resumed", len(pipelinesBefore))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// restartRequired reports whether Jenkins has changes waiting for a restart.
+func restartRequired() (bool, error) {
+	var uc struct {
+		RestartRequiredForCompletion bool `json:"restartRequiredForCompletion"`
+	}
+	err := getJSON("/updateCenter/api/json?tree=restartRequiredForCompletion", &uc)
+	return uc.RestartRequiredForCompletion, err
+}
+
+// restartModes are the steps of each -restart of ensure-plugin and install
+// -plugins-file; none leaves the restart pending.
+var restartModes = map[string][]string{
+	"safe": {"safeRestart", "sleep:shutdown", "wait", "durability"},
+	"now":  restartPipeline,
+	"none": nil,
+}
+
+// enablePlugin enables an installed plugin, which loads on the next restart.
+func enablePlugin(name string) error {
+	req, err := newActionRequest(fmt.Sprintf("/pluginManager/plugin/%s/makeEnabled", name))
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newHTTPStatusError("failed to enable "+name, resp)
+	}
+	notify("✅", "Enabled %s", name)
+	return nil
+}
+
+// ensurePluginCommand makes exactly the given plugin version active and is
+// safe to call repeatedly: nothing happens when it already is, otherwise
+// that release is installed (upgrading or downgrading) and Jenkins restarts
+// only when it has to. The last line says "ok" or "changed" for config
+// management tools, and -output cm reports the install as its action.
+func ensurePluginCommand(args []string) error {
+	fs := flag.NewFlagSet("ensure-plugin", flag.ContinueOnError)
+	name := fs.String("name", "", "Plugin short name, e.g. git")
+	version := fs.String("version", "", "Exact version that must be active, e.g. 5.2.1")
+	restart := fs.String("restart", "safe", "How to restart when required: safe (after running builds), now, or none (leave it pending)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *version == "" {
+		return usageError{errors.New("usage: ensure-plugin -name <plugin> -version <version> [-restart safe|now|none]")}
+	}
+	restartSteps, ok := restartModes[*restart]
+	if !ok {
+		return usageError{fmt.Errorf("unknown -restart %q, use safe, now or none", *restart)}
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	current, err := findPlugin(*name)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Version == *version && current.state() == pluginActive {
+		printOutput(fmt.Sprintf("ok: %s %s is active", *name, *version))
+		return nil
+	}
+
+	// The right version may only be disabled or waiting for a restart
+	replace := current == nil || current.Version != *version
+	enable := !replace && !current.Enabled
+	if *dryRun {
+		from := "not installed"
+		if current != nil {
+			from = fmt.Sprintf("%s %s", current.Version, current.state())
+		}
+		printOutput(fmt.Sprintf("would change: %s %s -> %s active", *name, from, *version))
+		return nil
+	}
+	if enable {
+		if err := report.step("enable", func() error { return enablePlugin(*name) }); err != nil {
+			return err
+		}
+	}
+	if replace {
+		uc, err := fetchUpdateCenter()
+		if err != nil {
+			return err
+		}
+		if renamed, err := uc.resolvePluginName(*name); err == nil && renamed != *name {
+			return usageError{fmt.Errorf("%s was renamed to %s, version %s is a release of the old plugin; ensure a release of %s instead", *name, renamed, *version, renamed)}
+		}
+		path, err := cachedPlugin(*name, *version, "")
+		if err != nil {
+			return err
+		}
+		pluginName, pluginPath = *name, path
+		if err := report.step("install", installPlugin); err != nil {
+			return err
+		}
+	}
+	pending, err := restartRequired()
+	if err != nil {
+		return err
+	}
+	pending = pending || (replace && current != nil) || enable // A loaded plugin is only replaced by a restart, a disabled one only loaded by one
+
+	if pending {
+		if restartSteps == nil {
+			printOutput(fmt.Sprintf("changed: %s %s active after the next restart", *name, *version))
+			return nil
+		}
+		if err := runPipeline(restartSteps); err != nil {
+			return err
+		}
+	}
+
+	after, err := findPlugin(*name)
+	if err != nil {
+		return err
+	}
+	if after == nil || after.Version != *version || after.state() != pluginActive {
+		state := "not installed"
+		if after != nil {
+			state = fmt.Sprintf("%s %s", after.Version, after.state())
+		}
+		return fmt.Errorf("%s is %s after installing %s", *name, state, *version)
+	}
+	from := "not installed"
+	if current != nil {
+		from = current.Version
+	}
+	printOutput(fmt.Sprintf("changed: %s %s -> %s", *name, from, *version))
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadEnv reads KEY=VALUE pairs from a .env file. Blank lines and lines
+// starting with # are ignored, values may be quoted.
+func loadEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := parseEnvLine(line)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseEnvLine splits a trimmed, non-comment line into key and unquoted value.
+func parseEnvLine(line string) (string, string, bool) {
+	key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+	if !ok {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return strings.TrimSpace(key), value, true
+}
+
+// saveEnv writes values to a .env file atomically, keeping a backup of the
+// previous version. Comments, blank lines, lines it cannot parse and the
+// order of existing keys are preserved; keys missing from values are removed
+// and new keys are appended in sorted order.
+func saveEnv(path string, values map[string]string) error {
+	var lines []string
+	written := map[string]bool{}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			if len(existing) > 0 {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		key, current, ok := parseEnvLine(trimmed)
+		if !ok {
+			lines = append(lines, line) // Not ours to fix, keep it as written
+			continue
+		}
+		value, keep := values[key]
+		if !keep || written[key] {
+			continue
+		}
+		written[key] = true
+		if value == current {
+			lines = append(lines, line) // Unchanged, keep it exactly as written
+			continue
+		}
+		prefix := ""
+		if strings.HasPrefix(trimmed, "export ") {
+			prefix = "export "
+		}
+		lines = append(lines, fmt.Sprintf("%s%s=%s", prefix, key, quoteEnvValue(value)))
+	}
+
+	var added []string
+	for key := range values {
+		if !written[key] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, quoteEnvValue(values[key])))
+	}
+
+	return writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// quoteEnvValue quotes values that would not survive loadEnv unquoted.
+func quoteEnvValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"'#\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// failureCategory classifies why a run failed, which decides whether running
+// the pipeline again can help.
+type failureCategory string
+
+const (
+	categoryAuth    failureCategory = "auth"    // Credentials rejected
+	categoryNetwork failureCategory = "network" // Jenkins unreachable or temporarily unavailable
+	categoryTimeout failureCategory = "timeout" // Jenkins did not come back in time
+	categoryCrash   failureCategory = "crash"   // Jenkins process died during startup
+	categoryBusy    failureCategory = "busy"    // Restart deferred because Jenkins is busy or outside a maintenance window
+	categoryJenkins failureCategory = "jenkins" // Jenkins refused the operation
+	categoryInstall failureCategory = "install" // The plugin could not be installed
+	categoryUnknown failureCategory = "unknown"
+)
+
+// retryableCategories lists the failures that are worth a full retry. Busy
+// is not: a retry minutes later would restart in the very period the check
+// refused.
+var retryableCategories = map[failureCategory]bool{
+	categoryNetwork: true,
+	categoryTimeout: true,
+}
+
+var errRestartTimeout = errors.New("jenkins did not restart in time")
+
+var errInstallFailed = errors.New("plugin installation failed")
+
+// httpStatusError is returned when Jenkins answers with an unexpected status.
+type httpStatusError struct {
+	op         string
+	statusCode int
+	status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.op, e.status)
+}
+
+func newHTTPStatusError(op string, resp *http.Response) error {
+	return &httpStatusError{op: op, statusCode: resp.StatusCode, status: resp.Status}
+}
+
+// processCrashError is returned when the Jenkins process exits while we wait
+// for it to come online.
+type processCrashError struct {
+	msg string
+}
+
+func (e *processCrashError) Error() string {
+	return e.msg
+}
+
+func categorize(err error) failureCategory {
+	var statusErr *httpStatusError
+	var crashErr *processCrashError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.statusCode == http.StatusUnauthorized || statusErr.statusCode == http.StatusForbidden:
+			return categoryAuth
+		case statusErr.statusCode == http.StatusBadGateway || statusErr.statusCode == http.StatusServiceUnavailable || statusErr.statusCode == http.StatusGatewayTimeout:
+			return categoryNetwork
+		}
+		return categoryJenkins
+	case errors.Is(err, errRestartTimeout):
+		return categoryTimeout
+	case errors.Is(err, errInstallFailed):
+		return categoryInstall
+	case errors.Is(err, errBusyPeriod), errors.Is(err, errOutsideWindow):
+		return categoryBusy
+	case errors.As(err, &crashErr):
+		return categoryCrash
+	case errors.As(err, &opErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return categoryNetwork
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return categoryNetwork
+	}
+	return categoryUnknown
+}
+
+func isRetryable(err error) bool {
+	return retryableCategories[categorize(err)]
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	remoteHost    = flag.String("remote-host", "", "Run Jenkins process and JENKINS_HOME operations on this host")
+	remoteUser    = flag.String("remote-user", "", "SSH user for -remote-host (default from the SSH configuration)")
+	remoteBackend = flag.String("remote-backend", "ssh", "How to reach -remote-host: ssh or winrm")
+)
+
+// executor performs process and file operations on the machine Jenkins runs
+// on, which is not necessarily the one running the wrapper.
+type executor interface {
+	// start launches Jenkins in the background with its output in logPath.
+	start(args, env []string, logPath string) (*jenkinsProcess, error)
+	readFile(path string) ([]byte, error)
+	// openFile streams a file, for ones too large to read whole, like logs.
+	openFile(path string) (io.ReadCloser, error)
+	writeFile(path string, data []byte, mode os.FileMode) error
+	exists(path string) (bool, error)
+	// mkdir creates a directory and any missing parents.
+	mkdir(path string) error
+	// output runs a command to completion and returns what it printed.
+	output(args []string) ([]byte, error)
+}
+
+// target is where Jenkins lives, set up by setupExecutor.
+var target executor = localExecutor{}
+
+func setupExecutor() error {
+	if *remoteHost != "" {
+		switch *remoteBackend {
+		case "ssh":
+			target = &sshExecutor{host: *remoteHost, user: *remoteUser}
+		case "winrm":
+			target = &winrmExecutor{host: *remoteHost}
+		default:
+			return fmt.Errorf("unknown -remote-backend %q, use ssh or winrm", *remoteBackend)
+		}
+	}
+	if *dryRun {
+		target = dryRunExecutor{target}
+	}
+	if *readOnly {
+		target = readOnlyExecutor{target}
+	}
+	return nil
+}
+
+type localExecutor struct{}
+
+func (localExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Jenkins log: %v", err)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("failed to start Jenkins: %v", err)
+	}
+
+	p := newJenkinsProcess(cmd.Process.Pid)
+	go func() {
+		p.err = cmd.Wait()
+		logFile.Close()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+func (localExecutor) readFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (localExecutor) openFile(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// writeFile gives the file its mode before any data is in it, and replaces
+// an existing file rather than rewriting it, which would keep its mode.
+func (localExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (localExecutor) exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	}
+	return false, err
+}
+
+func (localExecutor) mkdir(path string) error {
+	return os.MkdirAll(path, 0o700)
+}
+
+func (localExecutor) output(args []string) ([]byte, error) {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// sshExecutor runs everything through the ssh client, so the usual
+// ~/.ssh/config, agent and known_hosts handling applies. Commands run in a
+// POSIX shell on the remote host.
+type sshExecutor struct {
+	host string
+	user string
+}
+
+// remotePollInterval is how often the remote Jenkins process is checked for liveness.
+const remotePollInterval = 5 * time.Second
+
+func (s *sshExecutor) command(script string) *exec.Cmd {
+	dest := s.host
+	if s.user != "" {
+		dest = s.user + "@" + s.host
+	}
+	return exec.Command("ssh", "-o", "BatchMode=yes", dest, script)
+}
+
+// run executes a shell script remotely, returning its output. Exit status 255
+// is ssh's own failure and reported as such.
+func (s *sshExecutor) run(script string, stdin []byte) ([]byte, error) {
+	cmd := s.command(script)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("ssh %s: %v: %s", s.host, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (s *sshExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	// Through env, since a quoted KEY=value word is not an assignment
+	script := fmt.Sprintf("env %s nohup %s > %s 2>&1 < /dev/null & echo $!",
+		shellJoin(env), shellJoin(args), shellQuote(logPath))
+	out, err := s.run(script, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Jenkins on %s: %v", s.host, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Jenkins on %s: unexpected output %q", s.host, out)
+	}
+
+	p := newJenkinsProcess(pid)
+	go func() {
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(remotePollInterval):
+			}
+			cmd := s.command(fmt.Sprintf("kill -0 %d", pid))
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+				p.err = fmt.Errorf("process %d on %s is gone", pid, s.host)
+				close(p.exited)
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (s *sshExecutor) readFile(path string) ([]byte, error) {
+	return s.run("cat "+shellQuote(path), nil)
+}
+
+func (s *sshExecutor) openFile(path string) (io.ReadCloser, error) {
+	cmd := s.command("cat " + shellQuote(path))
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ssh %s: %v", s.host, err)
+	}
+	return &commandOutput{ReadCloser: out, cmd: cmd, stderr: &stderr, host: s.host}, nil
+}
+
+// commandOutput is the output of a running ssh command; closing it waits
+// for the command and reports its failure.
+type commandOutput struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	host   string
+}
+
+func (c *commandOutput) Close() error {
+	c.ReadCloser.Close() // Stops a cat the reader is no longer interested in
+	if err := c.cmd.Wait(); err != nil {
+		return fmt.Errorf("ssh %s: %v: %s", c.host, err, strings.TrimSpace(c.stderr.String()))
+	}
+	return nil
+}
+
+// writeFile writes to a private temporary file next to path and renames it
+// over path, so neither the data nor an existing file's mode is ever exposed.
+func (s *sshExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	script := `umask 077 && tmp=$(mktemp %[1]s.XXXXXX) && { chmod %[2]o "$tmp" && cat > "$tmp" && mv -f "$tmp" %[1]s || { rm -f "$tmp"; exit 1; }; }`
+	_, err := s.run(fmt.Sprintf(script, shellQuote(path), mode), data)
+	return err
+}
+
+func (s *sshExecutor) mkdir(path string) error {
+	_, err := s.run("umask 077 && mkdir -p "+shellQuote(path), nil)
+	return err
+}
+
+func (s *sshExecutor) output(args []string) ([]byte, error) {
+	return s.run(shellJoin(args), nil)
+}
+
+func (s *sshExecutor) exists(path string) (bool, error) {
+	err := s.command("test -e " + shellQuote(path)).Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	}
+	return false, fmt.Errorf("ssh %s: %v", s.host, err)
+}
+
+// shellQuote quotes a word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var remoteService = flag.String("remote-service", "", "Windows service to start instead of launching the WAR (winrm backend)")
+
+// winrmExecutor drives a Windows host through PowerShell remoting
+// (Invoke-Command over WinRM) as the current user, so nothing has to be
+// installed on the controller. Paths are Windows paths on the remote host.
+type winrmExecutor struct {
+	host string
+}
+
+// powershell returns the local PowerShell binary: Windows PowerShell on
+// Windows, PowerShell 7 (pwsh) elsewhere.
+func powershell() string {
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "pwsh"
+}
+
+// run executes a PowerShell script remotely. A non-nil stdin is read by the
+// local PowerShell, so it never shows on a command line, and handed to the
+// script as $data.
+func (w *winrmExecutor) run(script string, stdin []byte) (string, error) {
+	remote := fmt.Sprintf("Invoke-Command -ComputerName %s -ErrorAction Stop -ScriptBlock { %s }", psQuote(w.host), script)
+	if stdin != nil {
+		remote = fmt.Sprintf("$data = [Console]::In.ReadToEnd(); Invoke-Command -ComputerName %s -ErrorAction Stop -ArgumentList $data -ScriptBlock { param($data) %s }", psQuote(w.host), script)
+	}
+	cmd := exec.Command(powershell(), "-NoProfile", "-NonInteractive", "-Command", remote)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("winrm %s: %v: %s", w.host, err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// start starts the configured Windows service, or launches the WAR through
+// Win32_Process so it is not tied to (and killed with) the remoting session.
+func (w *winrmExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	var script string
+	if *remoteService != "" {
+		script = fmt.Sprintf("Start-Service -Name %[1]s; (Get-CimInstance Win32_Service -Filter \"Name='%[2]s'\").ProcessId",
+			psQuote(*remoteService), strings.ReplaceAll(*remoteService, "'", "''"))
+	} else {
+		var cmdLine strings.Builder
+		cmdLine.WriteString("cmd /c ")
+		for _, e := range env {
+			fmt.Fprintf(&cmdLine, "set \"%s\" && ", e)
+		}
+		cmdLine.WriteString(windowsJoin(args))
+		fmt.Fprintf(&cmdLine, " > %s 2>&1", windowsQuote(logPath))
+		script = fmt.Sprintf("(Invoke-CimMethod -ClassName Win32_Process -MethodName Create -Arguments @{CommandLine=%s}).ProcessId", psQuote(cmdLine.String()))
+	}
+
+	out, err := w.run(script, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Jenkins on %s: %v", w.host, err)
+	}
+	pid, err := strconv.Atoi(out)
+	if err != nil || pid == 0 {
+		return nil, fmt.Errorf("failed to start Jenkins on %s: unexpected output %q", w.host, out)
+	}
+
+	p := newJenkinsProcess(pid)
+	go func() {
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(remotePollInterval):
+			}
+			out, err := w.run(fmt.Sprintf("[bool](Get-Process -Id %d -ErrorAction SilentlyContinue)", pid), nil)
+			if err == nil && out == "False" {
+				p.err = fmt.Errorf("process %d on %s is gone", pid, w.host)
+				close(p.exited)
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (w *winrmExecutor) readFile(path string) ([]byte, error) {
+	out, err := w.run(fmt.Sprintf("[Convert]::ToBase64String([IO.File]::ReadAllBytes(%s))", psQuote(path)), nil)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out)
+}
+
+// openFile reads the file whole: remoting returns output only once the
+// command finished.
+func (w *winrmExecutor) openFile(path string) (io.ReadCloser, error) {
+	data, err := w.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// writeFile ignores mode: access on Windows is governed by the ACL inherited
+// from the target directory.
+func (w *winrmExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	_, err := w.run(fmt.Sprintf("[IO.File]::WriteAllBytes(%s, [Convert]::FromBase64String($data))", psQuote(path)),
+		[]byte(base64.StdEncoding.EncodeToString(data)))
+	return err
+}
+
+func (w *winrmExecutor) mkdir(path string) error {
+	_, err := w.run("New-Item -ItemType Directory -Force -Path "+psQuote(path)+" | Out-Null", nil)
+	return err
+}
+
+func (w *winrmExecutor) output(args []string) ([]byte, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = psQuote(arg)
+	}
+	out, err := w.run("& "+strings.Join(quoted, " "), nil)
+	return []byte(out), err
+}
+
+func (w *winrmExecutor) exists(path string) (bool, error) {
+	out, err := w.run("Test-Path -LiteralPath "+psQuote(path), nil)
+	if err != nil {
+		return false, err
+	}
+	return out == "True", nil
+}
+
+// psQuote quotes a string literal for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// windowsQuote quotes an argument for a Windows command line.
+func windowsQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func windowsJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = windowsQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
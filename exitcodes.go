@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+)
+
+// Exit codes, so scripts can tell failures apart without parsing output.
+const (
+	exitOK             = 0
+	exitFailure        = 1 // Any failure not covered below
+	exitUsage          = 2 // Bad command line or configuration, as flag uses
+	exitAuth           = 3 // Jenkins rejected the credentials
+	exitUnreachable    = 4 // Jenkins could not be reached
+	exitRestartTimeout = 5 // Jenkins did not come back in time
+	exitCrash          = 6 // The started Jenkins process died
+	exitRefused        = 7 // Jenkins refused an operation
+	exitBusy           = 8 // Restart deferred by the busy-hours check or the maintenance calendar
+	exitInstall        = 9 // The plugin could not be installed
+	exitInterrupted    = 130
+)
+
+var categoryExitCodes = map[failureCategory]int{
+	categoryAuth:    exitAuth,
+	categoryNetwork: exitUnreachable,
+	categoryTimeout: exitRestartTimeout,
+	categoryCrash:   exitCrash,
+	categoryJenkins: exitRefused,
+	categoryBusy:    exitBusy,
+	categoryInstall: exitInstall,
+}
+
+// usageError marks errors in how the wrapper was invoked or configured.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error { return e.error }
+
+// exitCode maps the error a command ended with to the process exit code.
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	}
+	if code, ok := categoryExitCodes[categorize(err)]; ok {
+		return code
+	}
+	return exitFailure
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var extensionsDir = flag.String("extensions-dir", defaultExtensionsDir(), "Directory of extension executables (jw-step-*, jw-fetch-*, jw-notify-*, jw-secret-*)")
+
+func defaultExtensionsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jenkins-wrapper", "extensions")
+}
+
+// Extensions are executables in -extensions-dir named after the extension
+// point they plug into:
+//
+//	jw-step-NAME      pipeline step NAME, succeeds when it exits 0
+//	jw-fetch-SCHEME   -plugin SCHEME:REF fetcher, gets REF as argument and prints the downloaded path
+//	jw-notify-NAME    receives every status event as a JSON line on stdin
+//	jw-secret-NAME    resolves secret://NAME/REF setting values, gets REF and prints the secret
+//
+// All of them see the Jenkins connection and plugin details in their
+// environment, see extensionEnv.
+const (
+	stepPrefix     = "jw-step-"
+	fetchPrefix    = "jw-fetch-"
+	notifyPrefix   = "jw-notify-"
+	secretPrefix   = "jw-secret-"
+	secretValueURL = "secret://"
+)
+
+// secretBackends maps backend names to their jw-secret-* executables.
+var secretBackends = map[string]string{}
+
+// loadExtensions registers every extension found in -extensions-dir. Built-in
+// steps and fetchers take precedence over extensions of the same name.
+func loadExtensions() {
+	if *extensionsDir == "" {
+		return
+	}
+	entries, err := os.ReadDir(*extensionsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			notify("⚠️", "Cannot read extensions: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !isExecutable(info) {
+			continue
+		}
+		path := filepath.Join(*extensionsDir, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if step, ok := strings.CutPrefix(name, stepPrefix); ok {
+			if _, builtin := stepLibrary[step]; !builtin {
+				stepLibrary[step] = pipelineStep{"🧩", "", extensionStep(path)}
+			}
+		} else if scheme, ok := strings.CutPrefix(name, fetchPrefix); ok {
+			if _, builtin := pluginFetchers[scheme]; !builtin {
+				pluginFetchers[scheme] = extensionFetcher(path)
+			}
+		} else if _, ok := strings.CutPrefix(name, notifyPrefix); ok {
+			if s, err := newExtensionSink(path); err != nil {
+				notify("⚠️", "Cannot start notifier %s: %v", entry.Name(), err)
+			} else {
+				sinksMu.Lock()
+				sinks = append(sinks, s)
+				sinksMu.Unlock()
+			}
+		} else if backend, ok := strings.CutPrefix(name, secretPrefix); ok {
+			secretBackends[backend] = path
+		}
+	}
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return info.Mode()&0o111 != 0
+}
+
+// extensionEnv is the environment every extension runs with.
+func extensionEnv() []string {
+	env := append(cliEnv(),
+		"JENKINS_URL="+jenkinsURL,
+		"JENKINS_HOME="+jenkinsHome,
+		"PLUGIN_NAME="+pluginName,
+		"PLUGIN_PATH="+pluginPath,
+		"JENKINS_WRAPPER_CORRELATION_ID="+runCorrelationID(),
+	)
+	if ws != nil {
+		env = append(env, "WRAPPER_WORKSPACE="+ws.root)
+	}
+	return env
+}
+
+func runExtension(path string, args ...string) ([]byte, error) {
+	if err := checkLaunch(filepath.Base(path)); err != nil {
+		return nil, err
+	}
+	return execExtension(path, args...)
+}
+
+func execExtension(path string, args ...string) ([]byte, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Env = extensionEnv()
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("%s failed: %v", filepath.Base(path), err)
+	}
+	return out, nil
+}
+
+func extensionStep(path string) func() error {
+	return func() error {
+		if dryRunning("run %s", path) {
+			return nil
+		}
+		out, err := runExtension(path)
+		if len(out) > 0 {
+			printOutput(string(out))
+		}
+		return err
+	}
+}
+
+func extensionFetcher(path string) pluginFetcher {
+	return func(ref string) (string, error) {
+		out, err := runExtension(path, ref)
+		if err != nil {
+			return "", err
+		}
+		fetched := strings.TrimSpace(string(out))
+		if fetched == "" {
+			return "", fmt.Errorf("%s printed no plugin path", filepath.Base(path))
+		}
+		return fetched, nil
+	}
+}
+
+// resolveSecrets replaces secret://BACKEND/REF values of secret settings
+// with what the jw-secret-BACKEND extension prints for REF.
+func resolveSecrets() error {
+	for _, s := range settings {
+		ref, ok := strings.CutPrefix(*s.value, secretValueURL)
+		if !s.secret || !ok {
+			continue
+		}
+		backend, key, _ := strings.Cut(ref, "/")
+		path, found := secretBackends[backend]
+		if !found {
+			return fmt.Errorf("-%s refers to secret backend %q, but there is no %s%s extension", s.flag, backend, secretPrefix, backend)
+		}
+		// Credentials are needed to even read from Jenkins, so secret
+		// backends run in read-only mode too
+		out, err := execExtension(path, key)
+		if err != nil {
+			return fmt.Errorf("failed to resolve -%s: %v", s.flag, err)
+		}
+		*s.value = strings.TrimRight(string(out), "\r\n")
+	}
+	return nil
+}
+
+// extensionSink streams events to a notifier extension as JSON lines.
+type extensionSink struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	enc   *json.Encoder
+}
+
+func newExtensionSink(path string) (*extensionSink, error) {
+	if err := checkLaunch(filepath.Base(path)); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path)
+	cmd.Env = extensionEnv()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &extensionSink{cmd: cmd, stdin: stdin, enc: json.NewEncoder(stdin)}, nil
+}
+
+func (s *extensionSink) write(e event) {
+	// A notifier that went away must not break the run
+	s.enc.Encode(e)
+}
+
+func (s *extensionSink) close() error {
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
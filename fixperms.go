@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// privateHomeFiles hold the keys Jenkins encrypts credentials with and must
+// only be readable by its user.
+var privateHomeFiles = map[string]bool{
+	"secret.key":               true,
+	"secret.key.not-so-secret": true,
+	"identity.key.enc":         true,
+	"secrets":                  true, // And everything in it
+}
+
+// permFix is one change fix-perms makes or would make.
+type permFix struct {
+	path      string
+	uid, gid  int // -1 when the owner is right
+	mode      fs.FileMode
+	fromMode  fs.FileMode
+	fromOwner string
+	err       error // Why the file could not be checked, then nothing is changed
+}
+
+// wantedMode is the mode a file in JENKINS_HOME needs: its user must be able
+// to read and write it (and enter directories), and the key material must
+// be private.
+func wantedMode(rel string, info fs.FileInfo) fs.FileMode {
+	mode := info.Mode().Perm()
+	if info.IsDir() {
+		mode |= 0o700
+	} else {
+		mode |= 0o600
+	}
+	top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	if privateHomeFiles[top] {
+		mode &^= 0o077
+	}
+	return mode
+}
+
+// scanHomePerms walks JENKINS_HOME for files with the wrong owner or mode.
+// Symbolic links are not followed, so nothing outside the home is touched.
+// Files it cannot read are findings too, and the walk goes on past them.
+func scanHomePerms(home string, uid, gid int) ([]permFix, error) {
+	var fixes []permFix
+	err := filepath.WalkDir(home, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == home {
+				return err
+			}
+			fixes = append(fixes, permFix{path: path, err: err})
+			return nil // A directory that cannot be read is skipped
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			fixes = append(fixes, permFix{path: path, err: err})
+			return nil
+		}
+		rel, _ := filepath.Rel(home, path)
+		fix := permFix{path: path, uid: -1, gid: -1, fromMode: info.Mode().Perm(), mode: wantedMode(rel, info)}
+		if fileUID, fileGID, ok := fileOwner(info); ok && (fileUID != uid || fileGID != gid) {
+			fix.uid, fix.gid = uid, gid
+			fix.fromOwner = fmt.Sprintf("%d:%d", fileUID, fileGID)
+		}
+		if fix.uid != -1 || fix.mode != fix.fromMode {
+			fixes = append(fixes, fix)
+		}
+		return nil
+	})
+	return fixes, err
+}
+
+func (f permFix) String() string {
+	if f.err != nil {
+		return fmt.Sprintf("%s: cannot be checked: %v", f.path, f.err)
+	}
+	s := f.path + ":"
+	if f.uid != -1 {
+		s += fmt.Sprintf(" owner %s -> %d:%d", f.fromOwner, f.uid, f.gid)
+	}
+	if f.mode != f.fromMode {
+		s += fmt.Sprintf(" mode %04o -> %04o", f.fromMode, f.mode)
+	}
+	return s
+}
+
+// apply makes the change. The file is looked at again first, so one
+// replaced by a symbolic link since the scan is left alone rather than
+// followed. Owners go first, as a chown may clear bits.
+func (f permFix) apply() error {
+	if f.err != nil {
+		return f.err
+	}
+	info, err := os.Lstat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return errors.New("became a symbolic link, skipped")
+	}
+	if f.uid != -1 {
+		if err := os.Lchown(f.path, f.uid, f.gid); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(f.path, f.mode)
+}
+
+// homeUser picks the account that should own JENKINS_HOME: -user, else the
+// user running the wrapper, or jenkins when that is root.
+func homeUser(name string) (*user.User, error) {
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		if current.Uid != "0" {
+			return current, nil
+		}
+		name = "jenkins"
+	}
+	return user.Lookup(name)
+}
+
+// fixPermsCommand finds files in JENKINS_HOME that the Jenkins user cannot
+// read or write, or that expose key material, which typically happens after
+// restoring a backup as root or changing the service user. It prints what
+// is wrong as a diff and changes it with -fix.
+func fixPermsCommand(args []string) error {
+	flags := flag.NewFlagSet("fix-perms", flag.ContinueOnError)
+	owner := flags.String("user", "", "User Jenkins runs as (default: the current user, or jenkins when run as root)")
+	fix := flags.Bool("fix", false, "Change what is wrong instead of only listing it")
+	limit := flags.Int("limit", 50, "How many changes to list, 0 for all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case runtime.GOOS == "windows":
+		return errors.New("fix-perms needs Unix ownership and permissions, use icacls on Windows")
+	case *remoteHost != "":
+		return errors.New("fix-perms works on a local JENKINS_HOME, run it on the Jenkins host")
+	case jenkinsHome == "":
+		return usageError{errors.New("fix-perms needs -jenkinsHome")}
+	}
+
+	u, err := homeUser(*owner)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	fixes, err := scanHomePerms(jenkinsHome, uid, gid)
+	if err != nil {
+		return err
+	}
+	if len(fixes) == 0 {
+		notify("✅", "Everything in %s belongs to %s with the right permissions", jenkinsHome, u.Username)
+		return nil
+	}
+
+	for i, f := range fixes {
+		if *limit > 0 && i == *limit {
+			printOutput(fmt.Sprintf("... and %d more", len(fixes)-i))
+			break
+		}
+		printOutput(f.String())
+	}
+	if !*fix {
+		notify("⚠️", "%d files in %s need changes for %s, run with -fix to make them", len(fixes), jenkinsHome, u.Username)
+		return fmt.Errorf("%d files with the wrong owner or permissions", len(fixes))
+	}
+	if *readOnly {
+		return fmt.Errorf("%w: changing files in %s", errReadOnly, jenkinsHome)
+	}
+	if dryRunning("change %d files in %s", len(fixes), jenkinsHome) {
+		return nil
+	}
+
+	failed := 0
+	for _, f := range fixes {
+		if err := f.apply(); err != nil {
+			failed++
+			if failed <= 5 {
+				notify("⚠️", "%s: %v", f.path, err)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not change %d of %d files; changing owners needs root", failed, len(fixes))
+	}
+	notify("🎉", "Fixed %d files in %s", len(fixes), jenkinsHome)
+	return nil
+}
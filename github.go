@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const githubAPI = "https://api.github.com"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Body    string `json:"body"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"assets"`
+}
+
+func newGitHubRequest(url, accept string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if githubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+githubToken)
+	}
+	return req, nil
+}
+
+// fetchGitHubRelease downloads the .hpi asset of a release, given as
+// "owner/repo@tag" (or "owner/repo" for the latest release). The SHA-256 of
+// the asset must be listed in the release notes, as printed by sha256sum.
+func fetchGitHubRelease(ref string) (string, error) {
+	repo, tag, _ := strings.Cut(ref, "@")
+	if strings.Count(repo, "/") != 1 {
+		return "", fmt.Errorf("invalid GitHub plugin %q, expected owner/repo@tag", ref)
+	}
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", githubAPI, repo)
+	if tag != "" {
+		url = fmt.Sprintf("%s/repos/%s/releases/tags/%s", githubAPI, repo, tag)
+	}
+
+	req, err := newGitHubRequest(url, "application/vnd.github+json")
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError("failed to find release "+ref, resp)
+	}
+	var release githubRelease
+	if err := decodeJSON(resp, &release); err != nil {
+		return "", err
+	}
+
+	var assetName, assetURL string
+	for _, asset := range release.Assets {
+		if strings.HasSuffix(asset.Name, ".hpi") || strings.HasSuffix(asset.Name, ".jpi") {
+			if assetName != "" {
+				return "", fmt.Errorf("release %s of %s has more than one plugin asset", release.TagName, repo)
+			}
+			assetName, assetURL = asset.Name, asset.URL
+		}
+	}
+	if assetName == "" {
+		return "", fmt.Errorf("release %s of %s has no .hpi asset", release.TagName, repo)
+	}
+	want := releaseChecksum(release.Body, assetName)
+	if want == "" {
+		return "", fmt.Errorf("release notes of %s %s do not list a SHA-256 for %s", repo, release.TagName, assetName)
+	}
+
+	notify("⬇️", "Downloading %s from %s %s...", assetName, repo, release.TagName)
+	path := ws.path(downloadsDir, assetName)
+	got, err := downloadGitHubAsset(assetURL, path)
+	if err != nil {
+		return "", err
+	}
+	if got != want {
+		return "", fmt.Errorf("checksum mismatch for %s: release notes say %s, downloaded file is %s", assetName, want, got)
+	}
+	notify("✅", "Verified %s (sha256 %s)", assetName, got[:12])
+	return path, nil
+}
+
+// releaseChecksum finds "<sha256>  <name>" (sha256sum output) or
+// "<name>: <sha256>" in release notes.
+func releaseChecksum(notes, name string) string {
+	quoted := regexp.QuoteMeta(name)
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b([0-9a-f]{64})\b[ \t*]+` + quoted),
+		regexp.MustCompile(`(?i)` + quoted + `\W+(?:sha-?256\W+)?([0-9a-f]{64})\b`),
+	}
+	for _, re := range patterns {
+		if m := re.FindStringSubmatch(notes); m != nil {
+			return strings.ToLower(m[1])
+		}
+	}
+	return ""
+}
+
+// downloadGitHubAsset saves a release asset and returns its SHA-256.
+func downloadGitHubAsset(url, path string) (string, error) {
+	req, err := newGitHubRequest(url, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError("failed to download "+filepath.Base(path), resp)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), f.Close()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var healthAddr = flag.String("health-addr", "", "Serve /healthz, /readyz and Prometheus /metrics for the daemon at this address, e.g. :9102")
+
+// taskStats is what the daemon exposes about one scheduled task.
+type taskStats struct {
+	successes, failures int
+	lastRun             time.Time
+	lastDuration        time.Duration
+	lastOK              bool
+	running             bool
+}
+
+// daemonHealth tracks the scheduled tasks for the health endpoints.
+type daemonHealth struct {
+	mu      sync.Mutex
+	started time.Time
+	tasks   map[string]*taskStats
+}
+
+var health = &daemonHealth{started: time.Now(), tasks: map[string]*taskStats{}}
+
+func (h *daemonHealth) schedule(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tasks[name] = &taskStats{}
+}
+
+func (h *daemonHealth) begin(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tasks[name].running = true
+}
+
+func (h *daemonHealth) finish(name string, started time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.tasks[name]
+	t.running = false
+	t.lastRun = started
+	t.lastDuration = time.Since(started)
+	t.lastOK = err == nil
+	if err == nil {
+		t.successes++
+	} else {
+		t.failures++
+	}
+}
+
+// serveHealth starts the health endpoints in the background. Listening
+// happens up front so a taken address fails the daemon right away.
+func serveHealth(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", health.serveReady)
+	mux.HandleFunc("/metrics", health.serveMetrics)
+	notify("🩺", "Serving health endpoints at %s", ln.Addr())
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// serveReady answers 200 while the controller answers, so the daemon is
+// taken out of rotation when it cannot do its job.
+func (h *daemonHealth) serveReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", jenkinsURL+"/login", nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = pollClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("controller answered %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveMetrics writes the task counters in the Prometheus text format.
+func (h *daemonHealth) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP jenkins_wrapper_start_time_seconds When the daemon started.")
+	fmt.Fprintln(w, "# TYPE jenkins_wrapper_start_time_seconds gauge")
+	fmt.Fprintf(w, "jenkins_wrapper_start_time_seconds %d\n", h.started.Unix())
+
+	names := sortedKeys(h.tasks)
+	fmt.Fprintln(w, "# HELP jenkins_wrapper_task_runs_total Finished runs of each scheduled task.")
+	fmt.Fprintln(w, "# TYPE jenkins_wrapper_task_runs_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "jenkins_wrapper_task_runs_total{task=%q,result=\"success\"} %d\n", name, h.tasks[name].successes)
+		fmt.Fprintf(w, "jenkins_wrapper_task_runs_total{task=%q,result=\"failure\"} %d\n", name, h.tasks[name].failures)
+	}
+	gauges := []struct {
+		name, help string
+		value      func(*taskStats) float64
+	}{
+		{"jenkins_wrapper_task_running", "1 while the task runs.", func(t *taskStats) float64 { return boolGauge(t.running) }},
+		{"jenkins_wrapper_task_last_success", "1 if the last run of the task succeeded.", func(t *taskStats) float64 { return boolGauge(t.lastOK) }},
+		{"jenkins_wrapper_task_last_duration_seconds", "How long the last run of the task took.", func(t *taskStats) float64 { return t.lastDuration.Seconds() }},
+		{"jenkins_wrapper_task_last_run_timestamp_seconds", "When the last run of the task started, 0 before the first.", func(t *taskStats) float64 {
+			if t.lastRun.IsZero() {
+				return 0
+			}
+			return float64(t.lastRun.Unix())
+		}},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{task=%q} %g\n", g.name, name, g.value(h.tasks[name]))
+		}
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	runHistory string // Shared file of completed deployments
+	redeploy   = flag.Bool("redeploy", false, "Deploy even when the controller already runs the plugin file")
+)
+
+// historyLimit is how many deployments the run history keeps.
+const historyLimit = 500
+
+const (
+	historyLockWait  = 30 * time.Second // How long to wait for another run to finish updating the history
+	historyLockStale = 2 * time.Minute  // Age after which a lock is taken to be left over by a crashed run
+)
+
+// deployment records a completed run that installed a plugin, so later runs
+// from any machine sharing the history can tell they have nothing to do.
+type deployment struct {
+	CorrelationID string    `json:"correlationId"`
+	JenkinsURL    string    `json:"jenkinsUrl"`
+	Plugin        string    `json:"plugin"`
+	Version       string    `json:"version"`
+	SHA256        string    `json:"sha256"`
+	By            string    `json:"by,omitempty"`
+	Finished      time.Time `json:"finished"`
+}
+
+func loadDeployments() ([]deployment, error) {
+	data, err := os.ReadFile(runHistory)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []deployment
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", runHistory, err)
+	}
+	return history, nil
+}
+
+// lastDeployment is the latest recorded deployment of the plugin to the
+// controller, nil when there is none.
+func lastDeployment(history []deployment) *deployment {
+	for i := len(history) - 1; i >= 0; i-- {
+		d := &history[i]
+		if d.Plugin == pluginName && strings.TrimRight(d.JenkinsURL, "/") == strings.TrimRight(jenkinsURL, "/") {
+			return d
+		}
+	}
+	return nil
+}
+
+// alreadyDeployed tells whether the controller already runs the plugin file,
+// comparing the live state with the last recorded run. Without a record, a
+// release that is active in the same version counts as deployed by another
+// system; a SNAPSHOT cannot be told apart from a rebuild and is deployed.
+func alreadyDeployed() (string, bool, error) {
+	if *redeploy || runHistory == "" {
+		return "", false, nil
+	}
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return "", false, err
+	}
+	live, err := findPlugin(pluginName)
+	if err != nil || live == nil || live.Version != manifest.Version || live.state() != pluginActive {
+		return "", false, err
+	}
+	history, err := loadDeployments()
+	if err != nil {
+		return "", false, err
+	}
+	if last := lastDeployment(history); last != nil && last.Version == live.Version {
+		sum, err := fileSha256(pluginPath)
+		if err != nil || sum != last.SHA256 {
+			return "", false, err
+		}
+		by := ""
+		if last.By != "" {
+			by = " by " + last.By
+		}
+		return fmt.Sprintf("updated by run %s%s at %s", last.CorrelationID, by, last.Finished.Local().Format(time.DateTime)), true, nil
+	}
+	if strings.HasSuffix(manifest.Version, "-SNAPSHOT") {
+		return "", false, nil
+	}
+	return "updated outside this tool", true, nil
+}
+
+// recordDeployment adds the finished run to the history.
+func recordDeployment() error {
+	if runHistory == "" || *dryRun {
+		return nil
+	}
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSha256(pluginPath)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	history, err := loadDeployments()
+	if err != nil {
+		return err
+	}
+	history = append(history, deployment{
+		CorrelationID: runCorrelationID(),
+		JenkinsURL:    jenkinsURL,
+		Plugin:        pluginName,
+		Version:       manifest.Version,
+		SHA256:        sum,
+		By:            currentUser(),
+		Finished:      time.Now().UTC(),
+	})
+	if len(history) > historyLimit {
+		history = slices.Clone(history[len(history)-historyLimit:])
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(runHistory, append(data, '\n'), 0o644)
+}
+
+// lockHistory takes the lock file next to the history, so scheduled and
+// manual runs updating it at the same time do not lose each other's
+// entries. The lock is a file rather than an flock so it also works for a
+// history shared over a network file system.
+func lockHistory() (unlock func(), err error) {
+	lock := runHistory + ".lock"
+	deadline := time.Now().Add(historyLockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > historyLockStale {
+			notify("⚠️", "Taking over %s, left over since %s", lock, info.ModTime().Format(time.DateTime))
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another run; remove it if no run is updating the history", lock)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localPlugin describes a plugin archive in JENKINS_HOME/plugins. Jenkins
+// stores plugins as name.jpi, but older controllers (and manual copies) leave
+// name.hpi files around, which Jenkins treats as the same plugin.
+type localPlugin struct {
+	archive  string   // Archive Jenkins will load
+	stale    []string // Other archives for the same plugin
+	pinned   bool     // Legacy name.jpi.pinned marker (pre-2.0 bundled plugin pinning)
+	disabled bool     // name.jpi.disabled marker, the plugin will not be loaded
+}
+
+// findLocalPlugin looks up a plugin in a local JENKINS_HOME, returning nil if
+// no archive exists for it.
+func findLocalPlugin(home, name string) (*localPlugin, error) {
+	dir := filepath.Join(home, "plugins")
+	var archives []string
+	for _, ext := range []string{".jpi", ".hpi"} {
+		path := filepath.Join(dir, name+ext)
+		found, err := target.exists(path)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			archives = append(archives, path)
+		}
+	}
+	if len(archives) == 0 {
+		return nil, nil
+	}
+
+	// When both exist Jenkins loads the .jpi, the .hpi is a leftover
+	p := &localPlugin{archive: archives[0], stale: archives[1:]}
+	for _, archive := range archives {
+		if pinned, _ := target.exists(archive + ".pinned"); pinned {
+			p.pinned = true
+		}
+		if disabled, _ := target.exists(archive + ".disabled"); disabled {
+			p.disabled = true
+		}
+	}
+	return p, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (p *localPlugin) String() string {
+	var notes []string
+	if p.disabled {
+		notes = append(notes, "disabled")
+	}
+	if p.pinned {
+		notes = append(notes, "pinned")
+	}
+	for _, stale := range p.stale {
+		notes = append(notes, "stale "+filepath.Base(stale))
+	}
+	if len(notes) == 0 {
+		return filepath.Base(p.archive)
+	}
+	return fmt.Sprintf("%s (%s)", filepath.Base(p.archive), strings.Join(notes, ", "))
+}
+
+// checkLocalPlugin warns about on-disk leftovers that make Jenkins load
+// something other than what was just installed.
+func checkLocalPlugin() error {
+	if jenkinsHome == "" {
+		return nil
+	}
+	p, err := findLocalPlugin(jenkinsHome, pluginName)
+	if err != nil || p == nil {
+		return err
+	}
+	for _, stale := range p.stale {
+		notify("⚠️", "Found leftover %s next to %s, Jenkins ignores it but older controllers may not.", filepath.Base(stale), filepath.Base(p.archive))
+	}
+	if p.pinned {
+		notify("⚠️", "Plugin has a legacy .pinned marker, older controllers keep the pinned version over bundled updates.")
+	}
+	if p.disabled {
+		notify("⚠️", "Plugin has a .disabled marker and will not be loaded after restart.")
+	}
+	return nil
+}
+
+// describeLocalPlugin summarizes the on-disk state for error messages.
+func describeLocalPlugin() string {
+	if jenkinsHome == "" {
+		return ""
+	}
+	p, err := findLocalPlugin(jenkinsHome, pluginName)
+	switch {
+	case err != nil:
+		return fmt.Sprintf(" (could not inspect JENKINS_HOME: %v)", err)
+	case p == nil:
+		return " (no archive in JENKINS_HOME/plugins)"
+	}
+	return fmt.Sprintf(" (on disk: %s)", p)
+}
+
+// pluginBackupPath is where backupPlugin keeps the previous archive: -backup-dir
+// when set, otherwise plugins/name.bak, the file Jenkins itself offers a
+// "Downgrade" from.
+func pluginBackupPath() string {
+	if backupDir != "" {
+		return filepath.Join(backupDir, pluginName+".bak")
+	}
+	return filepath.Join(jenkinsHome, "plugins", pluginName+".bak")
+}
+
+// backedUp is set once backupPlugin saved the plugin in this run, which
+// rollbackAfterCrash may then restore; rolledBack once it did.
+var backedUp, rolledBack bool
+
+// backupPlugin copies the plugin archive currently in JENKINS_HOME to
+// pluginBackupPath.
+func backupPlugin() error {
+	if jenkinsHome == "" {
+		notify("⚠️", "No JENKINS_HOME configured, not backing up %s", pluginName)
+		return nil
+	}
+	p, err := findLocalPlugin(jenkinsHome, pluginName)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		notify("⚠️", "%s is not in %s, nothing to back up", pluginName, jenkinsHome)
+		return nil
+	}
+	data, err := target.readFile(p.archive)
+	if err != nil {
+		return err
+	}
+	backup := pluginBackupPath()
+	if err := target.writeFile(backup, data, 0o644); err != nil {
+		return err
+	}
+	notify("💾", "Backed up %s to %s", filepath.Base(p.archive), backup)
+	backedUp = true
+	return nil
+}
+
+// restorePlugin puts the archive saved by backupPlugin back in place. It
+// takes effect on the next start of Jenkins.
+func restorePlugin() error {
+	if jenkinsHome == "" {
+		return fmt.Errorf("cannot restore %s without JENKINS_HOME", pluginName)
+	}
+	backup := pluginBackupPath()
+	data, err := target.readFile(backup)
+	if err != nil {
+		return fmt.Errorf("no backup of %s to restore: %v", pluginName, err)
+	}
+	archive := filepath.Join(jenkinsHome, "plugins", pluginName+".jpi")
+	if p, err := findLocalPlugin(jenkinsHome, pluginName); err == nil && p != nil {
+		archive = p.archive
+	}
+	if err := target.writeFile(archive, data, 0o644); err != nil {
+		return err
+	}
+	notify("⏪", "Restored %s from %s", filepath.Base(archive), backup)
+	return nil
+}
+
+// prepareHome creates JENKINS_HOME and its plugins directory for a started
+// WAR, so each instance can get its own data directory.
+func prepareHome() error {
+	found, err := target.exists(jenkinsHome)
+	if err != nil || found {
+		return err
+	}
+	if err := target.mkdir(filepath.Join(jenkinsHome, "plugins")); err != nil {
+		return fmt.Errorf("failed to create JENKINS_HOME: %v", err)
+	}
+	notify("📁", "Created JENKINS_HOME %s", jenkinsHome)
+	return nil
+}
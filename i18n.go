@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var langFlag = flag.String("lang", "", "Language for status messages: en, de, es (default from LANG)")
+
+// language is the catalog used by msg, chosen by setLanguage.
+var language = "en"
+
+// catalog holds the status messages of the update pipeline per language.
+// English is the fallback for keys missing in a translation.
+var catalog = map[string]map[string]string{
+	"en": {
+		"error":               "Error:",
+		"starting":            "Starting Jenkins plugin update process...",
+		"completed":           "Plugin update process completed successfully!",
+		"attemptFailed":       "Attempt %d/%d failed (%s): %v",
+		"retrying":            "Retrying in %s...",
+		"bundleWritten":       "Support bundle written to %s",
+		"bundleFailed":        "Failed to write support bundle: %v",
+		"stepDeps":            "Checking plugin dependencies...",
+		"stepUninstall":       "Checking if plugin exists...",
+		"stepInstall":         "Uploading new plugin...",
+		"stepQuietDown":       "Putting Jenkins into quiet mode...",
+		"stepCancelQuietDown": "Leaving quiet mode...",
+		"stepStop":            "Stopping Jenkins...",
+		"stepSafeRestart":     "Restarting Jenkins once running builds finish...",
+		"stepStart":           "Starting Jenkins...",
+		"stepProxyCheck":      "Checking the reverse proxy setup...",
+		"stepVerify":          "Checking if the plugin is installed...",
+		"stepMonitors":        "Checking administrative monitors...",
+		"stepDurability":      "Checking that running Pipeline builds resumed...",
+		"stepDiscardOldData":  "Discarding old data...",
+		"stepBackup":          "Backing up the installed plugin...",
+		"stepReload":          "Reloading configuration from disk...",
+		"stepReplay":          "Replaying a pipeline build to verify the update...",
+		"stepLoadTimes":       "Reading plugin load times from the Jenkins log...",
+		"notInstalled":        "Plugin is not installed, skipping uninstallation.",
+		"alreadyPending":      "Plugin is already pending removal until Jenkins restarts, skipping uninstallation.",
+		"uninstalled":         "Plugin uninstalled successfully! It stays active until Jenkins restarts.",
+		"installed":           "Plugin installed successfully!",
+		"shuttingDown":        "Jenkins is shutting down...",
+		"started":             "Jenkins started successfully.",
+		"waiting":             "Waiting for Jenkins to restart...",
+		"waitingAttempt":      "Waiting... (%d/%d)",
+		"online":              "Jenkins is back online!",
+		"verified":            "Plugin successfully installed! (%s %s)",
+		"errCheckInstall":     "failed to check installation: %v",
+		"errNotInstalled":     "plugin %s is not installed after restart%s",
+		"errStillPending":     "plugin %s is still pending removal, Jenkins has not restarted",
+		"errInactive":         "plugin %s %s is installed but not active%s",
+		"initIntro":           "Writing settings to %s. Press Enter to keep the value in brackets.",
+		"initURL":             "Jenkins URL",
+		"initUser":            "User",
+		"initToken":           "API token",
+		"initKeep":            "keep current",
+		"initNeedCredentials": "A user and an API token are needed: the update steps authenticate.",
+		"initAuthenticated":   "Authenticated as %s.",
+		"initLoginFailed":     "Could not log in: %v",
+		"initStrategy":        "Restart strategy: restart (stop and start), safe (when idle) or none (hot deploy)",
+		"initBackupDir":       "Backup directory (empty for JENKINS_HOME/plugins)",
+		"initInputEnded":      "input ended before the setup was complete, nothing was saved",
+		"rescuePrompt":        "Step %q failed. [r]etry step, [s]kip step, roll[b]ack plugin, start [j]enkins, show [l]og, [k]eep Jenkins as is and exit: ",
+		"rescueTimedOut":      "No answer within %v, giving up",
+	},
+	"de": {
+		"error":               "Fehler:",
+		"starting":            "Plugin-Aktualisierung für Jenkins wird gestartet...",
+		"completed":           "Plugin-Aktualisierung erfolgreich abgeschlossen!",
+		"attemptFailed":       "Versuch %d/%d fehlgeschlagen (%s): %v",
+		"retrying":            "Neuer Versuch in %s...",
+		"bundleWritten":       "Support-Paket gespeichert unter %s",
+		"bundleFailed":        "Support-Paket konnte nicht geschrieben werden: %v",
+		"stepDeps":            "Prüfe Plugin-Abhängigkeiten...",
+		"stepUninstall":       "Prüfe, ob das Plugin vorhanden ist...",
+		"stepInstall":         "Lade neues Plugin hoch...",
+		"stepQuietDown":       "Versetze Jenkins in den Ruhemodus...",
+		"stepCancelQuietDown": "Beende den Ruhemodus...",
+		"stepStop":            "Stoppe Jenkins...",
+		"stepSafeRestart":     "Starte Jenkins neu, sobald laufende Builds beendet sind...",
+		"stepStart":           "Starte Jenkins...",
+		"stepProxyCheck":      "Prüfe die Reverse-Proxy-Konfiguration...",
+		"stepVerify":          "Prüfe, ob das Plugin installiert ist...",
+		"stepMonitors":        "Prüfe Verwaltungshinweise...",
+		"stepDurability":      "Prüfe, ob laufende Pipeline-Builds fortgesetzt wurden...",
+		"stepDiscardOldData":  "Verwerfe veraltete Daten...",
+		"stepBackup":          "Sichere das installierte Plugin...",
+		"stepReload":          "Lade die Konfiguration neu von der Festplatte...",
+		"stepReplay":          "Spiele einen Pipeline-Build zur Prüfung erneut ab...",
+		"stepLoadTimes":       "Lese die Ladezeiten der Plugins aus dem Jenkins-Log...",
+		"notInstalled":        "Plugin ist nicht installiert, Deinstallation wird übersprungen.",
+		"alreadyPending":      "Plugin ist bereits bis zum Neustart zur Entfernung vorgemerkt, Deinstallation wird übersprungen.",
+		"uninstalled":         "Plugin erfolgreich deinstalliert! Es bleibt bis zum Neustart von Jenkins aktiv.",
+		"installed":           "Plugin erfolgreich installiert!",
+		"shuttingDown":        "Jenkins wird heruntergefahren...",
+		"started":             "Jenkins wurde gestartet.",
+		"waiting":             "Warte auf den Neustart von Jenkins...",
+		"waitingAttempt":      "Warte... (%d/%d)",
+		"online":              "Jenkins ist wieder erreichbar!",
+		"verified":            "Plugin erfolgreich installiert! (%s %s)",
+		"errCheckInstall":     "Installation konnte nicht geprüft werden: %v",
+		"errNotInstalled":     "Plugin %s ist nach dem Neustart nicht installiert%s",
+		"errStillPending":     "Plugin %s ist noch zur Entfernung vorgemerkt, Jenkins wurde nicht neu gestartet",
+		"errInactive":         "Plugin %s %s ist installiert, aber nicht aktiv%s",
+		"initIntro":           "Schreibe die Einstellungen nach %s. Enter übernimmt den Wert in Klammern.",
+		"initURL":             "Jenkins-URL",
+		"initUser":            "Benutzer",
+		"initToken":           "API-Token",
+		"initKeep":            "aktuellen behalten",
+		"initNeedCredentials": "Benutzer und API-Token sind nötig: die Aktualisierungsschritte melden sich an.",
+		"initAuthenticated":   "Angemeldet als %s.",
+		"initLoginFailed":     "Anmeldung fehlgeschlagen: %v",
+		"initStrategy":        "Neustart-Strategie: restart (stoppen und starten), safe (im Leerlauf) oder none (ohne Neustart)",
+		"initBackupDir":       "Sicherungsverzeichnis (leer für JENKINS_HOME/plugins)",
+		"initInputEnded":      "Eingabe endete vor dem Abschluss der Einrichtung, nichts wurde gespeichert",
+		"rescuePrompt":        "Schritt %q fehlgeschlagen. [r] wiederholen, [s] überspringen, [b] Plugin zurücksetzen, [j] Jenkins starten, [l] Log anzeigen, [k] Jenkins so lassen und beenden: ",
+		"rescueTimedOut":      "Keine Antwort innerhalb von %v, Abbruch",
+	},
+	"es": {
+		"error":               "Error:",
+		"starting":            "Iniciando la actualización del plugin de Jenkins...",
+		"completed":           "¡Actualización del plugin completada con éxito!",
+		"attemptFailed":       "El intento %d/%d falló (%s): %v",
+		"retrying":            "Reintentando en %s...",
+		"bundleWritten":       "Paquete de soporte guardado en %s",
+		"bundleFailed":        "No se pudo escribir el paquete de soporte: %v",
+		"stepDeps":            "Comprobando las dependencias del plugin...",
+		"stepUninstall":       "Comprobando si el plugin existe...",
+		"stepInstall":         "Subiendo el nuevo plugin...",
+		"stepQuietDown":       "Poniendo Jenkins en modo silencioso...",
+		"stepCancelQuietDown": "Saliendo del modo silencioso...",
+		"stepStop":            "Deteniendo Jenkins...",
+		"stepSafeRestart":     "Reiniciando Jenkins cuando terminen las ejecuciones en curso...",
+		"stepStart":           "Iniciando Jenkins...",
+		"stepProxyCheck":      "Comprobando la configuración del proxy inverso...",
+		"stepVerify":          "Comprobando si el plugin está instalado...",
+		"stepMonitors":        "Comprobando los avisos de administración...",
+		"stepDurability":      "Comprobando que las ejecuciones de Pipeline en curso se reanudaron...",
+		"stepDiscardOldData":  "Descartando datos antiguos...",
+		"stepBackup":          "Respaldando el plugin instalado...",
+		"stepReload":          "Recargando la configuración desde el disco...",
+		"stepReplay":          "Reproduciendo una compilación del pipeline para verificar...",
+		"stepLoadTimes":       "Leyendo los tiempos de carga de los plugins del log de Jenkins...",
+		"notInstalled":        "El plugin no está instalado, se omite la desinstalación.",
+		"alreadyPending":      "El plugin ya está pendiente de eliminación hasta que Jenkins se reinicie, se omite la desinstalación.",
+		"uninstalled":         "¡Plugin desinstalado con éxito! Sigue activo hasta que Jenkins se reinicie.",
+		"installed":           "¡Plugin instalado con éxito!",
+		"shuttingDown":        "Jenkins se está apagando...",
+		"started":             "Jenkins se inició correctamente.",
+		"waiting":             "Esperando a que Jenkins se reinicie...",
+		"waitingAttempt":      "Esperando... (%d/%d)",
+		"online":              "¡Jenkins vuelve a estar disponible!",
+		"verified":            "¡Plugin instalado con éxito! (%s %s)",
+		"errCheckInstall":     "no se pudo comprobar la instalación: %v",
+		"errNotInstalled":     "el plugin %s no está instalado tras el reinicio%s",
+		"errStillPending":     "el plugin %s sigue pendiente de eliminación, Jenkins no se ha reiniciado",
+		"errInactive":         "el plugin %s %s está instalado pero no activo%s",
+		"initIntro":           "Guardando la configuración en %s. Pulse Enter para mantener el valor entre corchetes.",
+		"initURL":             "URL de Jenkins",
+		"initUser":            "Usuario",
+		"initToken":           "Token de API",
+		"initKeep":            "mantener el actual",
+		"initNeedCredentials": "Se necesitan un usuario y un token de API: los pasos de actualización se autentican.",
+		"initAuthenticated":   "Autenticado como %s.",
+		"initLoginFailed":     "No se pudo iniciar sesión: %v",
+		"initStrategy":        "Estrategia de reinicio: restart (detener e iniciar), safe (cuando esté inactivo) o none (sin reinicio)",
+		"initBackupDir":       "Directorio de respaldo (vacío para JENKINS_HOME/plugins)",
+		"initInputEnded":      "la entrada terminó antes de completar la configuración, no se guardó nada",
+		"rescuePrompt":        "El paso %q falló. [r] reintentar, [s] omitir, [b] restaurar el plugin, [j] iniciar Jenkins, [l] ver el log, [k] dejar Jenkins así y salir: ",
+		"rescueTimedOut":      "Sin respuesta en %v, abandonando",
+	},
+}
+
+// setLanguage picks the catalog from -lang, falling back to the usual locale
+// environment variables (e.g. LANG=de_DE.UTF-8) and finally English.
+func setLanguage() {
+	candidates := []string{*langFlag, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, candidate := range candidates {
+		code, _, _ := strings.Cut(strings.ToLower(candidate), "_")
+		code, _, _ = strings.Cut(code, ".")
+		if _, ok := catalog[code]; ok {
+			language = code
+			return
+		}
+	}
+}
+
+// msg formats a catalog message in the current language.
+func msg(key string, args ...any) string {
+	format, ok := catalog[language][key]
+	if !ok {
+		format, ok = catalog["en"][key]
+	}
+	if !ok {
+		format = key
+	}
+	return fmt.Sprintf(format, args...)
+}
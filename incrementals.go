@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// incrementalsRepo is where the CI of jenkinsci plugins publishes a build of
+// every pull request, for testing before it is released.
+const incrementalsRepo = "https://repo.jenkins-ci.org/incrementals/"
+
+// incrementalVersion matches the versions of incremental builds of plugins
+// with release versions: the release they lead up to, the commit count and
+// the commit, e.g. 5.2.2-rc1234.abcdef012345. Builds of plugins versioned
+// by their commits look like releases; install them with incrementals:.
+var incrementalVersion = regexp.MustCompile(`-rc\d+\.[0-9a-f]+$`)
+
+// fetchIncrementalPlugin downloads an incremental build, given as
+// "name:version", the group being looked up in the update center, or as
+// "groupId:artifactId:version" for a plugin the update center does not list.
+func fetchIncrementalPlugin(ref string) (string, error) {
+	parts := strings.Split(ref, ":")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		uc, err := fetchUpdateCenter()
+		if err != nil {
+			return "", err
+		}
+		plugin, ok := uc.Plugins[parts[0]]
+		group, _, _ := strings.Cut(plugin.GAV, ":")
+		if !ok || group == "" {
+			return "", fmt.Errorf("no plugin %s in the update center, give its group as incrementals:groupId:%s", parts[0], ref)
+		}
+		parts = append([]string{group}, parts...)
+	case len(parts) != 3 || parts[2] == "":
+		return "", usageError{fmt.Errorf("invalid incremental build %q, expected name:version or groupId:artifactId:version", ref)}
+	}
+	return mavenRepository{url: incrementalsRepo}.fetchPlugin(strings.Join(parts, ":"))
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"Golang/jenkinswrapper"
+)
+
+// localInstance is a Jenkins started by "instance start", recorded in
+// instance.json next to its home so later commands can find it.
+type localInstance struct {
+	Label       string    `json:"label"`
+	URL         string    `json:"url"`
+	Source      string    `json:"source"` // WAR path or container image
+	Home        string    `json:"home,omitempty"`
+	LogPath     string    `json:"logPath,omitempty"`
+	AdminUser   string    `json:"adminUser"`
+	AdminToken  string    `json:"adminToken"`
+	PID         int       `json:"pid,omitempty"`
+	ContainerID string    `json:"containerId,omitempty"`
+	Started     time.Time `json:"started"`
+}
+
+const instanceFile = "instance.json"
+
+// instanceLabel is what labels may look like: they name a directory under
+// the instances directory, which they must not leave.
+var instanceLabel = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func instancesDir() (string, error) {
+	return cacheDir("instances")
+}
+
+func loadInstance(label string) (*localInstance, string, error) {
+	if !instanceLabel.MatchString(label) || label == "." || label == ".." {
+		return nil, "", usageError{fmt.Errorf("invalid instance label %q, use letters, digits, ., - and _", label)}
+	}
+	dir, err := instancesDir()
+	if err != nil {
+		return nil, "", err
+	}
+	dir = filepath.Join(dir, label)
+	data, err := os.ReadFile(filepath.Join(dir, instanceFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, dir, nil
+	}
+	if err != nil {
+		return nil, dir, err
+	}
+	var inst localInstance
+	if err := json.Unmarshal(data, &inst); err != nil {
+		return nil, dir, fmt.Errorf("failed to read instance %s: %v", label, err)
+	}
+	return &inst, dir, nil
+}
+
+// instanceCommand manages several local controllers side by side, e.g. one
+// per Jenkins core version, each with its own port and home.
+func instanceCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: instance start|stop|list")
+	}
+	switch args[0] {
+	case "start":
+		return instanceStart(args[1:])
+	case "stop":
+		return instanceStop(args[1:])
+	case "list":
+		return instanceList()
+	}
+	return fmt.Errorf("unknown instance command %q", args[0])
+}
+
+func instanceStart(args []string) error {
+	fs := flag.NewFlagSet("instance start", flag.ContinueOnError)
+	label := fs.String("label", "", "Name of the instance (default: jenkins-PORT)")
+	war := fs.String("war", jenkinsWarPath, "jenkins.war to run")
+	image := fs.String("image", "", "Container image to run instead of a WAR")
+	port := fs.Int("port", 0, "HTTP port (default: a free one)")
+	plugins := fs.String("plugins", "", "Comma-separated plugin files to preinstall")
+	mirror := fs.Bool("mirror", false, "Use the caching update center of the mirror command as update site")
+	printToken := fs.Bool("print-token", false, "Print the admin API token on stdout, e.g. for a script; otherwise it is only kept in the instance file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *war == "" && *image == "" {
+		return fmt.Errorf("instance start needs -war or -image")
+	}
+	if *port == 0 {
+		var err error
+		if *port, err = jenkinswrapper.FreePort(); err != nil {
+			return err
+		}
+	}
+	if *label == "" {
+		*label = fmt.Sprintf("jenkins-%d", *port)
+	}
+	existing, dir, err := loadInstance(*label)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("instance %s already exists at %s, stop it first", *label, existing.URL)
+	}
+
+	opts := jenkinswrapper.Options{Port: *port, Image: *image}
+	source := *image
+	if *image == "" {
+		if err := verifyWar(*war); err != nil {
+			return err
+		}
+		opts.WarPath, opts.Home = *war, filepath.Join(dir, "home")
+		source = *war
+		if err := os.MkdirAll(opts.Home, 0o700); err != nil {
+			return err
+		}
+	}
+	if *plugins != "" {
+		opts.Plugins = strings.Split(*plugins, ",")
+	}
+	if *mirror {
+		opts.UpdateSite = sandboxUpdateSite(*image != "")
+	}
+
+	tool := "java"
+	if *image != "" {
+		tool = "docker"
+	}
+	if err := checkLaunch(tool); err != nil {
+		return err
+	}
+	notify("🚀", "Starting %s from %s on port %d...", *label, source, *port)
+	j, err := jenkinswrapper.Start(opts)
+	if err != nil {
+		return err
+	}
+	inst := localInstance{
+		Label:       *label,
+		URL:         j.URL,
+		Source:      source,
+		Home:        j.Home,
+		LogPath:     j.LogPath,
+		AdminUser:   j.AdminUser,
+		AdminToken:  j.AdminToken,
+		PID:         j.PID(),
+		ContainerID: j.ContainerID(),
+		Started:     time.Now(),
+	}
+	data, _ := json.MarshalIndent(inst, "", "  ")
+	if err := writeFileAtomic(filepath.Join(dir, instanceFile), append(data, '\n'), 0o600); err != nil {
+		j.Stop()
+		return err
+	}
+	// The token stays out of notify, which hands it to every sink
+	notify("✅", "%s is up at %s, user %s; its API token is in %s", inst.Label, inst.URL, inst.AdminUser, filepath.Join(dir, instanceFile))
+	if *printToken {
+		fmt.Println(inst.AdminToken)
+	}
+	return nil
+}
+
+func instanceStop(args []string) error {
+	fs := flag.NewFlagSet("instance stop", flag.ContinueOnError)
+	purge := fs.Bool("purge", false, "Also delete the instance's JENKINS_HOME")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: instance stop [-purge] LABEL")
+	}
+	inst, dir, err := loadInstance(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if inst == nil {
+		return fmt.Errorf("no instance named %s", fs.Arg(0))
+	}
+
+	if inst.ContainerID != "" {
+		if err := checkLaunch("docker"); err != nil {
+			return err
+		}
+		if out, err := exec.Command("docker", "rm", "-f", inst.ContainerID).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remove container: %v\nOutput: %s", err, out)
+		}
+	} else if err := killInstance(inst); err != nil {
+		return err
+	}
+
+	if *purge {
+		err = os.RemoveAll(dir)
+	} else {
+		err = os.Remove(filepath.Join(dir, instanceFile))
+	}
+	if err != nil {
+		return err
+	}
+	notify("🛑", "Stopped %s", inst.Label)
+	return nil
+}
+
+// killInstance kills the Jenkins of a WAR instance. The recorded PID may
+// have been reused since, so the process is only killed when its command
+// line is still the one the instance was started with.
+func killInstance(inst *localInstance) error {
+	if err := checkLaunch("kill"); err != nil {
+		return err
+	}
+	cmdline, err := processCommandLine(inst.PID)
+	if err != nil {
+		return nil // Already gone is fine, the goal is that it is not running
+	}
+	port := inst.URL[strings.LastIndex(inst.URL, ":")+1:]
+	if !strings.Contains(cmdline, inst.Source) || !strings.Contains(cmdline, "--httpPort="+port) {
+		notify("⚠️", "Process %d is no longer %s, not killing it", inst.PID, inst.Label)
+		return nil
+	}
+	p, err := os.FindProcess(inst.PID)
+	if err != nil {
+		return nil
+	}
+	return p.Kill()
+}
+
+// processCommandLine returns the command line of a running process, from
+// /proc where there is one and from ps elsewhere.
+func processCommandLine(pid int) (string, error) {
+	if pid <= 0 {
+		return "", fmt.Errorf("no process %d", pid)
+	}
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		return strings.ReplaceAll(string(data), "\x00", " "), nil
+	}
+	out, err := exec.Command("ps", "-o", "args=", "-p", fmt.Sprint(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	if line := strings.TrimSpace(string(out)); line != "" {
+		return line, nil
+	}
+	return "", fmt.Errorf("no process %d", pid)
+}
+
+func instanceList() error {
+	dir, err := instancesDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tURL\tSTATE\tVERSION\tSOURCE")
+	for _, entry := range entries {
+		inst, _, err := loadInstance(entry.Name())
+		if err != nil || inst == nil {
+			continue
+		}
+		state, version := "down", ""
+		if resp, err := pollClient.Get(inst.URL + "/login"); err == nil {
+			resp.Body.Close()
+			state, version = "up", resp.Header.Get("X-Jenkins")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", inst.Label, inst.URL, state, version, inst.Source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,411 @@
+// Package jenkinswrapper boots disposable Jenkins controllers, either from a
+// jenkins.war or a container image, for integration tests of plugins and of
+// tooling that talks to Jenkins.
+//
+//	func TestAgainstJenkins(t *testing.T) {
+//		j := jenkinswrapper.StartEphemeral(t, jenkinswrapper.Options{WarPath: "jenkins.war"})
+//		req, _ := j.NewRequest("GET", "/api/json", nil)
+//		...
+//	}
+package jenkinswrapper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// AdminUser is the account created in every ephemeral instance.
+const AdminUser = "admin"
+
+const (
+	defaultStartupTimeout = 3 * time.Minute
+	tokenFileName         = "wrapper-admin-token"
+	containerHome         = "/var/jenkins_home"
+)
+
+// Options configures an ephemeral Jenkins instance.
+type Options struct {
+	WarPath        string        // Path to jenkins.war; required unless Image is set
+	Image          string        // Container image to run instead of a WAR, e.g. "jenkins/jenkins:lts-jdk17"
+	Home           string        // JENKINS_HOME to use; a temporary one is created when empty (WAR only)
+	Port           int           // HTTP port; a free one is picked when zero
+	Plugins        []string      // Plugin files (.hpi/.jpi) to preinstall
+	JavaOpts       []string      // Extra JVM options
+	StartupTimeout time.Duration // How long to wait for Jenkins to come up; defaults to 3 minutes
+	UpdateSite     string        // update-center.json URL to use instead of the default, e.g. a caching mirror; its signature is not checked
+}
+
+// hostGateway is the name under which a container reaches the host.
+const hostGateway = "host.docker.internal"
+
+// containerURL rewrites a URL on the host's loopback interface to one a
+// container reaches the host by.
+func containerURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return raw
+	}
+	u.Host = hostGateway
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(hostGateway, port)
+	}
+	return u.String()
+}
+
+// Instance is a running Jenkins controller with an admin user and API token.
+type Instance struct {
+	URL        string
+	Home       string // Empty for container instances
+	LogPath    string
+	AdminUser  string
+	AdminToken string
+
+	cmd         *exec.Cmd
+	exited      chan struct{}
+	containerID string
+	cleanupDirs []string
+}
+
+// StartEphemeral starts a Jenkins instance for the duration of a test and
+// stops it, removing its data, when the test finishes. It is skipped in
+// -short mode since booting Jenkins takes a while.
+func StartEphemeral(t testing.TB, opts Options) *Instance {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping ephemeral Jenkins in short mode")
+	}
+	j, err := Start(opts)
+	if err != nil {
+		t.Fatalf("failed to start ephemeral Jenkins: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := j.Stop(); err != nil {
+			t.Logf("failed to stop ephemeral Jenkins: %v", err)
+		}
+	})
+	return j
+}
+
+// Start boots a Jenkins instance and waits until the admin token works.
+// Callers must call Stop when done.
+func Start(opts Options) (*Instance, error) {
+	if opts.WarPath == "" && opts.Image == "" {
+		return nil, errors.New("either WarPath or Image is required")
+	}
+	if opts.StartupTimeout == 0 {
+		opts.StartupTimeout = defaultStartupTimeout
+	}
+	if opts.Port == 0 {
+		port, err := FreePort()
+		if err != nil {
+			return nil, err
+		}
+		opts.Port = port
+	}
+
+	j := &Instance{
+		URL:       fmt.Sprintf("http://127.0.0.1:%d", opts.Port),
+		AdminUser: AdminUser,
+		exited:    make(chan struct{}),
+	}
+
+	var err error
+	if opts.Image != "" {
+		err = j.startContainer(opts)
+	} else {
+		err = j.startWar(opts)
+	}
+	if err == nil {
+		err = j.waitReady(opts.StartupTimeout)
+	}
+	if err != nil {
+		j.Stop()
+		return nil, err
+	}
+	return j, nil
+}
+
+// FreePort asks the OS for a currently unused TCP port.
+func FreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (j *Instance) startWar(opts Options) error {
+	j.Home = opts.Home
+	if j.Home == "" {
+		home, err := os.MkdirTemp("", "jenkinswrapper-home-*")
+		if err != nil {
+			return err
+		}
+		j.Home = home
+		j.cleanupDirs = append(j.cleanupDirs, home)
+	}
+	if err := prepareHome(j.Home, opts); err != nil {
+		return err
+	}
+
+	j.LogPath = filepath.Join(j.Home, "jenkins.log")
+	logFile, err := os.Create(j.LogPath)
+	if err != nil {
+		return err
+	}
+
+	args := append(jvmOptions(opts), "-jar", opts.WarPath, fmt.Sprintf("--httpPort=%d", opts.Port), "--httpListenAddress=127.0.0.1")
+	j.cmd = exec.Command("java", args...)
+	j.cmd.Env = append(os.Environ(), "JENKINS_HOME="+j.Home)
+	j.cmd.Stdout = logFile
+	j.cmd.Stderr = logFile
+	if err := j.cmd.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("failed to start Jenkins: %v", err)
+	}
+	go func() {
+		j.cmd.Wait()
+		logFile.Close()
+		close(j.exited)
+	}()
+	return nil
+}
+
+func (j *Instance) startContainer(opts Options) error {
+	ref, err := os.MkdirTemp("", "jenkinswrapper-ref-*")
+	if err != nil {
+		return err
+	}
+	j.cleanupDirs = append(j.cleanupDirs, ref)
+	if opts.UpdateSite != "" {
+		opts.UpdateSite = containerURL(opts.UpdateSite) // 127.0.0.1 is the container itself
+	}
+	if err := prepareHome(ref, opts); err != nil {
+		return err
+	}
+
+	args := []string{"run", "-d",
+		"--add-host=" + hostGateway + ":host-gateway",
+		"-p", fmt.Sprintf("127.0.0.1:%d:8080", opts.Port),
+		"-e", "JAVA_OPTS=" + strings.Join(jvmOptions(opts), " "),
+		"-v", filepath.Join(ref, "init.groovy.d") + ":/usr/share/jenkins/ref/init.groovy.d:ro",
+		"-v", filepath.Join(ref, "plugins") + ":/usr/share/jenkins/ref/plugins:ro",
+		opts.Image,
+	}
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start container: %v\nOutput: %s", err, out)
+	}
+	j.containerID = strings.TrimSpace(string(out))
+	return nil
+}
+
+func jvmOptions(opts Options) []string {
+	return append([]string{"-Djenkins.install.runSetupWizard=false"}, opts.JavaOpts...)
+}
+
+// prepareHome lays out the init scripts and plugins in a Jenkins home (or the
+// container reference directory, which has the same layout).
+func prepareHome(home string, opts Options) error {
+	password, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	initDir := filepath.Join(home, "init.groovy.d")
+	pluginsDir := filepath.Join(home, "plugins")
+	for _, dir := range []string{initDir, pluginsDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	script := fmt.Sprintf(adminScript, AdminUser, password, tokenFileName)
+	if err := os.WriteFile(filepath.Join(initDir, "jenkinswrapper-admin.groovy"), []byte(script), 0o644); err != nil {
+		return err
+	}
+	if opts.UpdateSite != "" {
+		script := fmt.Sprintf(updateSiteScript, opts.UpdateSite)
+		if err := os.WriteFile(filepath.Join(initDir, "jenkinswrapper-update-site.groovy"), []byte(script), 0o644); err != nil {
+			return err
+		}
+	}
+
+	for _, plugin := range opts.Plugins {
+		data, err := os.ReadFile(plugin)
+		if err != nil {
+			return err
+		}
+		// Jenkins always stores plugins as .jpi
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(plugin), ".hpi"), ".jpi") + ".jpi"
+		if err := os.WriteFile(filepath.Join(pluginsDir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adminScript turns on security, creates the admin account unless it already
+// exists and stores a fresh API token where Start can pick it up.
+const adminScript = `import jenkins.model.Jenkins
+import hudson.security.HudsonPrivateSecurityRealm
+import hudson.security.FullControlOnceLoggedInAuthorizationStrategy
+import jenkins.security.ApiTokenProperty
+
+def jenkins = Jenkins.get()
+def realm = jenkins.securityRealm instanceof HudsonPrivateSecurityRealm ? jenkins.securityRealm : new HudsonPrivateSecurityRealm(false)
+def user = hudson.model.User.getById("%[1]s", false) ?: realm.createAccount("%[1]s", "%[2]s")
+jenkins.securityRealm = realm
+def strategy = new FullControlOnceLoggedInAuthorizationStrategy()
+strategy.allowAnonymousRead = false
+jenkins.authorizationStrategy = strategy
+jenkins.save()
+
+def token = user.getProperty(ApiTokenProperty).tokenStore.generateNewToken("jenkinswrapper")
+user.save()
+new File(jenkins.rootDir, "%[3]s").text = token.plainValue
+`
+
+// updateSiteScript points the default update site at another URL on every
+// start. A mirror rewrites the download URLs, which invalidates the
+// signature, so that site alone skips the check; the site is not saved, as
+// its class only exists in this script.
+const updateSiteScript = `import hudson.util.FormValidation
+import jenkins.util.JSONSignatureValidator
+import net.sf.json.JSONObject
+
+class MirrorUpdateSite extends hudson.model.UpdateSite {
+    MirrorUpdateSite(String id, String url) { super(id, url) }
+
+    @Override
+    protected JSONSignatureValidator getJsonSignatureValidator(String name) {
+        return new JSONSignatureValidator(name) {
+            @Override
+            FormValidation verifySignature(JSONObject o) { FormValidation.ok() }
+        }
+    }
+}
+
+def uc = jenkins.model.Jenkins.get().updateCenter
+uc.sites.removeAll { it.id == "default" }
+uc.sites.add(new MirrorUpdateSite("default", %q))
+`
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (j *Instance) readToken() (string, error) {
+	if j.containerID != "" {
+		out, err := exec.Command("docker", "exec", j.containerID, "cat", containerHome+"/"+tokenFileName).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	data, err := os.ReadFile(filepath.Join(j.Home, tokenFileName))
+	return strings.TrimSpace(string(data)), err
+}
+
+func (j *Instance) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if token, err := j.readToken(); err == nil && token != "" {
+			j.AdminToken = token
+			if req, err := j.NewRequest("GET", "/whoAmI/api/json", nil); err == nil {
+				if resp, err := http.DefaultClient.Do(req); err == nil {
+					resp.Body.Close()
+					if resp.StatusCode == http.StatusOK {
+						return nil
+					}
+				}
+			}
+		}
+
+		select {
+		case <-j.exited:
+			return fmt.Errorf("jenkins exited during startup\n%s", j.logTail())
+		case <-time.After(time.Second):
+		}
+	}
+	return fmt.Errorf("jenkins did not start within %s\n%s", timeout, j.logTail())
+}
+
+func (j *Instance) logTail() string {
+	if j.containerID != "" {
+		out, _ := exec.Command("docker", "logs", "--tail", "20", j.containerID).CombinedOutput()
+		return string(out)
+	}
+	data, err := os.ReadFile(j.LogPath)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > 20 {
+		lines = lines[len(lines)-20:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewRequest builds a request against the instance authenticated as the admin.
+func (j *Instance) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, j.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(j.AdminUser, j.AdminToken)
+	return req, nil
+}
+
+// PID returns the Jenkins process ID of a WAR instance, or 0 for containers.
+func (j *Instance) PID() int {
+	if j.cmd == nil || j.cmd.Process == nil {
+		return 0
+	}
+	return j.cmd.Process.Pid
+}
+
+// ContainerID returns the container of an image instance, or "" for WARs.
+func (j *Instance) ContainerID() string {
+	return j.containerID
+}
+
+// Stop shuts the instance down and removes any temporary data it created.
+func (j *Instance) Stop() error {
+	var errs []error
+	if j.containerID != "" {
+		if out, err := exec.Command("docker", "rm", "-f", j.containerID).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove container: %v\nOutput: %s", err, out))
+		}
+	}
+	if j.cmd != nil && j.cmd.Process != nil {
+		select {
+		case <-j.exited:
+		default:
+			j.cmd.Process.Kill()
+			<-j.exited
+		}
+	}
+	for _, dir := range j.cleanupDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
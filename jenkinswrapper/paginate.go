@@ -0,0 +1,187 @@
+package jenkinswrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultPageSize is how many elements Paginate fetches per request when
+// given a page size of zero.
+const DefaultPageSize = 100
+
+// MaxPageBytes caps the size of a page Paginate decodes, so a misbehaving
+// controller or proxy cannot exhaust memory.
+var MaxPageBytes int64 = 64 << 20
+
+// Requester builds authenticated requests against a controller. *Instance
+// implements it; other clients can adapt their own request builders.
+type Requester interface {
+	NewRequest(method, path string, body io.Reader) (*http.Request, error)
+}
+
+// Paginate walks the array field of the remote API object at path, fetching
+// pageSize elements at a time with a tree range (field[fields]{M,N}), so large
+// controllers are never asked for a whole history in one response. Pages
+// are fetched lazily as the caller iterates; stopping early fetches no more.
+// Elements added to the front of the array while iterating (new builds) shift
+// later pages, so callers should tolerate seeing an element twice.
+func Paginate[T any](client *http.Client, r Requester, path, field, fields string, pageSize int) iter.Seq2[T, error] {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return func(yield func(T, error) bool) {
+		for start := 0; ; start += pageSize {
+			tree := fmt.Sprintf("%s[%s]{%d,%d}", field, fields, start, start+pageSize)
+			page, err := fetchPage[T](client, r, path+"/api/json?tree="+url.QueryEscape(tree), field)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, element := range page {
+				if !yield(element, nil) {
+					return
+				}
+			}
+			if len(page) < pageSize {
+				return
+			}
+		}
+	}
+}
+
+func fetchPage[T any](client *http.Client, r Requester, path, field string) ([]T, error) {
+	req, err := r.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxPageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %v", path, err)
+	}
+	if int64(len(body)) > MaxPageBytes {
+		return nil, fmt.Errorf("GET %s: page exceeds %d bytes", path, MaxPageBytes)
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, fmt.Errorf("GET %s: %v", path, err)
+	}
+	var page []T
+	if raw, ok := object[field]; ok {
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("GET %s: %v", path, err)
+		}
+	}
+	return page, nil
+}
+
+// JobPath turns a full job name such as "folder/name" into its URL path.
+func JobPath(fullName string) string {
+	var path strings.Builder
+	for _, part := range strings.Split(strings.Trim(fullName, "/"), "/") {
+		if part != "" {
+			path.WriteString("/job/" + url.PathEscape(part))
+		}
+	}
+	return path.String()
+}
+
+// Job is an item of a folder or of the controller root.
+type Job struct {
+	Name     string `json:"name"`
+	FullName string `json:"fullName"`
+	URL      string `json:"url"`
+	Color    string `json:"color"`
+}
+
+// Jobs lists the jobs directly in folder, or at the root when folder is "".
+func Jobs(client *http.Client, r Requester, folder string) iter.Seq2[Job, error] {
+	return Paginate[Job](client, r, JobPath(folder), "jobs", "name,fullName,url,color", 0)
+}
+
+// AllJobs lists the jobs in folder and in the folders below it, depth first.
+// Folders, multibranch projects and organization folders are walked rather
+// than listed: they are the items without a build status color.
+func AllJobs(client *http.Client, r Requester, folder string) iter.Seq2[Job, error] {
+	return func(yield func(Job, error) bool) {
+		for job, err := range Jobs(client, r, folder) {
+			if err != nil {
+				yield(job, err)
+				return
+			}
+			if job.Color != "" {
+				if !yield(job, nil) {
+					return
+				}
+				continue
+			}
+			for nested, err := range AllJobs(client, r, job.FullName) {
+				if !yield(nested, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Build is a run of a job.
+type Build struct {
+	Number    int    `json:"number"`
+	Result    string `json:"result"` // Empty while building
+	Building  bool   `json:"building"`
+	Timestamp int64  `json:"timestamp"` // Start time, milliseconds since the epoch
+	Duration  int64  `json:"duration"`  // Milliseconds, zero while building
+	URL       string `json:"url"`
+}
+
+// Builds lists the complete build history of a job, newest first.
+func Builds(client *http.Client, r Requester, job string) iter.Seq2[Build, error] {
+	return Paginate[Build](client, r, JobPath(job), "allBuilds", "number,result,building,timestamp,duration,url", 0)
+}
+
+// QueueItem is a build waiting to start.
+type QueueItem struct {
+	ID           int    `json:"id"`
+	Why          string `json:"why"`
+	InQueueSince int64  `json:"inQueueSince"`
+	Blocked      bool   `json:"blocked"`
+	Stuck        bool   `json:"stuck"`
+	Task         struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"task"`
+}
+
+// Queue lists the build queue.
+func Queue(client *http.Client, r Requester) iter.Seq2[QueueItem, error] {
+	return Paginate[QueueItem](client, r, "/queue", "items", "id,why,inQueueSince,blocked,stuck,task[name,url]", 0)
+}
+
+// Node is the controller or an agent.
+type Node struct {
+	DisplayName  string `json:"displayName"`
+	Offline      bool   `json:"offline"`
+	Idle         bool   `json:"idle"`
+	NumExecutors int    `json:"numExecutors"`
+}
+
+// Nodes lists the controller and its agents.
+func Nodes(client *http.Client, r Requester) iter.Seq2[Node, error] {
+	return Paginate[Node](client, r, "/computer", "computer", "displayName,offline,idle,numExecutors", 0)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and the versions used: Metadata v4 and Produce v3 are the
+// oldest ones every broker from 0.11 to 4.x still accepts.
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+	kafkaClientID        = "jenkins-wrapper"
+	// kafkaMaxResponse bounds the size a broker can announce for a response;
+	// metadata and produce responses are a few kilobytes.
+	kafkaMaxResponse = 16 << 20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaPublisher produces every event to partition 0 of the topic, which
+// keeps the events of a run in order. It talks to the partition leader
+// directly and looks the leader up again after a failure.
+type kafkaPublisher struct {
+	brokers []string
+	topic   string
+
+	mu            sync.Mutex // Held while sending, so close waits for delivery to stop
+	closed        bool
+	conn          net.Conn
+	correlationID int32
+}
+
+func (p *kafkaPublisher) send(payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return fmt.Errorf("kafka %s: publisher is closed", p.topic)
+	}
+	err := p.produce(payload)
+	if err != nil && p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		err = p.produce(payload) // The leader may have moved
+	}
+	if err != nil {
+		return fmt.Errorf("kafka %s: %v", p.topic, err)
+	}
+	return nil
+}
+
+func (p *kafkaPublisher) produce(payload []byte) error {
+	if p.conn == nil {
+		leader, err := p.leader()
+		if err != nil {
+			return err
+		}
+		if p.conn, err = net.DialTimeout("tcp", leader, 10*time.Second); err != nil {
+			return err
+		}
+	}
+
+	var body kafkaBuffer
+	body.int16(-1) // No transactional id
+	body.int16(1)  // acks: the leader wrote it
+	body.int32(10000)
+	body.int32(1)
+	body.string(p.topic)
+	body.int32(1)
+	body.int32(0) // Partition
+	batch := recordBatch(payload, time.Now())
+	body.int32(int32(len(batch)))
+	body.bytes(batch)
+
+	resp, err := p.roundTrip(p.conn, kafkaProduce, kafkaProduceVersion, body)
+	if err != nil {
+		return err
+	}
+	// responses: [topic [partition error_code base_offset log_append_time]]
+	r := kafkaReader{b: resp}
+	r.int32()
+	r.string()
+	r.int32()
+	r.int32()
+	if code := r.int16(); r.err != nil || code != 0 {
+		return kafkaError(code, r.err)
+	}
+	return nil
+}
+
+// leader asks the configured brokers for the leader of partition 0.
+func (p *kafkaPublisher) leader() (string, error) {
+	var lastErr error
+	for _, broker := range p.brokers {
+		conn, err := net.DialTimeout("tcp", broker, 10*time.Second)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addr, err := p.metadata(conn)
+		conn.Close()
+		if err == nil {
+			return addr, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func (p *kafkaPublisher) metadata(conn net.Conn) (string, error) {
+	var body kafkaBuffer
+	body.int32(1)
+	body.string(p.topic)
+	body.bool(true) // Allow auto-creation, as producers do
+	resp, err := p.roundTrip(conn, kafkaMetadata, kafkaMetadataVersion, body)
+	if err != nil {
+		return "", err
+	}
+
+	r := kafkaReader{b: resp}
+	r.int32() // Throttle time
+	brokers := map[int32]string{}
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id, host, port := r.int32(), r.string(), r.int32()
+		r.string() // Rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.string() // Cluster id
+	r.int32()  // Controller id
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		if code := r.int16(); code != 0 {
+			return "", kafkaError(code, nil)
+		}
+		r.string()
+		r.bool()
+		for partitions := r.int32(); partitions > 0 && r.err == nil; partitions-- {
+			r.int16()
+			partition, leader := r.int32(), r.int32()
+			for replicas := r.int32(); replicas > 0 && r.err == nil; replicas-- {
+				r.int32()
+			}
+			for isr := r.int32(); isr > 0 && r.err == nil; isr-- {
+				r.int32()
+			}
+			if addr, ok := brokers[leader]; ok && partition == 0 && r.err == nil {
+				return addr, nil
+			}
+		}
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	return "", errors.New("partition 0 has no leader")
+}
+
+// roundTrip sends a request and returns the response body after the
+// correlation id.
+func (p *kafkaPublisher) roundTrip(conn net.Conn, apiKey, version int16, body kafkaBuffer) ([]byte, error) {
+	p.correlationID++
+	var req kafkaBuffer
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(p.correlationID)
+	req.string(kafkaClientID)
+	req.bytes(body)
+
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(req))), req...)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	var size int32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size <= 0 || size > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(r, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 || int32(binary.BigEndian.Uint32(resp)) != p.correlationID {
+		return nil, errors.New("mismatched response")
+	}
+	return resp[4:], nil
+}
+
+func (p *kafkaPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// recordBatch encodes a single-record batch in the v2 message format.
+func recordBatch(value []byte, now time.Time) []byte {
+	var record kafkaBuffer
+	record = append(record, 0)               // Attributes
+	record = binary.AppendVarint(record, 0)  // Timestamp delta
+	record = binary.AppendVarint(record, 0)  // Offset delta
+	record = binary.AppendVarint(record, -1) // No key
+	record = binary.AppendVarint(record, int64(len(value)))
+	record = append(record, value...)
+	record = binary.AppendVarint(record, 0) // No headers
+
+	var tail kafkaBuffer // Everything the CRC covers
+	ms := now.UnixMilli()
+	tail.int16(0) // Attributes: no compression
+	tail.int32(0) // Last offset delta
+	tail.int64(ms)
+	tail.int64(ms)
+	tail.int64(-1) // Producer id
+	tail.int16(-1) // Producer epoch
+	tail.int32(-1) // Base sequence
+	tail.int32(1)
+	tail = binary.AppendVarint(tail, int64(len(record)))
+	tail.bytes(record)
+
+	var batch kafkaBuffer
+	batch.int64(0)                            // Base offset
+	batch.int32(int32(4 + 1 + 4 + len(tail))) // Length after this field
+	batch.int32(-1)                           // Partition leader epoch
+	batch = append(batch, 2)                  // Magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(tail, castagnoli))
+	batch.bytes(tail)
+	return batch
+}
+
+func kafkaError(code int16, err error) error {
+	if err != nil {
+		return fmt.Errorf("malformed response: %v", err)
+	}
+	return fmt.Errorf("broker error code %d", code)
+}
+
+type kafkaBuffer []byte
+
+func (b *kafkaBuffer) int16(v int16)  { *b = binary.BigEndian.AppendUint16(*b, uint16(v)) }
+func (b *kafkaBuffer) int32(v int32)  { *b = binary.BigEndian.AppendUint32(*b, uint32(v)) }
+func (b *kafkaBuffer) int64(v int64)  { *b = binary.BigEndian.AppendUint64(*b, uint64(v)) }
+func (b *kafkaBuffer) bytes(v []byte) { *b = append(*b, v...) }
+
+func (b *kafkaBuffer) bool(v bool) {
+	if v {
+		*b = append(*b, 1)
+	} else {
+		*b = append(*b, 0)
+	}
+}
+
+func (b *kafkaBuffer) string(s string) {
+	b.int16(int16(len(s)))
+	*b = append(*b, s...)
+}
+
+// kafkaReader decodes a response, remembering the first short read.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, max(n, 0))
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.next(2))) }
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+func (r *kafkaReader) bool() bool   { return r.next(1)[0] != 0 }
+
+// string reads a (nullable) string; null reads as "".
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// actionClient posts to Jenkins action endpoints without following their
+// redirect to the home page, which answers 503 while Jenkins quiets down,
+// restarts or reloads and would turn a successful action into a failure.
+var actionClient = &http.Client{
+	Transport:     httpClient.Transport,
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// lifecycleEndpoint describes how Jenkins answers one of its lifecycle
+// actions.
+type lifecycleEndpoint struct {
+	goesDown   bool // Jenkins stops answering once the action took effect
+	status     int  // Status of a successful POST
+	restarting bool // A 503 means Jenkins already restarts, so the action is moot
+}
+
+// lifecycleEndpoints are the actions lifecycle accepts. For those that go
+// down, a retry after a network failure is only sent while Jenkins is still
+// up.
+var lifecycleEndpoints = map[string]lifecycleEndpoint{
+	"/exit":            {goesDown: true, status: http.StatusOK},
+	"/safeExit":        {goesDown: true, status: http.StatusOK},
+	"/restart":         {goesDown: true, status: http.StatusFound, restarting: true},
+	"/safeRestart":     {status: http.StatusFound, restarting: true},
+	"/reload":          {status: http.StatusFound, restarting: true},
+	"/quietDown":       {status: http.StatusFound},
+	"/cancelQuietDown": {status: http.StatusFound},
+}
+
+// lifecycle triggers one of the lifecycle endpoints. Only the status the
+// action answers with counts as success, and a redirect only when it does
+// not lead to the login page; for actions that
+// restart Jenkins, a 503 does too, as Jenkins already restarts and says so.
+// A connection dropped mid-response means the JVM exited, which is what
+// /exit and friends are for.
+func lifecycle(path string) error {
+	endpoint, ok := lifecycleEndpoints[path]
+	if !ok {
+		return errors.New("unknown lifecycle endpoint " + path)
+	}
+	if dryRunning("POST %s%s", jenkinsURL, path) {
+		return nil // The dry-run transport's 200 is not what the action answers
+	}
+	req, err := newActionRequest(path)
+	if err != nil {
+		return err
+	}
+	if endpoint.goesDown {
+		// Down, or answering 503 while it shuts down or restarts
+		req = withVerifier(req, func() bool {
+			resp, err := pollClient.Get(jenkinsURL + "/login")
+			if err != nil {
+				return true
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusServiceUnavailable
+		})
+	}
+
+	resp, err := actionClient.Do(req)
+	if err != nil {
+		if endpoint.goesDown && droppedConnection(err) {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusServiceUnavailable && endpoint.restarting:
+		return nil
+	case resp.StatusCode != endpoint.status:
+		return newHTTPStatusError(path+" failed", resp)
+	}
+	return checkActionStatus(path, resp)
+}
+
+// postAction triggers an action endpoint that is not part of the lifecycle,
+// such as a button of an administrative monitor.
+func postAction(path string) error {
+	req, err := newActionRequest(path)
+	if err != nil {
+		return err
+	}
+	resp, err := actionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkActionStatus(path, resp)
+}
+
+// checkActionStatus accepts a 2xx, or a redirect that does not lead to the
+// login page, which is where Jenkins sends requests it did not authenticate.
+func checkActionStatus(path string, resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		loc, err := resp.Location()
+		if err == nil && !strings.HasSuffix(strings.TrimSuffix(loc.Path, "/"), "/login") {
+			return nil
+		}
+	}
+	return newHTTPStatusError(path+" failed", resp)
+}
+
+func droppedConnection(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
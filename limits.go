@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var maxResponseSize = flag.Int64("max-response-size", 64<<20, "Maximum size in bytes of a single API response")
+
+var errResponseTooLarge = errors.New("response exceeds -max-response-size")
+
+// limitedReader fails with errResponseTooLarge instead of silently
+// truncating when more than limit bytes are read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only an error if there is actually more data
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			return 0, errResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// limitBody wraps a response body with the configured size cap.
+func limitBody(resp *http.Response) io.Reader {
+	return &limitedReader{r: resp.Body, remaining: *maxResponseSize}
+}
+
+func decodeJSON(resp *http.Response, v any) error {
+	if err := json.NewDecoder(limitBody(resp)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", resp.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// streamJSONArray decodes the elements of the array in the top-level field of
+// a JSON object one at a time, so large listings never have to be held in
+// memory as a whole. Other fields are skipped.
+func streamJSONArray[T any](resp *http.Response, field string, fn func(T) error) error {
+	dec := json.NewDecoder(limitBody(resp))
+	fail := func(err error) error {
+		return fmt.Errorf("failed to decode %s: %w", resp.Request.URL.Path, err)
+	}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return fail(err)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+		if tok != field {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return fail(err)
+		}
+		for dec.More() {
+			var item T
+			if err := dec.Decode(&item); err != nil {
+				return fail(err)
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// lintJenkinsfileCommand validates a declarative Jenkinsfile against the
+// controller, so it is checked with the plugin versions actually installed.
+func lintJenkinsfileCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: lint-jenkinsfile path/Jenkinsfile")
+	}
+	jenkinsfile, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	form := url.Values{"jenkinsfile": {string(jenkinsfile)}}
+	req, err := newJenkinsRequest("POST", "/pipeline-model-converter/validate", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return fmt.Errorf("the controller cannot lint Jenkinsfiles, is the Pipeline: Declarative plugin installed?")
+	}
+	if resp.StatusCode != 200 {
+		return newHTTPStatusError("failed to validate "+args[0], resp)
+	}
+	out, err := io.ReadAll(limitBody(resp))
+	if err != nil {
+		return err
+	}
+
+	result := strings.TrimSpace(string(out))
+	if !strings.Contains(result, "successfully validated") {
+		return fmt.Errorf("%s is invalid:\n%s", args[0], result)
+	}
+	notify("✅", "%s: %s", args[0], result)
+	return nil
+}
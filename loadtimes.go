@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	loadTimes    = flag.Bool("load-times", false, "Report how long each plugin took to load and initialize after the restart")
+	loadTimesTop = flag.Int("load-times-top", 10, "How many of the slowest plugins -load-times reports")
+)
+
+// startupPerformance makes Jenkins log the duration of every initialization
+// task, which is where the per-plugin times come from.
+const startupPerformance = "-Djenkins.model.Jenkins.logStartupPerformance=true"
+
+// pluginTask matches the startup performance lines of plugin tasks, e.g.
+// "Took 1,234ms for Loading plugin Git plugin v5.2.1 (git) by pool-6-thread-3"
+// or "Took 87ms for Initializing plugin git by pool-6-thread-1".
+var pluginTask = regexp.MustCompile(`Took ([\d,]+)ms for (?:Loading plugin .* \(([^)]+)\)|Initializing plugin (\S+)) by `)
+
+// pluginLoadTime is the time one plugin added to a Jenkins startup.
+type pluginLoadTime struct {
+	Plugin   string  `json:"plugin"`
+	Load     float64 `json:"loadSeconds"`
+	Init     float64 `json:"initSeconds"`
+	Duration float64 `json:"totalSeconds"`
+}
+
+// parseLoadTimes sums up the plugin tasks of the last startup in a Jenkins
+// log, slowest plugin first.
+func parseLoadTimes(log string) []pluginLoadTime {
+	times := map[string]*pluginLoadTime{}
+	for _, line := range strings.Split(log, "\n") {
+		if strings.Contains(line, "Started initialization") {
+			times = map[string]*pluginLoadTime{} // Only the last startup counts
+			continue
+		}
+		m := pluginTask.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ms, err := strconv.Atoi(strings.ReplaceAll(m[1], ",", ""))
+		if err != nil {
+			continue
+		}
+		name := m[2] + m[3]
+		t, ok := times[name]
+		if !ok {
+			t = &pluginLoadTime{Plugin: name}
+			times[name] = t
+		}
+		seconds := (time.Duration(ms) * time.Millisecond).Seconds()
+		if m[2] != "" {
+			t.Load += seconds
+		} else {
+			t.Init += seconds
+		}
+		t.Duration += seconds
+	}
+
+	result := make([]pluginLoadTime, 0, len(times))
+	for _, t := range times {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Duration != result[j].Duration {
+			return result[i].Duration > result[j].Duration
+		}
+		return result[i].Plugin < result[j].Plugin
+	})
+	return result
+}
+
+// reportLoadTimes reads the log of the Jenkins started by this run and
+// reports its slowest plugins. Jenkins started some other way only logs the
+// times with the startup performance property set.
+func reportLoadTimes() error {
+	data, err := target.readFile(jenkinsLogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", jenkinsLogPath, err)
+	}
+	times := parseLoadTimes(string(data))
+	if len(times) == 0 {
+		notify("⚠️", "No plugin load times in %s; Jenkins logs them when started with %s", jenkinsLogPath, startupPerformance)
+		return nil
+	}
+	report.LoadTimes = times
+	printLoadTimes(times, *loadTimesTop)
+	return nil
+}
+
+func printLoadTimes(times []pluginLoadTime, top int) {
+	var total float64
+	for _, t := range times {
+		total += t.Duration
+	}
+	notify("⏱️", "%d plugins took %.1fs to load and initialize, the slowest:", len(times), total)
+	for i, t := range times {
+		if i == top {
+			break
+		}
+		printOutput(fmt.Sprintf("  %-40s %7.2fs (load %.2fs, init %.2fs)", t.Plugin, t.Duration, t.Load, t.Init))
+	}
+}
+
+// loadTimesCommand reports the plugin load times of the last startup in a
+// Jenkins log, by default the configured one.
+func loadTimesCommand(args []string) error {
+	fs := flag.NewFlagSet("load-times", flag.ContinueOnError)
+	log := fs.String("log", jenkinsLogPath, "Jenkins log to read")
+	top := fs.Int("top", *loadTimesTop, "How many of the slowest plugins to list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	data, err := target.readFile(*log)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", *log, err)
+	}
+	times := parseLoadTimes(string(data))
+	if len(times) == 0 {
+		return fmt.Errorf("no plugin load times in %s; Jenkins logs them when started with %s", *log, startupPerformance)
+	}
+	printLoadTimes(times, *top)
+	return nil
+}
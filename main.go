@@ -1,211 +1,754 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	_ "io"
-	_ "mime/multipart"
+	"io"
+	"mime/multipart"
 	"net/http"
-	_ "os"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+
+	"Golang/jenkinswrapper"
 )
 
-// Jenkins credentials and details
-const (
-	jenkinsCLIPath = "" // Path to jenkins-cli.jar
-	jenkinsURL     = "" // Jenkins URL
-	jenkinsUser    = "" // Jenkins username
-	jenkinsToken   = "" // Jenkins API token
-	pluginName     = "" // Plugin name
-	pluginPath     = "" // Path to the new plugin .hpi file
-	jenkinsWarPath = "" // Path to jenkins.war
+// Jenkins credentials and details, see settings for where they come from
+var (
+	jenkinsCLIPath  string // Path to jenkins-cli.jar
+	jenkinsURL      string // Jenkins URL
+	jenkinsUser     string // Jenkins username
+	jenkinsToken    string // Jenkins API token
+	pluginName      string // Plugin name
+	pluginPath      string // Path to the new plugin .hpi file
+	jenkinsWarPath  string // Path to jenkins.war
+	jenkinsLogPath  string // Where the started Jenkins writes its console output
+	jenkinsHome     string // JENKINS_HOME, when Jenkins runs on this machine
+	jenkinsOptions  string // Extra Winstone options for the started Jenkins
+	pipelineSteps   string // Comma-separated custom step sequence, empty for the default update
+	scheduleSpec    string // Recurring tasks for the daemon command
+	reportsDir      string // Where the daemon writes task reports
+	deployEnv       string // Environment this run targets, for promotion checks
+	promotionOrder  string // Environments an artifact is promoted through, in order
+	promotionLedger string // File recording promoted artifacts
+	githubToken     string // Token for private GitHub release assets
+	baselineFile    string // Org-mandated minimum plugin versions
+	backupDir       string // Where the backup step keeps the previous plugin archive
+	accessLogPath   string // Access log of the controller or its reverse proxy, on the Jenkins host
+)
+
+// Run options
+var (
+	attempts    = flag.Int("attempts", 1, "Number of times to run the pipeline when it fails for a retryable reason")
+	cooldown    = flag.Duration("cooldown", time.Minute, "Pause between pipeline attempts")
+	busyCheck   = flag.Bool("busy-check", false, "Inspect recent build activity and defer restarts during busy hours")
+	ignoreBusy  = flag.Bool("ignore-busy", false, "Only warn when restarting during busy hours")
+	discardOld  = flag.Bool("discard-old-data", false, "Discard unreadable old data once the updated plugin is verified")
+	rollback    = flag.Bool("rollback-on-crash", true, "Restore the plugin backed up by this run and start Jenkins again when it crashes while coming up")
+	installWith = flag.String("install-with", "auto", "How to install the plugin: http uploads it to the plugin manager, cli runs jenkins-cli.jar and needs Java, auto picks what the controller allows")
 )
 
-func isPluginInstalled() (bool, error) {
-	url := fmt.Sprintf("%s/pluginManager/api/json?depth=1", jenkinsURL)
-	req, err := http.NewRequest("GET", url, nil)
+// crashWindow is how soon after launch an exiting Jenkins process counts as a
+// crash rather than a regular shutdown.
+const crashWindow = 60 * time.Second
+
+// startupPoll is how often waitForJenkins checks whether Jenkins is online.
+const startupPoll = 2 * time.Second
+
+// jenkinsProcess tracks the Jenkins JVM started by this run so waitForJenkins
+// can notice an early exit instead of polling HTTP until the timeout.
+type jenkinsProcess struct {
+	pid     int
+	started time.Time
+	exited  chan struct{}
+	err     error
+
+	done     chan struct{} // Closed by stop
+	stopOnce sync.Once
+}
+
+func newJenkinsProcess(pid int) *jenkinsProcess {
+	return &jenkinsProcess{pid: pid, started: time.Now(), exited: make(chan struct{}), done: make(chan struct{})}
+}
+
+// stop ends the watching of a remote process, which otherwise polls its
+// host for as long as the wrapper runs. exited is then never closed.
+func (p *jenkinsProcess) stop() {
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+var launched *jenkinsProcess
+
+// newJenkinsRequest builds an authenticated request for a path on the Jenkins server.
+func newJenkinsRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, jenkinsURL+path, body)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	req.SetBasicAuth(jenkinsUser, jenkinsToken)
+	return req, nil
+}
+
+// controller lets the jenkinswrapper pagination helpers use the configured
+// Jenkins and credentials.
+type controller struct{}
+
+func (controller) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return newJenkinsRequest(method, path, body)
+}
+
+// installedPlugin is a plugin as reported by the Jenkins plugin manager.
+type installedPlugin struct {
+	ShortName string `json:"shortName"`
+	Version   string `json:"version"`
+	Active    bool   `json:"active"`
+	Enabled   bool   `json:"enabled"`
+	Deleted   bool   `json:"deleted"` // Uninstalled, but stays loaded until the next restart
+	Bundled   bool   `json:"bundled"` // Shipped inside the Jenkins WAR
+
+	Dependencies []struct {
+		ShortName string `json:"shortName"`
+		Optional  bool   `json:"optional"`
+	} `json:"dependencies"`
+}
+
+// pluginState is where a plugin is in its install/uninstall lifecycle.
+type pluginState int
+
+const (
+	pluginAbsent         pluginState = iota
+	pluginActive                     // Installed and loaded
+	pluginInactive                   // Installed but not loaded (disabled, or waiting for a restart)
+	pluginPendingRemoval             // doUninstall was called; removed on the next restart
+)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (s pluginState) String() string {
+	switch s {
+	case pluginActive:
+		return "active"
+	case pluginInactive:
+		return "inactive"
+	case pluginPendingRemoval:
+		return "pending removal"
+	}
+	return "not installed"
+}
+
+func (p *installedPlugin) state() pluginState {
+	switch {
+	case p == nil:
+		return pluginAbsent
+	case p.Deleted:
+		return pluginPendingRemoval
+	case p.Active:
+		return pluginActive
+	}
+	return pluginInactive
+}
+
+// pluginsQuery asks the plugin manager for the fields of installedPlugin
+// only; depth=1 would return every plugin's full details.
+const pluginsQuery = "/pluginManager/api/json?tree=plugins[shortName,version,active,enabled,deleted,bundled,dependencies[shortName,optional]]"
+
+func listPlugins() ([]installedPlugin, error) {
+	req, err := newJenkinsRequest("GET", pluginsQuery, nil)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return false, fmt.Errorf("failed to check plugin status: %s", resp.Status)
+		return nil, newHTTPStatusError("failed to check plugin status", resp)
 	}
 
-	var result struct {
-		Plugins []struct {
-			ShortName string `json:"shortName"`
-		} `json:"plugins"`
-	}
+	var plugins []installedPlugin
+	err = streamJSONArray(resp, "plugins", func(p installedPlugin) error {
+		plugins = append(plugins, p)
+		return nil
+	})
+	return plugins, err
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
+// findPlugin returns the named plugin, or nil when it is not installed.
+func findPlugin(name string) (*installedPlugin, error) {
+	plugins, err := listPlugins()
+	if err != nil {
+		return nil, err
 	}
-
-	for _, plugin := range result.Plugins {
-		if plugin.ShortName == pluginName {
-			return true, nil
+	for i := range plugins {
+		if plugins[i].ShortName == name {
+			return &plugins[i], nil
 		}
 	}
-
-	return false, nil
+	return nil, nil
 }
 
 func uninstallPlugin() error {
-	installed, err := isPluginInstalled()
+	plugins, err := listPlugins()
 	if err != nil {
 		return err
 	}
-	if !installed {
-		fmt.Println("⚠️ Plugin is not installed, skipping uninstallation.")
+	var plugin *installedPlugin
+	for i := range plugins {
+		if plugins[i].ShortName == pluginName {
+			plugin = &plugins[i]
+		}
+	}
+	switch plugin.state() {
+	case pluginAbsent:
+		say("⚠️", "notInstalled")
+		return nil
+	case pluginPendingRemoval:
+		say("⏳", "alreadyPending")
 		return nil
 	}
+	if err := guardRemoval(plugin, plugins); err != nil {
+		return err
+	}
 
-	url := fmt.Sprintf("%s/pluginManager/plugin/%s/doUninstall", jenkinsURL, pluginName)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(nil))
+	req, err := newActionRequest(fmt.Sprintf("/pluginManager/plugin/%s/doUninstall", pluginName))
 	if err != nil {
 		return err
 	}
-	req.SetBasicAuth(jenkinsUser, jenkinsToken)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = withVerifier(req, func() bool {
+		p, err := findPlugin(pluginName)
+		return err == nil && p.state() != pluginActive && p.state() != pluginInactive
+	})
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 200 {
-		fmt.Println("✅ Plugin uninstalled successfully!")
+		say("✅", "uninstalled")
 	} else {
-		return fmt.Errorf("failed to uninstall plugin: %s", resp.Status)
+		return newHTTPStatusError("failed to uninstall plugin", resp)
 	}
 	return nil
 }
 
+// installPlugin uploads the plugin file through the plugin manager, the way
+// the Advanced page of Manage Plugins does, so the machine running the
+// wrapper needs no Java. jenkins-cli.jar is used when -install-with says so,
+// or when the controller only allows that.
 func installPlugin() error {
-	cmd := exec.Command("java", "-jar", jenkinsCLIPath, "-s", jenkinsURL, "-auth", fmt.Sprintf("%s:%s", jenkinsUser, jenkinsToken), "install-plugin", fmt.Sprintf("file:///%s", pluginPath))
+	mechanism, err := installMechanism()
+	if err != nil {
+		return err
+	}
+	if mechanism == "cli" {
+		return installPluginWithCLI()
+	}
+	if dryRunning("upload %s to %s/pluginManager/uploadPlugin", pluginPath, jenkinsURL) {
+		return nil
+	}
+	// Older cores take the short name from the file name, not the manifest
+	open, contentType := multipartFile("name", pluginName+".hpi", pluginPath)
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	req, err := newJenkinsRequest("POST", "/pluginManager/uploadPlugin", body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.GetBody = open // Lets a retry send the archive again
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Success redirects to the update center page
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%w: %v", errInstallFailed, newHTTPStatusError("upload to the plugin manager failed", resp))
+	}
+	say("✅", "installed")
+	return nil
+}
+
+// multipartFile streams the file at path as the field of a multipart form,
+// so the archive is never held in memory. Each call of open starts the
+// stream over from a freshly opened file.
+func multipartFile(field, filename, path string) (open func() (io.ReadCloser, error), contentType string) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	open = func() (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, w := io.Pipe()
+		go func() {
+			defer f.Close()
+			form := multipart.NewWriter(w)
+			err := form.SetBoundary(boundary)
+			var part io.Writer
+			if err == nil {
+				part, err = form.CreateFormFile(field, filename)
+			}
+			if err == nil {
+				_, err = io.Copy(part, f)
+			}
+			if err == nil {
+				err = form.Close()
+			}
+			w.CloseWithError(err)
+		}()
+		return r, nil
+	}
+	return open, "multipart/form-data; boundary=" + boundary
+}
+
+func installPluginWithCLI() error {
+	if err := ensureCLIJar(); err != nil {
+		return fmt.Errorf("%w: no jenkins-cli.jar: %v", errInstallFailed, err)
+	}
+	cmd := exec.Command("java", "-jar", jenkinsCLIPath, "-s", jenkinsURL, "install-plugin", fmt.Sprintf("file:///%s", pluginPath))
+	cmd.Env = cliEnv()
+	if err := checkNoSecrets(cmd.Args, jenkinsToken); err != nil {
+		return err
+	}
+	if err := checkLaunch("jenkins-cli"); err != nil {
+		return err
+	}
+	if dryRunning("run %s", strings.Join(cmd.Args, " ")) || simulated("run %s", strings.Join(cmd.Args, " ")) {
+		return nil
+	}
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("command execution failed: %v\nOutput: %s", err, output)
+		return fmt.Errorf("%w: %v\nOutput: %s", errInstallFailed, err, output)
 	}
 
-	fmt.Println("✅ Plugin installed successfully!")
-	fmt.Println(string(output))
+	say("✅", "installed")
+	printOutput(string(output))
 	return nil
 }
 
 func stopJenkins() error {
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/exit", jenkinsURL), nil)
-	if err != nil {
+	if err := lifecycle("/exit"); err != nil {
 		return err
 	}
-	req.SetBasicAuth(jenkinsUser, jenkinsToken)
+	say("🛑", "shuttingDown")
+	return nil
+}
+
+func quietDown() error {
+	return lifecycle("/quietDown")
+}
+
+func cancelQuietDown() error {
+	return lifecycle("/cancelQuietDown")
+}
+
+func safeRestart() error {
+	return lifecycle("/safeRestart")
+}
+
+// reloadConfiguration makes Jenkins re-read its configuration from
+// JENKINS_HOME, picking up external edits without a restart.
+func reloadConfiguration() error {
+	return lifecycle("/reload")
+}
+
+func startJenkins() error {
+	forgetControllerVersion() // The WAR may be a different core
+	if err := checkLocalPlugin(); err != nil {
+		notify("⚠️", "Could not inspect JENKINS_HOME: %v", err)
+	}
 
-	resp, err := client.Do(req)
+	args, secrets, err := jenkinsArgs()
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	var env []string
+	if jenkinsHome != "" {
+		if err := prepareHome(); err != nil {
+			return err
+		}
+		env = append(env, "JENKINS_HOME="+jenkinsHome)
+		// The WAR unpacks to ~/.jenkins/war by default, shared by all instances
+		if !strings.Contains(jenkinsOptions, "--webroot") {
+			args = append(args, "--webroot="+filepath.Join(jenkinsHome, "war"))
+		}
+	}
+	if *remoteHost == "" && !simulated("verify %s", jenkinsWarPath) { // Otherwise the WAR is on the Jenkins host
+		if err := verifyWar(jenkinsWarPath); err != nil {
+			return err
+		}
+	}
+	java := []string{"java"}
+	if *loadTimes {
+		java = append(java, startupPerformance)
+	}
+	args = append(append(java, "-jar", jenkinsWarPath), args...)
+	if err := checkNoSecrets(args, append(secrets, jenkinsToken)...); err != nil {
+		return err
+	}
 
-	if resp.StatusCode == 200 {
-		fmt.Println("🛑 Jenkins is shutting down...")
-	} else {
-		fmt.Printf("❌ Failed to stop Jenkins: %s\n", resp.Status)
+	if launched != nil {
+		launched.stop() // Replaced by the new one
 	}
+	if launched, err = target.start(args, env, jenkinsLogPath); err != nil {
+		return err
+	}
+
+	say("🚀", "started")
 	return nil
 }
 
-func startJenkins() error {
-	cmd := exec.Command("cmd", "/C", "start", "java", "-jar", jenkinsWarPath)
-	err := cmd.Start()
+// crashError describes a Jenkins process that exited while we were waiting
+// for it to come online, including the end of its console log.
+func crashError(p *jenkinsProcess) error {
+	uptime := time.Since(p.started).Round(time.Second)
+	tail, _ := tailFile(jenkinsLogPath, 20)
+	if uptime <= crashWindow {
+		return &processCrashError{fmt.Sprintf("jenkins crashed %s after launch (%v)\nLast log lines:\n%s", uptime, p.err, tail)}
+	}
+	return &processCrashError{fmt.Sprintf("jenkins exited unexpectedly after %s (%v)\nLast log lines:\n%s", uptime, p.err, tail)}
+}
+
+// rollbackAfterCrash restores the plugin backed up by this run and starts
+// Jenkins again, so a plugin that crashes Jenkins does not leave it down.
+// The run still fails with crash. It rolls back once: a Jenkins that crashes
+// with the previous plugin too is left to the operator.
+func rollbackAfterCrash(crash error) error {
+	if !*rollback || !backedUp || rolledBack {
+		return crash
+	}
+	rolledBack = true
+	notify("⏪", "Jenkins crashed, rolling back %s", pluginName)
+	if err := restorePlugin(); err != nil {
+		return fmt.Errorf("%w\nrollback failed: %v", crash, err)
+	}
+	if err := startJenkins(); err != nil {
+		return fmt.Errorf("%w\nrestored the previous %s, but Jenkins did not start: %v", crash, pluginName, err)
+	}
+	if err := waitForJenkins(); err != nil {
+		return fmt.Errorf("%w\nrestored the previous %s, but Jenkins did not come up: %v", crash, pluginName, err)
+	}
+	return fmt.Errorf("%w\nrolled back to the previous %s", crash, pluginName)
+}
+
+// tailFile returns the last n lines of the file at path on the Jenkins host.
+func tailFile(path string, n int) (string, error) {
+	data, err := target.readFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to start Jenkins: %v", err)
+		return "", err
 	}
-	fmt.Println("🚀 Jenkins started successfully.")
-	return nil
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n"), nil
 }
 
 func waitForJenkins() error {
-	fmt.Println("⏳ Waiting for Jenkins to restart...")
+	say("⏳", "waiting")
 
-	retries := 30 // Maximum wait time: 30 seconds
+	var exited <-chan struct{}
+	if launched != nil {
+		exited = launched.exited
+	}
+
+	limit, err := settingDuration("startup-wait", startupWait)
+	if err != nil {
+		return err
+	}
+	// Polled every 2 seconds, so at most -startup-wait in all
+	retries := max(1, int((limit+startupPoll-1)/startupPoll))
 	for i := 0; i < retries; i++ {
-		resp, err := http.Get(jenkinsURL + "/login")
-		if err == nil && resp.StatusCode == 200 {
-			fmt.Println("✅ Jenkins is back online!")
+		resp, err := pollClient.Get(jenkinsURL + "/login")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == 200 {
+				say("✅", "online")
+				return nil
+			}
+		}
+		say("🔄", "waitingAttempt", i+1, retries)
+
+		// Wait before retrying, but bail out as soon as the process dies
+		select {
+		case <-exited:
+			return rollbackAfterCrash(crashError(launched))
+		case <-time.After(startupPoll):
+		}
+	}
+	return errRestartTimeout
+}
+
+// waitForShutdown polls until Jenkins stops answering after a stop, at most
+// -shutdown-wait, instead of sleeping a fixed time that is too short on slow
+// machines and wasted on fast ones. A reverse proxy may keep answering for a
+// controller that is down, so running out of time only warns; starting a
+// Jenkins that is still up fails on its own.
+func waitForShutdown() error {
+	limit, err := settingDuration("shutdown-wait", shutdownWait)
+	if err != nil {
+		return err
+	}
+	if dryRunning("wait up to %s for Jenkins to shut down", limit) {
+		return nil
+	}
+	var exited <-chan struct{}
+	if launched != nil {
+		exited = launched.exited
+	}
+	deadline := time.After(limit)
+	for {
+		resp, err := pollClient.Get(jenkinsURL + "/login")
+		if err != nil {
+			return nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout {
+			return nil // The proxy in front has lost the controller
+		}
+		select {
+		case <-exited:
+			return nil
+		case <-deadline:
+			notify("⚠️", "Jenkins still answers after -shutdown-wait %s, going on", limit)
 			return nil
+		case <-time.After(time.Second):
 		}
-		fmt.Printf("🔄 Waiting... (%d/%d)\n", i+1, retries)
-		time.Sleep(2 * time.Second) // Wait 2 seconds before retrying
 	}
-	return fmt.Errorf("jenkins did not restart in time")
 }
 
-func main() {
-	fmt.Println("🔄 Starting Jenkins plugin update process...")
+// verifyInstallation checks the plugin after a restart. A plugin that is still
+// pending removal means the restart never actually happened.
+func verifyInstallation() error {
+	plugin, err := findPlugin(pluginName)
+	if err != nil {
+		return errors.New(msg("errCheckInstall", err))
+	}
+	switch plugin.state() {
+	case pluginAbsent:
+		return errors.New(msg("errNotInstalled", pluginName, describeLocalPlugin()))
+	case pluginPendingRemoval:
+		return errors.New(msg("errStillPending", pluginName))
+	case pluginInactive:
+		return errors.New(msg("errInactive", pluginName, plugin.Version, describeLocalPlugin()))
+	}
+	say("🎉", "verified", pluginName, plugin.Version)
+	return nil
+}
 
-	// Step 1: Uninstall the old plugin if it exists
-	fmt.Println("🛑 Checking if plugin exists...")
-	if err := uninstallPlugin(); err != nil {
-		fmt.Println("Error:", err)
-		return
+// configuredPipeline returns the steps of a full update: the default pipeline,
+// or the custom one from pipelineSteps, with the optional extras the flags
+// ask for that it does not have yet.
+func configuredPipeline() ([]string, error) {
+	steps := slices.Clone(defaultPipeline)
+	if pipelineSteps != "" {
+		var err error
+		if steps, err = parsePipeline(pipelineSteps); err != nil {
+			return nil, err
+		}
+	}
+	extras := []struct {
+		enabled bool
+		step    string
+	}{
+		{*discardOld, "discardOldData"},
+		{*replayJob != "", "replay"},
+		{*loadTimes, "loadTimes"},
+	}
+	for _, extra := range extras {
+		if extra.enabled && !slices.Contains(steps, extra.step) {
+			steps = append(steps, extra.step)
+		}
 	}
+	return steps, nil
+}
 
-	time.Sleep(5 * time.Second)
+// run executes a pipeline, recording each step in the run report.
+func run(steps []string) error {
+	if deployEnv != "" {
+		if err := eachPlugin(checkPromotion); err != nil {
+			return err
+		}
+	}
 
-	fmt.Println("⬆️ Uploading new plugin...")
-	if err := installPlugin(); err != nil {
-		fmt.Println("Error:", err)
-		return
+	steps = skipSteps(steps)
+	if *benchEnabled {
+		benchBaseline()
+	}
+	if err := runPipeline(steps); err != nil {
+		return err
+	}
+	if *benchEnabled {
+		report.step("bench", benchCompare)
 	}
+	say("🎉", "completed")
+	return nil
+}
 
-	// Step 2: Stop Jenkins using API
-	fmt.Println("🛑 Stopping Jenkins...")
-	if err := stopJenkins(); err != nil {
-		fmt.Println("Error:", err)
-		return
+// ensureJenkinsURL discovers a local Jenkins when no URL is configured.
+func ensureJenkinsURL() error {
+	if jenkinsURL != "" {
+		return nil
 	}
+	return discoverJenkinsURL()
+}
 
-	// Wait for Jenkins to shut down completely
-	time.Sleep(10 * time.Second)
+func main() {
+	os.Exit(runMain())
+}
 
-	// Step 3: Start Jenkins
-	fmt.Println("🚀 Starting Jenkins...")
-	if err := startJenkins(); err != nil {
-		fmt.Println("Error:", err)
-		return
+// runMain runs the wrapper and returns its exit code; it is separate from
+// main so deferred cleanup runs before the process exits.
+func runMain() (code int) {
+	flag.Parse()
+	jenkinswrapper.MaxPageBytes = *maxResponseSize
+	setHTTPTimeouts()
+	report.CorrelationID = runCorrelationID()
+	setLanguage()
+	if err := setupSinks(); err != nil {
+		printError(err)
+		return exitUsage
+	}
+	defer closeSinks()
+	if cm != nil {
+		defer func() { code = cm.finish(code) }()
+	}
+	if err := loadSettings(); err != nil {
+		printError(err)
+		return exitUsage
+	}
+	loadExtensions()
+	if err := resolveSecrets(); err != nil {
+		printError(err)
+		return exitUsage
+	}
+	if err := setupExecutor(); err != nil {
+		printError(err)
+		return exitUsage
+	}
+	if err := setupSimulation(); err != nil {
+		printError(err)
+		return exitCode(err)
 	}
 
-	fmt.Println("🎉 Plugin update process completed successfully!")
-
-	// Wait for Jenkins to restart
-	if err := waitForJenkins(); err != nil {
-		fmt.Println("Error:", err)
-		return
+	var err error
+	if ws, err = newWorkspace(); err != nil {
+		printError(err)
+		return exitFailure
+	}
+	defer ws.cleanup()
+	ws.cleanupOnSignal()
+
+	// Without a command, do what the wrapper always did: a full update
+	args := flag.Args()
+	switch {
+	case *showVersion:
+		args = []string{"version"}
+	case len(args) == 0:
+		args = []string{"update"}
 	}
+	if err := runCommand(args); err != nil {
+		printError(err)
+		return exitCode(err)
+	}
+	return exitOK
+}
 
-	// Step 4: Check if the plugin is successfully installed
-	time.Sleep(10 * time.Second)
-	installed, err := isPluginInstalled()
-	if err != nil {
-		fmt.Println("Error checking installation:", err)
-	} else if installed {
-		fmt.Println("🎉 Plugin successfully installed!")
-	} else {
-		fmt.Println("❌ Plugin installation failed!")
+// pipelineCommand returns a command running the given steps, or the
+// configured pipeline when steps is nil. Retryable failures are retried per
+// -attempts, and a final failure leaves a support bundle behind.
+func pipelineCommand(steps []string) func(args []string) error {
+	return func(args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+		}
+		if err := ensureJenkinsURL(); err != nil {
+			return err
+		}
+		if err := resolvePluginSource(); err != nil {
+			return err
+		}
+		// Worked out on every call: the closure is reused by the daemon,
+		// watch and tui, and the configuration may change in between
+		steps := steps
+		if steps == nil {
+			var err error
+			if steps, err = configuredPipeline(); err != nil {
+				return err
+			}
+		}
+		// Only what the -skip-* options leave has to be configured
+		if err := validateSettings(skipSteps(steps)); err != nil {
+			return err
+		}
+		steps, err := checkCapabilities(steps)
+		if err != nil {
+			return err
+		}
+		installs := slices.Contains(steps, "install")
+		if installs && !*resume {
+			by, done, err := alreadyDeployed()
+			if err != nil {
+				return err
+			}
+			if done {
+				notify("✅", "%s is already at the desired state (%s), nothing to do; use -redeploy to deploy anyway", pluginName, by)
+				return nil
+			}
+		}
+		todo, err := startCheckpoint(steps)
+		if err != nil {
+			return err
+		}
+
+		say("🔄", "starting")
+		backedUp, rolledBack = false, false
+
+		started := 0 // Steps done before this run, when resuming
+		if checkpoint != nil {
+			started = checkpoint.Done
+		}
+		for attempt := 1; ; attempt++ {
+			report.attempt = attempt
+			checkpoint.rewind(started) // Each attempt runs todo from its start
+			if err = run(todo); err == nil || attempt >= *attempts || !isRetryable(err) {
+				break
+			}
+			say("🔁", "attemptFailed", attempt, *attempts, categorize(err), err)
+			say("⏳", "retrying", *cooldown)
+			time.Sleep(*cooldown)
+		}
+
+		if err != nil && !errors.Is(err, errNotConfirmed) {
+			if bundle, bundleErr := writeSupportBundle(err); bundleErr != nil {
+				say("⚠️", "bundleFailed", bundleErr)
+			} else {
+				say("📦", "bundleWritten", bundle)
+			}
+		}
+		if err == nil && (installs || len(batch) > 0) {
+			if recordErr := eachPlugin(recordDeployment); recordErr != nil {
+				notify("⚠️", "Cannot record the deployment in %s: %v", runHistory, recordErr)
+			}
+		}
+		if launched != nil {
+			launched.stop() // Left running; nothing waits on it any more
+		}
+		checkpoint.finish(err)
+		publishRun(report)
+		return err
 	}
 }
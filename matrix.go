@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"Golang/jenkinswrapper"
+)
+
+const warDownloadURL = "https://get.jenkins.io/%s/%s/jenkins.war"
+
+// downloadFile saves url to path through a temporary file, so an interrupted
+// download never leaves a truncated file in the cache. Unlike API responses,
+// downloads are not subject to -max-response-size.
+func downloadFile(url, path string) error {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newHTTPStatusError("failed to download "+url, resp)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil { // Not CreateTemp's 0600
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// coreWar returns a jenkins.war of the given core version from the artifact
+// cache, downloading and checksumming it on first use.
+func coreWar(version string) (string, error) {
+	if version == "" || strings.Contains(version, "..") || strings.ContainsAny(version, `/\`) {
+		return "", fmt.Errorf("invalid Jenkins version %q", version)
+	}
+	dir, err := artifactDir("wars", "jenkins", version)
+	if err != nil {
+		return "", err
+	}
+	if path, ok := cachedArtifact(dir, "jenkins.war", ""); ok {
+		return path, nil
+	}
+
+	channel := "war"
+	if strings.Count(version, ".") == 2 {
+		channel = "war-stable"
+	}
+	notify("⬇️", "Downloading Jenkins %s...", version)
+	want, err := officialWarChecksum(version)
+	if err != nil {
+		return "", err
+	}
+	return storeArtifact(dir, "jenkins.war", want, func(path string) error {
+		return downloadFile(fmt.Sprintf(warDownloadURL, channel, url.PathEscape(version)), path)
+	})
+}
+
+// matrixDependencies downloads the required dependencies of a plugin at the
+// minimum versions it declares, which is what it is built and tested against.
+func matrixDependencies(manifest *pluginManifest) ([]string, error) {
+	if len(manifest.Dependencies) == 0 {
+		return nil, nil
+	}
+	uc, err := fetchUpdateCenter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %v", err)
+	}
+	graph, err := resolveDependencies(uc, manifest.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, name := range sortedKeys(graph.Versions) {
+		path, err := cachedPlugin(name, graph.Versions[name], "")
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// matrixProbe checks that the plugin was loaded and, given a script, that the
+// script runs without an exception.
+func matrixProbe(j *jenkinswrapper.Instance, plugin, script string) error {
+	var state struct {
+		Plugins []installedPlugin `json:"plugins"`
+	}
+	req, err := j.NewRequest("GET", pluginsQuery, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := decodeJSON(resp, &state); err != nil {
+		return err
+	}
+	loaded := false
+	for _, p := range state.Plugins {
+		if p.ShortName == plugin {
+			if p.state() != pluginActive {
+				return fmt.Errorf("%s %s is %s", plugin, p.Version, p.state())
+			}
+			loaded = true
+		}
+	}
+	if !loaded {
+		return fmt.Errorf("%s was not loaded", plugin)
+	}
+	if script == "" {
+		return nil
+	}
+
+	groovy, err := os.ReadFile(script)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"script": {string(groovy)}}
+	req, err = j.NewRequest("POST", "/scriptText", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(limitBody(resp))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 || strings.Contains(string(out), "Exception") {
+		return fmt.Errorf("probe script failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// testMatrixCommand boots each core version in a sandbox with the plugin and
+// its dependencies, probes it and prints a compatibility matrix.
+func testMatrixCommand(args []string) error {
+	fs := flag.NewFlagSet("test-matrix", flag.ContinueOnError)
+	plugin := fs.String("plugin", pluginPath, "Plugin file to test")
+	cores := fs.String("cores", "", "Comma-separated Jenkins core versions, e.g. 2.426.3,2.440.3")
+	script := fs.String("script", "", "Groovy probe to run on each core; it fails on any exception")
+	timeout := fs.Duration("startup-timeout", 5*time.Minute, "How long each core may take to start")
+	mirror := fs.Bool("mirror", false, "Use the caching update center of the mirror command as update site")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *plugin == "" || *cores == "" {
+		return fmt.Errorf("usage: test-matrix -plugin my.hpi -cores 2.426.3,2.440.3")
+	}
+	manifest, err := readPluginManifest(*plugin)
+	if err != nil {
+		return err
+	}
+	deps, err := matrixDependencies(manifest)
+	if err != nil {
+		return err
+	}
+
+	updateSite := ""
+	if *mirror {
+		updateSite = sandboxUpdateSite(false)
+	}
+
+	type row struct{ core, result, detail string }
+	var rows []row
+	failed := 0
+	for _, core := range strings.Split(*cores, ",") {
+		core = strings.TrimSpace(core)
+		if manifest.CoreVersion != "" && compareVersions(core, manifest.CoreVersion) < 0 {
+			rows = append(rows, row{core, "skipped", "plugin requires Jenkins " + manifest.CoreVersion})
+			continue
+		}
+		err := testCore(core, *plugin, manifest.ShortName, deps, *script, *timeout, updateSite)
+		if err != nil {
+			failed++
+			rows = append(rows, row{core, "FAIL", strings.SplitN(err.Error(), "\n", 2)[0]})
+			notify("❌", "Jenkins %s: %v", core, err)
+		} else {
+			rows = append(rows, row{core, "ok", ""})
+			notify("✅", "Jenkins %s: %s %s works", core, manifest.ShortName, manifest.Version)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "CORE\t%s %s\n", manifest.ShortName, manifest.Version)
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.core, r.result, r.detail)
+	}
+	w.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%s failed on %d of %d cores", manifest.ShortName, failed, len(rows))
+	}
+	return nil
+}
+
+func testCore(core, plugin, name string, deps []string, script string, timeout time.Duration, updateSite string) error {
+	war, err := coreWar(core)
+	if err != nil {
+		return err
+	}
+	if err := checkLaunch("java"); err != nil {
+		return err
+	}
+	notify("🚀", "Starting Jenkins %s...", core)
+	j, err := jenkinswrapper.Start(jenkinswrapper.Options{
+		WarPath:        war,
+		Plugins:        append(append([]string(nil), deps...), plugin),
+		StartupTimeout: timeout,
+		UpdateSite:     updateSite,
+	})
+	if err != nil {
+		return err
+	}
+	defer j.Stop()
+	return matrixProbe(j, name, script)
+}
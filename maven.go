@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Maven repository the plugin is resolved from with -pluginGAV, and the
+// credentials it takes, e.g. of an Artifactory or Nexus user
+var (
+	pluginGAV     string // groupId:artifactId[:version] of the plugin
+	mavenRepo     string
+	mavenUser     string
+	mavenPassword string
+)
+
+// mavenMetadata is the part of maven-metadata.xml that resolves versions.
+type mavenMetadata struct {
+	Versioning struct {
+		Release  string `xml:"release"`
+		Snapshot struct {
+			Timestamp   string `xml:"timestamp"`
+			BuildNumber string `xml:"buildNumber"`
+		} `xml:"snapshot"`
+	} `xml:"versioning"`
+}
+
+// mavenRepository is a Maven repository plugins are downloaded from.
+type mavenRepository struct {
+	url, user, password string
+}
+
+// configuredMavenRepo is the repository of -pluginGAV.
+func configuredMavenRepo() mavenRepository {
+	return mavenRepository{mavenRepo, mavenUser, mavenPassword}
+}
+
+func (r mavenRepository) newRequest(path string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(r.url, "/")+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.user != "" {
+		req.SetBasicAuth(r.user, r.password)
+	}
+	return req, nil
+}
+
+// get fetches a file of the repository into memory.
+func (r mavenRepository) get(path string) ([]byte, error) {
+	req, err := r.newRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newHTTPStatusError("failed to fetch "+path+" from "+r.url, resp)
+	}
+	return io.ReadAll(limitBody(resp))
+}
+
+func (r mavenRepository) metadata(path string) (*mavenMetadata, error) {
+	data, err := r.get(path + "/maven-metadata.xml")
+	if err != nil {
+		return nil, err
+	}
+	var m mavenMetadata
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s/maven-metadata.xml: %v", path, err)
+	}
+	return &m, nil
+}
+
+// fetchMavenPlugin downloads the .hpi of groupId:artifactId[:version] from
+// -maven-repo into the run workspace. Without a version the latest release
+// is taken; a SNAPSHOT resolves to its latest timestamped build. The file is
+// checked against the SHA-1 the repository keeps next to it.
+func fetchMavenPlugin(gav string) (string, error) {
+	return configuredMavenRepo().fetchPlugin(gav)
+}
+
+// fetchPlugin downloads the .hpi of groupId:artifactId[:version].
+func (r mavenRepository) fetchPlugin(gav string) (string, error) {
+	parts := strings.Split(gav, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", usageError{fmt.Errorf("invalid -pluginGAV %q, expected groupId:artifactId[:version]", gav)}
+	}
+	group, artifact, version := parts[0], parts[1], ""
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	dir := strings.ReplaceAll(group, ".", "/") + "/" + artifact
+	if version == "" {
+		m, err := r.metadata(dir)
+		if err != nil {
+			return "", err
+		}
+		if version = m.Versioning.Release; version == "" {
+			return "", fmt.Errorf("%s has no release in %s", gav, r.url)
+		}
+	}
+	file := artifact + "-" + version + ".hpi"
+	if base, ok := strings.CutSuffix(version, "-SNAPSHOT"); ok {
+		m, err := r.metadata(dir + "/" + version)
+		if err != nil {
+			return "", err
+		}
+		if s := m.Versioning.Snapshot; s.Timestamp != "" {
+			file = fmt.Sprintf("%s-%s-%s-%s.hpi", artifact, base, s.Timestamp, s.BuildNumber)
+		}
+	}
+	path := dir + "/" + version + "/" + file
+
+	sum, err := r.get(path + ".sha1")
+	if err != nil {
+		return "", err
+	}
+	want, _, _ := strings.Cut(strings.TrimSpace(string(sum)), " ")
+
+	notify("⬇️", "Downloading %s:%s:%s from %s...", group, artifact, version, r.url)
+	req, err := r.newRequest(path)
+	if err != nil {
+		return "", err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError("failed to download "+file, resp)
+	}
+	dest := ws.path(downloadsDir, file)
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to download %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return "", fmt.Errorf("checksum mismatch for %s: the repository says %s, downloaded file is %s", file, want, got)
+	}
+	return dest, nil
+}
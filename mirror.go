@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var mirrorAddr = flag.String("mirror-addr", "127.0.0.1:8089", "Where the mirror command serves its caching update center")
+
+const (
+	// mirrorRefresh is how long the mirror serves its update center copy
+	// before checking upstream for a new one.
+	mirrorRefresh = 10 * time.Minute
+)
+
+// mirrorURL is the update site sandbox instances use with -mirror.
+func mirrorURL() string {
+	return "http://" + *mirrorAddr + "/update-center.json"
+}
+
+// updateMirror serves update-center.json with plugin downloads pointing back
+// at itself, and keeps every plugin it hands out in the wrapper cache (shared
+// with test-matrix), so sandboxes download each plugin version only once.
+type updateMirror struct {
+	mu        sync.Mutex
+	refreshed time.Time
+	dataPath  string
+}
+
+func (m *updateMirror) updateCenter() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dataPath == "" || time.Since(m.refreshed) > mirrorRefresh {
+		path, err := refreshUpdateCenter()
+		if err != nil && m.dataPath == "" {
+			return "", err
+		}
+		if err == nil {
+			m.dataPath, m.refreshed = path, time.Now()
+		}
+	}
+	return m.dataPath, nil
+}
+
+func (m *updateMirror) serveUpdateCenter(w http.ResponseWriter, r *http.Request) {
+	path, err := m.updateCenter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var uc map[string]any
+	if err := json.Unmarshal(data, &uc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	plugins, _ := uc["plugins"].(map[string]any)
+	for _, p := range plugins {
+		if plugin, ok := p.(map[string]any); ok {
+			name, _ := plugin["name"].(string)
+			version, _ := plugin["version"].(string)
+			if name != "" && version != "" {
+				plugin["url"] = fmt.Sprintf("http://%s/download/plugins/%s/%s/%s.hpi", r.Host, url.PathEscape(name), url.PathEscape(version), url.PathEscape(name))
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uc)
+}
+
+// servePlugin answers /download/plugins/NAME/VERSION/NAME.hpi from the cache,
+// fetching it from upstream on first request.
+func (m *updateMirror) servePlugin(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/download/plugins/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[0]+parts[1], "..") {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := cachedPlugin(parts[0], parts[1], "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// mirrorCommand runs the caching update center mirror until interrupted.
+func mirrorCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: mirror (set the address with -mirror-addr)")
+	}
+	if _, err := updateCenterSource(); err != nil {
+		return err
+	}
+	m := &updateMirror{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update-center.json", m.serveUpdateCenter)
+	mux.HandleFunc("/download/plugins/", m.servePlugin)
+	notify("🪞", "Serving update center mirror at %s", mirrorURL())
+	return http.ListenAndServe(*mirrorAddr, mux)
+}
+
+// sandboxUpdateSite returns the mirror's update site, warning when no mirror
+// is running yet (the instance still starts and uses it once it is) or when a
+// container could not reach it: a container reaches the host through its
+// gateway, which a mirror listening on loopback does not answer.
+func sandboxUpdateSite(container bool) string {
+	if host, port, err := net.SplitHostPort(*mirrorAddr); container && err == nil {
+		if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+			notify("⚠️", "The mirror at %s only listens on loopback, which the container cannot reach; serve it on e.g. -mirror-addr 0.0.0.0:%s", *mirrorAddr, port)
+		}
+	}
+	if resp, err := pollClient.Head(mirrorURL()); err == nil {
+		resp.Body.Close()
+	} else {
+		notify("⚠️", "No mirror is answering at %s, start one with the mirror command", *mirrorAddr)
+	}
+	return mirrorURL()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// activeMonitorsScript lists the administrative monitors currently shown in
+// Manage Jenkins, one "id<TAB>name" per line.
+const activeMonitorsScript = `jenkins.model.Jenkins.get().administrativeMonitors.each { m ->
+  try {
+    if (m.isEnabled() && m.isActivated()) println(m.id + "\t" + m.displayName)
+  } catch (Throwable ignored) {}
+}`
+
+// monitorsBefore holds the monitors active before the pipeline changed
+// anything, keyed by id.
+var monitorsBefore map[string]string
+
+func activeMonitors() (map[string]string, error) {
+	out, err := runScript(activeMonitorsScript)
+	if err != nil {
+		return nil, err
+	}
+	monitors := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if id, name, ok := strings.Cut(line, "\t"); ok {
+			monitors[id] = name
+		}
+	}
+	return monitors, nil
+}
+
+// snapshotMonitors records the monitors active before the update.
+func snapshotMonitors() {
+	var err error
+	if monitorsBefore, err = activeMonitors(); err != nil {
+		notify("⚠️", "Could not read administrative monitors: %v", err)
+	}
+}
+
+// reportNewMonitors adds the monitors that became active during the run to
+// the run report. Plugin updates often trigger deprecation, security or old
+// data warnings that nobody looks at until much later.
+func reportNewMonitors() error {
+	after, err := activeMonitors()
+	if err != nil {
+		notify("⚠️", "Could not read administrative monitors: %v", err)
+		return nil
+	}
+	for _, id := range sortedKeys(after) {
+		if _, seen := monitorsBefore[id]; seen {
+			continue
+		}
+		report.NewMonitors = append(report.NewMonitors, fmt.Sprintf("%s (%s)", after[id], id))
+		notify("⚠️", "New administrative monitor: %s (%s)", after[id], id)
+	}
+	if len(report.NewMonitors) == 0 {
+		notify("✅", "No new administrative monitors")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// oldDataCountScript prints how many objects the Old Data monitor tracks.
+const oldDataCountScript = `println(hudson.diagnosis.OldDataMonitor.get(jenkins.model.Jenkins.get()).data.size())`
+
+func oldDataCount() (int, error) {
+	out, err := runScript(oldDataCountScript)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected Old Data monitor output: %q", out)
+	}
+	return n, nil
+}
+
+// discardOldData presses "Discard Unreadable Data" on the Old Data monitor,
+// re-saving configuration files so fields of removed or changed plugins are
+// dropped. It runs at the end of the pipeline, after the plugin was verified.
+func discardOldData() error {
+	before, err := oldDataCount()
+	if err != nil {
+		return err
+	}
+	if before == 0 {
+		notify("✅", "No old data to discard")
+		return nil
+	}
+
+	if err := postAction("/administrativeMonitor/OldData/discard"); err != nil {
+		return err
+	}
+
+	after, err := oldDataCount()
+	if err != nil {
+		return err
+	}
+	notify("🧹", "Discarded old data from %d of %d objects", before-after, before)
+	if after > 0 {
+		notify("⚠️", "%d objects still have old data that needs a manual upgrade in Manage Jenkins", after)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	plain        = flag.Bool("plain", false, "Plain text output: no emoji, every line prefixed with a stable level word")
+	outputFormat = flag.String("output", "text", "Console output format: text, json for one JSON record per step and status line, or cm for a single JSON object with changed, actions and diff for config management tools, exiting 10 when it changed something")
+	quiet        = flag.Bool("quiet", false, "Only print errors on the console, e.g. for cron jobs")
+	verbose      = flag.Bool("v", false, "Verbose: also print every HTTP request to Jenkins")
+	veryVerbose  = flag.Bool("vv", false, "Very verbose: -v plus request and response headers")
+)
+
+// verbosity is -1 with -quiet, 0 by default, 1 with -v and 2 with -vv.
+func verbosity() int {
+	switch {
+	case *quiet:
+		return -1
+	case *veryVerbose:
+		return 2
+	case *verbose:
+		return 1
+	}
+	return 0
+}
+
+// iconLevels maps status icons to the level words used in -plain mode and by
+// the log sinks. Everything else is informational.
+var iconLevels = map[string]string{
+	"⚠️": "WARNING",
+	"❌":  "ERROR",
+	"✅":  "OK",
+	"🎉":  "OK",
+}
+
+// event is one status line of a run, delivered to every configured sink.
+type event struct {
+	Time   time.Time
+	Level  string // ERROR, WARNING, OK, INFO or DEBUG
+	Prefix string // Icon or label shown before the text on the console
+	Text   string
+}
+
+// emit sends a status line to all sinks.
+func emit(icon, text string) {
+	level, ok := iconLevels[icon]
+	if !ok {
+		level = "INFO"
+	}
+	publish(event{Time: time.Now(), Level: level, Prefix: icon, Text: text})
+}
+
+// say prints a status line with a catalog message.
+func say(icon, key string, args ...any) {
+	emit(icon, msg(key, args...))
+}
+
+// notify prints a status line that is not (yet) in the message catalog.
+func notify(icon, format string, args ...any) {
+	emit(icon, fmt.Sprintf(format, args...))
+}
+
+// debug prints a DEBUG status line when the verbosity is at least level.
+func debug(level int, format string, args ...any) {
+	if verbosity() >= level {
+		publish(event{Time: time.Now(), Level: "DEBUG", Prefix: "🐛", Text: fmt.Sprintf(format, args...)})
+	}
+}
+
+// printError reports a fatal error.
+func printError(err error) {
+	publish(event{Time: time.Now(), Level: "ERROR", Prefix: msg("error"), Text: err.Error()})
+}
+
+// printOutput passes through output of an external command.
+func printOutput(text string) {
+	publish(event{Time: time.Now(), Level: "INFO", Text: text})
+}
+
+// console is where the console sinks write: stdout, or stderr for commands
+// whose result goes to stdout, so status lines do not end up in it.
+var console io.Writer = os.Stdout
+
+// consoleSink writes events to the console. In -plain mode the icon is replaced by
+// the level word, repeated on every line of multi-line text so each line
+// stands alone. With -quiet only errors get through.
+type consoleSink struct{}
+
+func (consoleSink) write(e event) {
+	if *quiet && e.Level != "ERROR" {
+		return
+	}
+	if *plain {
+		for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+			fmt.Fprintf(console, "%s: %s\n", e.Level, line)
+		}
+		return
+	}
+	if e.Prefix == "" {
+		fmt.Fprintln(console, e.Text)
+		return
+	}
+	fmt.Fprintln(console, e.Prefix+" "+e.Text)
+}
+
+func (consoleSink) close() error { return nil }
+
+// jsonRecord is one line of -output json: either a pipeline step as it
+// starts and finishes, or a status line.
+type jsonRecord struct {
+	Type string `json:"type"` // step or message
+	*stepResult
+	Time  *time.Time `json:"time,omitempty"`
+	Level string     `json:"level,omitempty"`
+	Text  string     `json:"text,omitempty"`
+}
+
+// jsonSink replaces the console sink with -output json, writing one record
+// per line to the console.
+type jsonSink struct{}
+
+func newJSONSink() jsonSink {
+	return jsonSink{}
+}
+
+func (jsonSink) write(e event) {
+	json.NewEncoder(console).Encode(jsonRecord{Type: "message", Time: &e.Time, Level: e.Level, Text: e.Text})
+}
+
+func (jsonSink) step(r stepResult) {
+	json.NewEncoder(console).Encode(jsonRecord{Type: "step", stepResult: &r})
+}
+
+func (jsonSink) close() error { return nil }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	stabilizeWait string // Pause for sleep:stabilize, letting Jenkins settle after a change
+	settleWait    string // Pause for sleep:settle, letting a restarted Jenkins settle before verifying
+	shutdownWait  string // Longest wait for Jenkins to go down, and the pause for sleep:shutdown
+	startupWait   string // Longest wait for Jenkins to come online
+)
+
+// pipelineStep is an entry in the step library that pipelines are built from.
+type pipelineStep struct {
+	icon    string
+	message string // Catalog key of the message printed before the step runs
+	run     func() error
+}
+
+// stepLibrary holds every step a pipeline may use, keyed by the name used in
+// pipelineSteps. "sleep:<duration>" is accepted in addition to these, where
+// the duration may be stabilize, settle or shutdown for -stabilize-wait,
+// -settle-wait and -shutdown-wait.
+var stepLibrary = map[string]pipelineStep{
+	"deps":            {"🧩", "stepDeps", checkDependencies},
+	"backup":          {"💾", "stepBackup", backupPlugin},
+	"uninstall":       {"🛑", "stepUninstall", uninstallPlugin},
+	"install":         {"⬆️", "stepInstall", installPlugin},
+	"quietDown":       {"🤫", "stepQuietDown", quietDown},
+	"cancelQuietDown": {"📣", "stepCancelQuietDown", cancelQuietDown},
+	"stop":            {"🛑", "stepStop", stopJenkins},
+	"stopped":         {"", "", waitForShutdown},
+	"safeRestart":     {"🔁", "stepSafeRestart", safeRestart},
+	"reload":          {"📂", "stepReload", reloadConfiguration},
+	"start":           {"🚀", "stepStart", startJenkins},
+	"wait":            {"", "", waitForJenkins},
+	"proxyCheck":      {"🔀", "stepProxyCheck", checkReverseProxy},
+	"verify":          {"🔍", "stepVerify", verifyInstallation},
+	"monitors":        {"🩺", "stepMonitors", reportNewMonitors},
+	"durability":      {"🧬", "stepDurability", checkPipelineDurability},
+	"discardOldData":  {"🧹", "stepDiscardOldData", discardOldData},
+	"replay":          {"▶️", "stepReplay", replayBuild},
+	"loadTimes":       {"⏱️", "stepLoadTimes", reportLoadTimes},
+}
+
+// restartSteps take Jenkins down and are guarded by the busy-hours check.
+var restartSteps = map[string]bool{"stop": true, "safeRestart": true}
+
+// stepSettings lists the settings each step cannot do without, so a run only
+// asks for what its steps use. Steps not listed need nothing but the URL.
+var stepSettings = map[string][]string{
+	"deps":            {"jenkinsUser", "jenkinsToken", "pluginPath"},
+	"backup":          {"pluginName"},
+	"uninstall":       {"jenkinsUser", "jenkinsToken", "pluginName"},
+	"install":         {"jenkinsUser", "jenkinsToken", "pluginName", "pluginPath"},
+	"quietDown":       {"jenkinsUser", "jenkinsToken"},
+	"cancelQuietDown": {"jenkinsUser", "jenkinsToken"},
+	"stop":            {"jenkinsUser", "jenkinsToken"},
+	"safeRestart":     {"jenkinsUser", "jenkinsToken"},
+	"reload":          {"jenkinsUser", "jenkinsToken"},
+	"start":           {"jenkinsWarPath"},
+	"proxyCheck":      {"jenkinsUser", "jenkinsToken"},
+	"verify":          {"jenkinsUser", "jenkinsToken", "pluginName"},
+	"monitors":        {"jenkinsUser", "jenkinsToken"},
+	"durability":      {"jenkinsUser", "jenkinsToken"},
+	"discardOldData":  {"jenkinsUser", "jenkinsToken"},
+	"replay":          {"jenkinsUser", "jenkinsToken"},
+}
+
+// defaultPipeline is the classic update sequence: replace the plugin and
+// restart Jenkins so it gets loaded.
+var defaultPipeline = []string{"backup", "uninstall", "sleep:stabilize", "install", "stop", "stopped", "start", "wait", "proxyCheck", "sleep:settle", "verify", "monitors", "durability"}
+
+// restartPipeline and reloadPipeline are what the restart and reload
+// commands run.
+var (
+	restartPipeline = []string{"stop", "stopped", "start", "wait", "durability"}
+	reloadPipeline  = []string{"reload", "sleep:stabilize", "wait"}
+)
+
+// skippable maps each -skip-* option to the steps it removes. Without a
+// restart the new plugin is not loaded yet, so there is nothing to verify
+// and no restart for pipelines to survive.
+var skippable = map[string][]string{
+	"uninstall": {"uninstall"},
+	"restart":   {"stop", "stopped", "safeRestart", "start", "wait", "verify", "durability"},
+	"verify":    {"verify", "replay", "durability"},
+	"backup":    {"backup"},
+}
+
+var skipFlags = map[string]*bool{}
+
+func init() {
+	for name, steps := range skippable {
+		skipFlags[name] = flag.Bool("skip-"+name, false, "Do not run "+strings.Join(steps, ", "))
+	}
+}
+
+// skipSteps removes the steps of every -skip-* option given, along with a
+// sleep that directly follows a removed step.
+func skipSteps(names []string) []string {
+	skip := map[string]bool{}
+	for name, set := range skipFlags {
+		if *set {
+			for _, step := range skippable[name] {
+				skip[step] = true
+			}
+		}
+	}
+	return dropSteps(names, skip)
+}
+
+// dropSteps removes the given steps from a pipeline, together with the
+// sleeps that followed them.
+func dropSteps(names []string, skip map[string]bool) []string {
+	var kept []string
+	dropped := false
+	for _, name := range names {
+		if skip[name] || (dropped && strings.HasPrefix(name, "sleep:")) {
+			dropped = true
+			continue
+		}
+		dropped = false
+		kept = append(kept, name)
+	}
+	return kept
+}
+
+// parsePipeline turns a comma-separated step list into step names, rejecting
+// anything that is not in the step library.
+func parsePipeline(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if d, ok := strings.CutPrefix(name, "sleep:"); ok {
+			if _, err := sleepDuration(d); err != nil {
+				return nil, fmt.Errorf("invalid pipeline step %q: %v", name, err)
+			}
+		} else if _, ok := stepLibrary[name]; !ok {
+			return nil, fmt.Errorf("unknown pipeline step %q", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("pipeline has no steps")
+	}
+	return names, nil
+}
+
+// sleepDuration reads the duration of a sleep step: a Go duration, or the
+// stabilize, settle or shutdown delay as configured.
+func sleepDuration(d string) (time.Duration, error) {
+	switch d {
+	case "stabilize":
+		return settingDuration("stabilize-wait", stabilizeWait)
+	case "settle":
+		return settingDuration("settle-wait", settleWait)
+	case "shutdown":
+		return settingDuration("shutdown-wait", shutdownWait)
+	}
+	return time.ParseDuration(d)
+}
+
+func settingDuration(flag, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, usageError{fmt.Errorf("invalid -%s %q, use a duration like 10s", flag, value)}
+	}
+	return d, nil
+}
+
+// runPipeline executes the named steps in order, stopping at the first failure.
+func runPipeline(names []string) error {
+	if err := confirmDestructive(names); err != nil {
+		return err
+	}
+	if slices.Contains(names, "monitors") {
+		snapshotMonitors()
+	}
+	if slices.Contains(names, "durability") {
+		snapshotPipelines()
+	}
+	replacing = slices.Contains(names, "install")
+	// Checked once, before the first step, when any step is disruptive: a
+	// step before it may already change the controller
+	if maintenanceCalendar != "" && slices.ContainsFunc(names, func(name string) bool { return destructiveSteps[name] != nil }) {
+		if err := report.step("calendarCheck", checkMaintenanceWindow); err != nil {
+			return err
+		}
+	}
+	// Checked once, before the first step that changes the controller, so a
+	// busy hour defers the whole run rather than leaving it half done
+	busyCheckDue := *busyCheck && slices.ContainsFunc(names, func(name string) bool { return restartSteps[name] })
+	for i, name := range names {
+		if d, ok := strings.CutPrefix(name, "sleep:"); ok {
+			wait, err := sleepDuration(d)
+			if err != nil {
+				return err
+			}
+			if !dryRunning("wait %s", wait) {
+				pause(wait)
+			}
+			checkpoint.advance(name)
+			continue
+		}
+		if busyCheckDue && changesController(name) {
+			if err := report.step("busyCheck", checkBusyHours); err != nil {
+				return err
+			}
+			busyCheckDue = false
+		}
+		step := stepLibrary[name]
+		if step.message != "" {
+			say(step.icon, step.message)
+		}
+		if err := report.step(name, step.run); err != nil {
+			return rescue(names[i:], err)
+		}
+		checkpoint.advance(name)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// planFormat is bumped when plan files change incompatibly.
+const planFormat = 1
+
+// planPlugin is a plugin as the plan saw it.
+type planPlugin struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	State   string `json:"state,omitempty"`
+	Path    string `json:"path,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// plan is the reviewable record of what apply will do to one controller.
+type plan struct {
+	Format            int         `json:"format"`
+	Created           time.Time   `json:"created"`
+	JenkinsURL        string      `json:"jenkinsUrl"`
+	ControllerVersion string      `json:"controllerVersion,omitempty"`
+	Current           *planPlugin `json:"current"` // nil when not installed
+	Desired           planPlugin  `json:"desired"`
+	Changes           []string    `json:"changes"`
+	RestartNeeded     bool        `json:"restartNeeded"`
+	Steps             []string    `json:"steps"`
+}
+
+// currentPlugin describes the installed plugin for a plan, nil when absent.
+func currentPlugin() (*planPlugin, error) {
+	p, err := findPlugin(pluginName)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return &planPlugin{Name: p.ShortName, Version: p.Version, State: p.state().String()}, nil
+}
+
+// makePlan computes the delta between the controller and the plugin file:
+// the configured pipeline without the steps that have nothing to do.
+func makePlan() (*plan, error) {
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.ShortName != pluginName {
+		return nil, fmt.Errorf("%s is plugin %s, not -pluginName %s", pluginPath, manifest.ShortName, pluginName)
+	}
+	sum, err := fileSha256(pluginPath)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentPlugin()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := configuredPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plan{
+		Format:            planFormat,
+		Created:           time.Now().UTC(),
+		JenkinsURL:        jenkinsURL,
+		ControllerVersion: controllerVersion(),
+		Current:           current,
+		Desired:           planPlugin{Name: manifest.ShortName, Version: manifest.Version, Path: pluginPath, SHA256: sum},
+		Changes:           []string{},
+		Steps:             skipSteps(steps),
+	}
+	switch {
+	case current != nil && current.Version == manifest.Version && current.State == pluginActive.String():
+		p.Steps = []string{}
+		return p, nil
+	case current == nil:
+		p.Steps = dropSteps(p.Steps, map[string]bool{"backup": true, "uninstall": true})
+	}
+
+	if slices.Contains(p.Steps, "uninstall") {
+		p.Changes = append(p.Changes, fmt.Sprintf("remove %s %s", current.Name, current.Version))
+	}
+	if slices.Contains(p.Steps, "install") {
+		p.Changes = append(p.Changes, fmt.Sprintf("install %s %s (sha256 %s)", manifest.ShortName, manifest.Version, sum[:12]))
+	}
+	for _, step := range p.Steps {
+		if restartSteps[step] {
+			p.RestartNeeded = true
+			p.Changes = append(p.Changes, "restart Jenkins at "+jenkinsURL)
+			break
+		}
+	}
+	return p, nil
+}
+
+func (p *plan) String() string {
+	var b strings.Builder
+	current := "not installed"
+	if p.Current != nil {
+		current = p.Current.Version + " " + p.Current.State
+	}
+	fmt.Fprintf(&b, "Plan for %s on %s (Jenkins %s)\n", p.Desired.Name, p.JenkinsURL, p.ControllerVersion)
+	fmt.Fprintf(&b, "  installed: %s\n  desired:   %s\n", current, p.Desired.Version)
+	if len(p.Changes) == 0 {
+		b.WriteString("No changes.")
+		return b.String()
+	}
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "  + %s\n", c)
+	}
+	fmt.Fprintf(&b, "Steps: %s", strings.Join(p.Steps, ", "))
+	return b.String()
+}
+
+// planCommand writes the plan of an update for review before apply.
+func planCommand(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	out := fs.String("out", "jenkins-wrapper.plan.json", "Where to write the plan")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+	if err := resolvePluginSource(); err != nil {
+		return err
+	}
+	steps, err := configuredPipeline()
+	if err != nil {
+		return err
+	}
+	// A plan always weighs an install, whatever the pipeline does about it
+	if err := validateSettings(append([]string{"install"}, steps...)); err != nil {
+		return err
+	}
+	p, err := makePlan()
+	if err != nil {
+		return err
+	}
+
+	// A fetched or built plugin lives in the workspace, which is gone by
+	// the time the plan is applied
+	if pluginFetched() {
+		keep := filepath.Join(filepath.Dir(*out), filepath.Base(pluginPath))
+		data, err := os.ReadFile(pluginPath)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(keep, data, 0o644); err != nil {
+			return err
+		}
+		p.Desired.Path = keep
+	}
+	if p.Desired.Path, err = filepath.Abs(p.Desired.Path); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*out, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	printOutput(p.String())
+	notify("📝", "Plan written to %s, run apply %s to carry it out", *out, *out)
+	return nil
+}
+
+// applyCommand carries out a plan exactly: the same plugin file, checked by
+// its checksum, on the same controller, with the planned steps. A controller
+// that changed since the plan was made is refused; plan again.
+func applyCommand(args []string) error {
+	if len(args) != 1 {
+		return usageError{errors.New("usage: apply <plan file>")}
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var p plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%s is not a plan: %v", args[0], err)
+	}
+	if p.Format != planFormat {
+		return fmt.Errorf("%s has plan format %d, this wrapper reads %d", args[0], p.Format, planFormat)
+	}
+	if jenkinsURL != "" && strings.TrimRight(jenkinsURL, "/") != strings.TrimRight(p.JenkinsURL, "/") {
+		return fmt.Errorf("the plan is for %s, not -jenkinsURL %s", p.JenkinsURL, jenkinsURL)
+	}
+	jenkinsURL, pluginName, pluginPath = p.JenkinsURL, p.Desired.Name, p.Desired.Path
+	*pluginSpec, *buildWith, pluginURL, pluginGAV = "", "", "", "" // The plan names the file
+
+	if len(p.Steps) == 0 {
+		notify("✅", "The plan has no changes")
+		return nil
+	}
+	sum, err := fileSha256(pluginPath)
+	if err != nil {
+		return err
+	}
+	if sum != p.Desired.SHA256 {
+		return fmt.Errorf("%s changed since the plan was made: sha256 %s, planned %s", pluginPath, sum, p.Desired.SHA256)
+	}
+	current, err := currentPlugin()
+	if err != nil {
+		return err
+	}
+	if !planPluginEqual(current, p.Current) {
+		return fmt.Errorf("%s on %s changed since the plan was made, plan again", pluginName, jenkinsURL)
+	}
+
+	// The reviewed plan is the confirmation
+	assumeYes = true
+	return pipelineCommand(p.Steps)(nil)
+}
+
+func planPluginEqual(a, b *planPlugin) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.Version == b.Version && a.State == b.State
+}
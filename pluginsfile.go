@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// pluginsFileEntry is a line of a plugins.txt.
+type pluginsFileEntry struct {
+	line          int
+	name, version string
+	url           string // Downloaded from here instead of the update center
+	group         string // Of an incremental build
+}
+
+// readPluginsFile reads the plugins.txt format of the official Docker
+// image: name, name:latest or name:version per line, name:version:url for a
+// download, name:incrementals;groupId;version for an incremental build, and
+// # comments.
+func readPluginsFile(path string) ([]pluginsFileEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []pluginsFileEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 3)
+		e := pluginsFileEntry{line: n, name: parts[0]}
+		if len(parts) > 1 {
+			e.version = parts[1]
+		}
+		if len(parts) > 2 {
+			e.url = parts[2]
+		}
+		if incremental, ok := strings.CutPrefix(e.version, "incrementals;"); ok {
+			e.group, e.version, _ = strings.Cut(incremental, ";")
+		}
+		switch {
+		case e.name == "":
+			return nil, fmt.Errorf("%s:%d: no plugin name", path, n)
+		case e.version == "experimental":
+			return nil, fmt.Errorf("%s:%d: for experimental releases use -channel experimental", path, n)
+		case e.version == "latest":
+			e.version = ""
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// fetch downloads the plugin of an entry. pluginName follows a rename.
+func (e pluginsFileEntry) fetch() (string, error) {
+	pluginName = e.name
+	switch {
+	case e.url != "":
+		return fetchPluginURL(e.url)
+	case e.group != "":
+		return fetchIncrementalPlugin(e.group + ":" + e.name + ":" + e.version)
+	case e.version != "":
+		return fetchUpdateCenterPlugin(e.name + ":" + e.version)
+	}
+	return fetchUpdateCenterPlugin(e.name)
+}
+
+// installCommand installs -pluginPath, or with -plugins-file every plugin
+// listed in a plugins.txt.
+func installCommand(args []string) error {
+	if len(args) == 0 {
+		return pipelineCommand([]string{"install"})(nil)
+	}
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	pluginsFile := fs.String("plugins-file", "", "Install or update every plugin of this plugins.txt, as used by the official Docker image")
+	restart := fs.String("restart", "safe", "How to restart once all are installed: safe (after running builds), now, or none (leave it pending)")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+	restartSteps, ok := restartModes[*restart]
+	switch {
+	case *pluginsFile == "" || fs.NArg() > 0:
+		return usageError{errors.New("usage: install [-plugins-file <plugins.txt> [-restart safe|now|none]]")}
+	case !ok:
+		return usageError{fmt.Errorf("unknown -restart %q, use safe, now or none", *restart)}
+	case pluginFetched():
+		return usageError{errors.New("-plugins-file names its plugins, it cannot be combined with -build-with, -pluginURL, -pluginGAV or -plugin")}
+	}
+	return installPluginsFile(*pluginsFile, restartSteps)
+}
+
+// batchPlugin is a plugin of an install -plugins-file run.
+type batchPlugin struct {
+	name, version, path string
+	dependencies        []ucDependency
+}
+
+// batch holds the plugins of an install -plugins-file run; empty otherwise.
+var batch []batchPlugin
+
+// eachPlugin runs fn for the plugin of the run, or with pluginName and
+// pluginPath set to each plugin of the batch in turn.
+func eachPlugin(fn func() error) error {
+	if len(batch) == 0 {
+		return fn()
+	}
+	for _, p := range batch {
+		pluginName, pluginPath = p.name, p.path
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchInstallStep adds the install step of a plugin of the batch to the
+// step library, as install:NAME.
+func batchInstallStep(p batchPlugin) string {
+	step := "install:" + p.name
+	stepLibrary[step] = pipelineStep{"⬆️", "stepInstall", func() error {
+		pluginName, pluginPath = p.name, p.path
+		return installPlugin()
+	}}
+	stepSettings[step] = []string{"jenkinsUser", "jenkinsToken"}
+	return step
+}
+
+// installPluginsFile brings the plugins of a plugins.txt to the listed
+// versions in one run. Every plugin is downloaded and checked, and missing
+// dependencies are added, before the pipeline starts; it then installs the
+// plugins not yet at their version and restarts Jenkins once at the end
+// rather than once per plugin, behind the same guards as any other run.
+func installPluginsFile(path string, restartSteps []string) error {
+	entries, err := readPluginsFile(path)
+	if err != nil {
+		return err
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+	plugins, err := listPlugins()
+	if err != nil {
+		return err
+	}
+	installed := map[string]string{}
+	for _, p := range plugins {
+		if !p.Deleted {
+			installed[p.ShortName] = p.Version
+		}
+	}
+
+	listed := map[string]string{}
+	for _, e := range entries {
+		file, err := e.fetch()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, e.line, err)
+		}
+		manifest, err := readPluginManifest(file)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, batchPlugin{pluginName, manifest.Version, file, manifest.Dependencies})
+		listed[pluginName] = manifest.Version
+	}
+	dependencies, err := batchDependencies(listed, installed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	batch = append(dependencies, batch...) // Dependencies first
+
+	var steps []string
+	for _, p := range batch {
+		step := batchInstallStep(p)
+		if installed[p.name] != p.version {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 && !*resume {
+		notify("✅", "All %d plugins of %s are installed at their versions", len(entries), path)
+		return nil
+	}
+	// The checkpoint is taken on the plugins file, so -resume needs the same one
+	pluginName, pluginPath = "", path
+	return pipelineCommand(append(steps, restartSteps...))(nil)
+}
+
+// batchDependencies resolves the required dependencies of the listed
+// plugins, as jenkins-plugin-cli does, and downloads the ones that are
+// neither installed nor listed at a recent enough version. A listed version
+// older than another listed plugin needs is an error.
+func batchDependencies(listed, installed map[string]string) ([]batchPlugin, error) {
+	var requested []ucDependency
+	for _, p := range batch {
+		requested = append(requested, p.dependencies...)
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	uc, err := fetchUpdateCenter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %v", err)
+	}
+	graph, err := resolveDependencies(uc, requested)
+	if err != nil {
+		return nil, err
+	}
+	var added []batchPlugin
+	var problems []string
+	for _, name := range sortedKeys(graph.Versions) {
+		need := graph.Versions[name]
+		if version, ok := listed[name]; ok {
+			if compareVersions(version, need) < 0 {
+				problems = append(problems, fmt.Sprintf("%s is listed at %s, %s or newer is required", name, version, need))
+			}
+			continue
+		}
+		if have, ok := installed[name]; ok && compareVersions(have, need) >= 0 {
+			continue
+		}
+		file, err := cachedPlugin(name, need, "")
+		if err != nil {
+			return nil, err
+		}
+		notify("🧩", "Adding dependency %s %s", name, need)
+		added = append(added, batchPlugin{name: name, version: need, path: file})
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("unmet dependencies:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return added, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	pluginURL       string // Where to download the plugin from, instead of -pluginPath
+	pluginURLHeader string // Header sent with the download, e.g. for authentication
+)
+
+// fetchPluginURL downloads the plugin at a URL into the run workspace, for
+// .hpi files published on a web server. Credentials go in -pluginURLHeader,
+// or in the URL as user:password@ for basic auth.
+func fetchPluginURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", usageError{fmt.Errorf("invalid -pluginURL %q, expected an http or https URL", rawURL)}
+	}
+	name := path.Base(u.Path)
+	if !strings.HasSuffix(name, ".hpi") && !strings.HasSuffix(name, ".jpi") {
+		name = "plugin.hpi"
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if pluginURLHeader != "" {
+		key, value, ok := strings.Cut(pluginURLHeader, ":")
+		if !ok {
+			return "", usageError{fmt.Errorf("invalid -pluginURLHeader, expected Name: value")}
+		}
+		req.Header.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	notify("⬇️", "Downloading %s from %s...", name, u.Redacted())
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError("failed to download "+u.Redacted(), resp)
+	}
+	dest := ws.path(downloadsDir, name)
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	return dest, f.Close()
+}
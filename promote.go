@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// promotion records that an exact plugin artifact was verified in an environment.
+type promotion struct {
+	Plugin      string    `json:"plugin"`
+	Version     string    `json:"version"`
+	Sha256      string    `json:"sha256"`
+	Environment string    `json:"environment"`
+	JenkinsURL  string    `json:"jenkinsUrl"`
+	RecordedBy  string    `json:"recordedBy,omitempty"`
+	RecordedAt  time.Time `json:"recordedAt"`
+}
+
+func loadPromotions() ([]promotion, error) {
+	data, err := os.ReadFile(promotionLedger)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ledger []promotion
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", promotionLedger, err)
+	}
+	return ledger, nil
+}
+
+func savePromotions(ledger []promotion) error {
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(promotionLedger, append(data, '\n'), 0o644)
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// promotionStages returns the configured environment order, e.g. dev, staging, prod.
+func promotionStages() []string {
+	var stages []string
+	for _, s := range strings.Split(promotionOrder, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			stages = append(stages, s)
+		}
+	}
+	return stages
+}
+
+// previousStage returns the environment an artifact must have been verified
+// in before it may be installed in env, or "" for the first one.
+func previousStage(env string) (string, error) {
+	stages := promotionStages()
+	i := slices.Index(stages, env)
+	switch {
+	case i < 0:
+		return "", fmt.Errorf("unknown environment %q, expected one of %s", env, strings.Join(stages, ", "))
+	case i == 0:
+		return "", nil
+	}
+	return stages[i-1], nil
+}
+
+// checkPromotion only lets the exact artifact (by SHA-256) into an
+// environment once it was promoted from the previous one.
+func checkPromotion() error {
+	prev, err := previousStage(deployEnv)
+	if err != nil || prev == "" {
+		return err
+	}
+	sum, err := fileSha256(pluginPath)
+	if err != nil {
+		return err
+	}
+	ledger, err := loadPromotions()
+	if err != nil {
+		return err
+	}
+	for _, p := range ledger {
+		if p.Environment == prev && p.Plugin == pluginName && p.Sha256 == sum {
+			notify("✅", "%s %s was verified in %s on %s", p.Plugin, p.Version, prev, p.RecordedAt.Format(time.DateOnly))
+			return nil
+		}
+	}
+	return fmt.Errorf("%s (sha256 %s) has not been promoted from %s, run 'promote' there first", pluginPath, sum[:12], prev)
+}
+
+// promoteCommand records the plugin at pluginPath as verified in the current
+// environment, after confirming that exact version is what runs there.
+func promoteCommand(args []string) error {
+	if deployEnv == "" {
+		return errors.New("promote needs -env")
+	}
+	if _, err := previousStage(deployEnv); err != nil {
+		return err
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	manifest, err := readPluginManifest(pluginPath)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSha256(pluginPath)
+	if err != nil {
+		return err
+	}
+	plugin, err := findPlugin(pluginName)
+	if err != nil {
+		return err
+	}
+	if plugin.state() != pluginActive || plugin.Version != manifest.Version {
+		return fmt.Errorf("%s on %s is %s %s, not the %s being promoted", pluginName, jenkinsURL, plugin.state(), pluginVersion(plugin), manifest.Version)
+	}
+
+	ledger, err := loadPromotions()
+	if err != nil {
+		return err
+	}
+	ledger = append(ledger, promotion{
+		Plugin:      pluginName,
+		Version:     manifest.Version,
+		Sha256:      sum,
+		Environment: deployEnv,
+		JenkinsURL:  jenkinsURL,
+		RecordedBy:  currentUser(),
+		RecordedAt:  time.Now().UTC(),
+	})
+	if err := savePromotions(ledger); err != nil {
+		return err
+	}
+	notify("🏷️", "Recorded %s %s as verified in %s", pluginName, manifest.Version, deployEnv)
+	return nil
+}
+
+func pluginVersion(p *installedPlugin) string {
+	if p == nil {
+		return ""
+	}
+	return p.Version
+}
+
+func currentUser() string {
+	for _, key := range []string{"USER", "USERNAME"} {
+		if u := os.Getenv(key); u != "" {
+			return u
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// checkReverseProxy runs the same test as Jenkins' own "reverse proxy setup is
+// broken" monitor: Jenkins compares the URL the browser used (passed in the
+// path, as the JavaScript in Manage Jenkins does) with the root URL it infers
+// from the request headers. A mismatch breaks redirects and form submissions
+// in ways the /login probe cannot see.
+func checkReverseProxy() error {
+	referer := strings.TrimSuffix(jenkinsURL, "/") + "/manage/"
+	encoded := url.PathEscape(url.QueryEscape(referer))
+	req, err := newJenkinsRequest("GET", "/administrativeMonitor/hudson.diagnosis.ReverseProxySetupMonitor/testForReverseProxySetup/"+encoded+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", referer)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		notify("✅", "Reverse proxy setup is correct")
+		return nil
+	case http.StatusNotFound:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("reverse proxy setup is broken: Jenkins does not see itself at %s%s", jenkinsURL, proxyCheckDetail(body))
+	}
+	return newHTTPStatusError("reverse proxy check failed", resp)
+}
+
+// proxyCheckDetail extracts Jenkins' explanation from the test response.
+func proxyCheckDetail(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if text == "" || strings.HasPrefix(text, "<") {
+		return ""
+	}
+	return " (" + text + ")"
+}
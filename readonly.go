@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var readOnly = flag.Bool("read-only", false, "Refuse anything that could change Jenkins: only GET and HEAD requests, no processes launched")
+
+var errReadOnly = errors.New("refused in read-only mode")
+
+// readOnlyTransport sits below tracing, so refused requests still show up in
+// the HTTP trace.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if *readOnly && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("%w: %s %s", errReadOnly, req.Method, req.URL.Path)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// readOnlyExecutor lets file reads through to the wrapped executor and
+// refuses everything else.
+type readOnlyExecutor struct {
+	executor
+}
+
+func (readOnlyExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	return nil, checkLaunch(args[0])
+}
+
+func (readOnlyExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	return fmt.Errorf("%w: writing %s", errReadOnly, path)
+}
+
+func (readOnlyExecutor) mkdir(path string) error {
+	return fmt.Errorf("%w: creating %s", errReadOnly, path)
+}
+
+func (readOnlyExecutor) output(args []string) ([]byte, error) {
+	return nil, checkLaunch(args[0])
+}
+
+// checkLaunch guards every process the wrapper starts locally.
+func checkLaunch(name string) error {
+	if *readOnly {
+		return fmt.Errorf("%w: running %s", errReadOnly, name)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ucDeprecation is an entry of the deprecations of update-center.json. When
+// a plugin was renamed, its URL is the page of the successor on
+// plugins.jenkins.io.
+type ucDeprecation struct {
+	URL string `json:"url"`
+}
+
+const pluginSitePrefix = "https://plugins.jenkins.io/"
+
+// successor returns the plugin that replaced a deprecated one, and whether
+// the plugin is deprecated at all.
+func (uc *updateCenter) successor(name string) (string, bool) {
+	d, deprecated := uc.Deprecations[name]
+	if !deprecated {
+		return "", false
+	}
+	id, ok := strings.CutPrefix(d.URL, pluginSitePrefix)
+	id = strings.Trim(id, "/")
+	if _, listed := uc.Plugins[id]; !ok || id == name || !listed {
+		return "", true
+	}
+	return id, true
+}
+
+// resolvePluginName follows the renames of a plugin to the name it is
+// published under now, so an old name installs the successor rather than a
+// deprecated release or nothing. A deprecated plugin without a successor,
+// e.g. one whose deprecation links to an issue, keeps its name with a
+// warning.
+func (uc *updateCenter) resolvePluginName(name string) (string, error) {
+	current := name
+	for range 5 { // Renamed plugins are rarely renamed again; stop on loops
+		next, deprecated := uc.successor(current)
+		switch {
+		case !deprecated:
+			if _, ok := uc.Plugins[current]; !ok {
+				return "", fmt.Errorf("no plugin %s in the update center", current)
+			}
+			if current != name {
+				notify("🔀", "Plugin %s was renamed to %s", name, current)
+			}
+			return current, nil
+		case next == "":
+			if _, ok := uc.Plugins[current]; !ok {
+				return "", fmt.Errorf("plugin %s is deprecated and has no successor in the update center, see %s", current, uc.Deprecations[current].URL)
+			}
+			notify("⚠️", "Plugin %s is deprecated, see %s", current, uc.Deprecations[current].URL)
+			if current != name {
+				notify("🔀", "Plugin %s was renamed to %s", name, current)
+			}
+			return current, nil
+		}
+		current = next
+	}
+	return "", fmt.Errorf("plugin %s is renamed in a loop in the update center", name)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"Golang/jenkinswrapper"
+)
+
+var (
+	replayJob         = flag.String("replay-job", "", "Verify the update by replaying the last build of this pipeline (folder/name)")
+	replayJenkinsfile = flag.String("replay-jenkinsfile", "", "Replay with this Jenkinsfile instead of the build's own script")
+	replayTimeout     = flag.Duration("replay-timeout", 10*time.Minute, "How long to wait for the replayed build to finish")
+)
+
+type buildStatus struct {
+	Number   int    `json:"number"`
+	Building bool   `json:"building"`
+	Result   string `json:"result"`
+	URL      string `json:"url"`
+}
+
+func lastBuild(job string) (buildStatus, error) {
+	var build buildStatus
+	err := getJSON(jenkinswrapper.JobPath(job)+"/lastBuild/api/json?tree=number,building,result,url", &build)
+	return build, err
+}
+
+// replayBuild replays the last build of -replay-job, optionally with a
+// modified Jenkinsfile, and fails unless the replay succeeds. It serves as
+// a smoke test of the updated plugin without a dedicated canary job.
+func replayBuild() error {
+	last, err := lastBuild(*replayJob)
+	if err != nil {
+		return err
+	}
+
+	replay := fmt.Sprintf("%s/%d/replay/rebuild", jenkinswrapper.JobPath(*replayJob), last.Number)
+	body := strings.NewReader("")
+	if *replayJenkinsfile != "" {
+		script, err := os.ReadFile(*replayJenkinsfile)
+		if err != nil {
+			return err
+		}
+		submission, _ := json.Marshal(map[string]string{"mainScript": string(script)})
+		form := url.Values{"mainScript": {string(script)}, "json": {string(submission)}}
+		replay = fmt.Sprintf("%s/%d/replay/run", jenkinswrapper.JobPath(*replayJob), last.Number)
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := newJenkinsRequest("POST", replay, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// The replay form answers with a redirect to the job page
+	if resp.StatusCode >= 400 {
+		return newHTTPStatusError("failed to replay "+*replayJob, resp)
+	}
+	notify("▶️", "Replaying %s #%d", *replayJob, last.Number)
+
+	deadline := time.Now().Add(*replayTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		build, err := lastBuild(*replayJob)
+		if err != nil {
+			return err
+		}
+		if build.Number <= last.Number || build.Building {
+			continue
+		}
+		if build.Result != "SUCCESS" {
+			return fmt.Errorf("replay of %s finished as #%d with %s: %s", *replayJob, build.Number, build.Result, build.URL)
+		}
+		notify("✅", "Replay %s #%d succeeded", *replayJob, build.Number)
+		return nil
+	}
+	return fmt.Errorf("replay of %s did not finish within %v", *replayJob, *replayTimeout)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+)
+
+// stepResult records the outcome of one pipeline step.
+type stepResult struct {
+	Name     string    `json:"name"`
+	Attempt  int       `json:"attempt"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"durationSeconds"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// runReport collects what happened during a run so it can be attached to a
+// support bundle when something goes wrong.
+type runReport struct {
+	Started       time.Time        `json:"started"`
+	CorrelationID string           `json:"correlationId"` // Sent with every request of the run
+	Wrapper       buildInfo        `json:"wrapper"`
+	Steps         []stepResult     `json:"steps"`
+	NewMonitors   []string         `json:"newMonitors,omitempty"`   // Administrative monitors activated during the run
+	LostPipelines []string         `json:"lostPipelines,omitempty"` // Pipeline builds that did not survive the restart
+	Benchmark     []benchResult    `json:"benchmark,omitempty"`
+	LoadTimes     []pluginLoadTime `json:"loadTimes,omitempty"` // Plugin load times of the restart, slowest first
+	Error         string           `json:"error,omitempty"`
+	Category      failureCategory  `json:"category,omitempty"`
+
+	attempt int // Pipeline attempt currently running
+}
+
+var report = &runReport{Started: time.Now(), Wrapper: currentBuild()}
+
+// step runs fn as the named pipeline step and records its outcome.
+func (r *runReport) step(name string, fn func() error) error {
+	if cm != nil {
+		cm.beforeChange(name)
+	}
+	result := stepResult{Name: name, Attempt: r.attempt, Status: "running", Started: time.Now()}
+	publishStep(result)
+	err := fn()
+	result.Duration = time.Since(result.Started).Seconds()
+	result.Status = "ok"
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	r.Steps = append(r.Steps, result)
+	publishStep(result)
+	return err
+}
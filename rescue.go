@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var rescueTimeout = flag.Duration("rescue", 0, "On failure, offer an interactive rescue prompt for this long before giving up (0 disables)")
+
+// rescueInput delivers lines typed on the terminal. It is shared by every
+// prompt so a reader blocked past a timeout is reused rather than leaked.
+var rescueInput chan string
+
+func readRescueInput() chan string {
+	if rescueInput == nil {
+		rescueInput = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				rescueInput <- strings.TrimSpace(scanner.Text())
+			}
+			close(rescueInput)
+		}()
+	}
+	return rescueInput
+}
+
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rescue lets the operator recover from a failed step instead of starting
+// over. remaining starts with the step that failed. Without an answer
+// within -rescue, the original error is returned.
+func rescue(remaining []string, stepErr error) error {
+	if *rescueTimeout <= 0 || !interactive() {
+		return stepErr
+	}
+	printError(stepErr)
+	input := readRescueInput()
+	for {
+		// On stderr, so -output json and cm keep stdout to themselves
+		fmt.Fprint(os.Stderr, "\n"+msg("rescuePrompt", remaining[0]))
+		var answer string
+		select {
+		case line, ok := <-input:
+			if !ok {
+				return stepErr
+			}
+			answer = line
+		case <-time.After(*rescueTimeout):
+			fmt.Fprintln(os.Stderr)
+			say("⏰", "rescueTimedOut", *rescueTimeout)
+			return stepErr
+		}
+
+		switch answer {
+		case "r":
+			return runPipeline(remaining)
+		case "s":
+			return runPipeline(remaining[1:])
+		case "b":
+			if err := restorePlugin(); err != nil {
+				printError(err)
+			}
+		case "j":
+			if err := startJenkins(); err != nil {
+				printError(err)
+			} else if err := waitForJenkins(); err != nil {
+				printError(err)
+			}
+		case "l":
+			tail, err := tailFile(jenkinsLogPath, 40)
+			if err != nil {
+				printError(err)
+			} else {
+				printOutput(tail)
+			}
+		case "k":
+			return stepErr
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"time"
+)
+
+var httpRetries = flag.Int("http-retries", 3, "Retries for failed Jenkins API calls (POSTs only when safe)")
+
+// retryBackoff is the pause before the first retry, doubled for each further one.
+const retryBackoff = time.Second
+
+// verifierKey carries a tookEffect callback in a request context.
+type verifierKey struct{}
+
+// withVerifier attaches a check that tells whether a POST already did its job
+// even though its response was lost. Such POSTs are retried only when the
+// check says the operation has not happened.
+func withVerifier(req *http.Request, tookEffect func() bool) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), verifierKey{}, tookEffect))
+}
+
+// retryTransport retries idempotent requests on network errors and gateway
+// failures. Non-idempotent requests (install, uninstall, exit...) are only
+// retried when the request provably never left this machine, or when their
+// verifier confirms they did not take effect, so a lost response can never
+// cause a double uninstall or double restart.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= *httpRetries || !t.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false // Body cannot be replayed
+	}
+	failed := err != nil || isGatewayFailure(resp)
+	if !failed {
+		return false
+	}
+	if errors.Is(err, errReadOnly) {
+		return false
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true
+	}
+	if err != nil && notSent(err) {
+		return true
+	}
+	if tookEffect, ok := req.Context().Value(verifierKey{}).(func() bool); ok {
+		return !tookEffect()
+	}
+	return false
+}
+
+func isGatewayFailure(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// notSent reports errors that happen before any byte of the request is
+// written: failing to resolve or connect.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
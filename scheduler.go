@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// scheduledTask is a pipeline the daemon runs on a fixed interval.
+type scheduledTask struct {
+	name   string
+	tenant string // Team the task belongs to, for -tenant-quotas
+	every  time.Duration
+	steps  []string
+	next   time.Time
+}
+
+// parseSchedule reads task definitions of the form
+// "name=interval:step,step;name=interval:step", e.g.
+// "check=1h:verify;weekly-restart=168h:quietDown,safeRestart,wait". A name
+// of the form tenant/name assigns the task to a tenant.
+func parseSchedule(spec string) ([]*scheduledTask, error) {
+	var tasks []*scheduledTask
+	for _, def := range strings.Split(spec, ";") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(def, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid task %q, expected name=interval:steps", def)
+		}
+		interval, stepSpec, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid task %q, expected name=interval:steps", def)
+		}
+		every, err := time.ParseDuration(interval)
+		if err != nil || every <= 0 {
+			return nil, fmt.Errorf("invalid interval for task %s: %q", name, interval)
+		}
+		steps, err := parsePipeline(stepSpec)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %v", name, err)
+		}
+		name = strings.TrimSpace(name)
+		tenant, _, ok := strings.Cut(name, "/")
+		if !ok {
+			tenant = defaultTenant
+		}
+		tasks = append(tasks, &scheduledTask{name: name, tenant: tenant, every: every, steps: steps})
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks scheduled, set -schedule")
+	}
+	return tasks, nil
+}
+
+// daemonCommand runs the scheduled tasks until the process is stopped. Tasks
+// run one at a time; a task that is due while another runs waits its turn,
+// and runs missed during a long task are skipped rather than queued. When
+// several tasks are due, the tenant that used the daemon least goes first.
+func daemonCommand(args []string) error {
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+	assumeYes = true // Scheduled tasks run unattended
+	tasks, err := parseSchedule(scheduleSpec)
+	if err != nil {
+		return err
+	}
+	if tenants.quotas, err = parseTenantQuotas(*tenantQuotas); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		task.next = now.Add(task.every)
+		health.schedule(task.name)
+		notify("📅", "Scheduled %s every %s: %s", task.name, task.every, strings.Join(task.steps, ", "))
+	}
+	if *healthAddr != "" {
+		if err := serveHealth(*healthAddr); err != nil {
+			return err
+		}
+	}
+
+	// Under systemd, report readiness and reload on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	ticks := watchdogTicks()
+	if err := sdNotify("READY=1"); err != nil {
+		notify("⚠️", "Cannot notify systemd: %v", err)
+	}
+
+	used := map[string]time.Duration{}
+	for {
+		due := nextTask(tasks, used, time.Now())
+		select {
+		case <-time.After(time.Until(due.next)):
+		case <-reload:
+			tasks = reloadDaemon(tasks)
+			continue
+		case <-ticks:
+			pingWatchdog()
+			continue
+		}
+
+		started := time.Now()
+		runWatched(ticks, func() { runScheduledTask(due) })
+		used[due.tenant] += time.Since(started)
+		for !due.next.After(time.Now()) {
+			due.next = due.next.Add(due.every)
+		}
+	}
+}
+
+func runScheduledTask(task *scheduledTask) {
+	notify("▶️", "Running scheduled task %s", task.name)
+	report = &runReport{Started: time.Now(), CorrelationID: newCorrelationID(), Wrapper: currentBuild(), attempt: 1}
+	tenants.enter(task.tenant)
+	defer tenants.enter("")
+	health.begin(task.name)
+	err := runPipeline(task.steps)
+	health.finish(task.name, report.Started, err)
+	if err != nil {
+		report.Error = err.Error()
+		report.Category = categorize(err)
+		notify("❌", "Task %s failed: %v", task.name, err)
+	} else {
+		notify("✅", "Task %s finished, next run at %s", task.name, task.next.Add(task.every).Format(time.Kitchen))
+	}
+	publishRun(report)
+
+	path, err := writeTaskReport(task.name)
+	if err != nil {
+		notify("⚠️", "Failed to write report for %s: %v", task.name, err)
+		return
+	}
+	notify("📝", "Report written to %s", path)
+}
+
+func writeTaskReport(name string) (string, error) {
+	if err := os.MkdirAll(reportsDir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(reportsDir, fmt.Sprintf("%s-%s.json", strings.ReplaceAll(name, "/", "-"), report.Started.Format("20060102-150405")))
+	return path, os.WriteFile(path, data, 0o644)
+}
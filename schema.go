@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+//go:generate sh -c "go run . config schema > jenkins-wrapper.schema.json"
+
+// schemaID is where the generated schema is published, for editors to fetch.
+const schemaID = "https://raw.githubusercontent.com/manebamol/jenkins-wrapper/main/jenkins-wrapper.schema.json"
+
+// configSchema builds a JSON Schema for the YAML configuration file from the
+// settings table, so it cannot drift from what the wrapper actually reads.
+func configSchema() map[string]any {
+	sections := map[string]map[string]any{}
+	for _, s := range settings {
+		name, key, _ := strings.Cut(s.yaml, ".")
+		section, ok := sections[name]
+		if !ok {
+			section = map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{},
+				"additionalProperties": false,
+			}
+			sections[name] = section
+		}
+		property := map[string]any{
+			"type":        "string",
+			"description": s.usage + " (flag -" + s.flag + ", env " + s.env + ")",
+		}
+		if s.def != "" {
+			property["default"] = s.def
+		}
+		if s.secret {
+			// Optional like every setting: secrets are better kept in the
+			// environment than in a file that gets committed
+			property["writeOnly"] = true
+			property["description"] = property["description"].(string) + "; optional, prefer setting " + s.env + " over keeping it in this file"
+		}
+		section["properties"].(map[string]any)[key] = property
+	}
+
+	properties := map[string]any{}
+	profile := map[string]any{}
+	for name, section := range sections {
+		properties[name] = section
+		profile[name] = section
+	}
+	properties["profiles"] = map[string]any{
+		"type":        "object",
+		"description": "Named profiles selected with -profile, overriding the top-level sections",
+		"additionalProperties": map[string]any{
+			"type":                 "object",
+			"properties":           profile,
+			"additionalProperties": false,
+		},
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  schemaID,
+		"title":                "jenkins-wrapper configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func printConfigSchema() error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(configSchema())
+}
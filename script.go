@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"strings"
+)
+
+// runScript executes a Groovy script through the script console and returns
+// its output. Requires the Administer permission.
+func runScript(script string) (string, error) {
+	form := url.Values{"script": {script}}
+	req, err := newJenkinsRequest("POST", "/scriptText", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError("failed to run script", resp)
+	}
+	out, err := io.ReadAll(limitBody(resp))
+	return string(out), err
+}
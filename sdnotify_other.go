@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// systemd only exists on Linux.
+func sdNotify(state string) error { return nil }
+
+func sdReloading() string { return "RELOADING=1" }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// winstoneConfigName is the Winstone properties file that carries secret
+// Jenkins options, written next to the Jenkins log. Jenkins re-reads it when
+// it restarts itself, so it has to outlive the run workspace.
+const winstoneConfigName = "jenkins-wrapper-winstone.properties"
+
+// secretOption matches Winstone options whose values must not appear on the
+// command line, e.g. --httpsKeyStorePassword.
+var secretOption = regexp.MustCompile(`(?i)(password|secret|token|credential)`)
+
+// cliEnv passes the API token to jenkins-cli.jar through the environment
+// variables it reads when -auth is omitted.
+func cliEnv() []string {
+	return append(os.Environ(), "JENKINS_USER_ID="+jenkinsUser, "JENKINS_API_TOKEN="+jenkinsToken)
+}
+
+// jenkinsArgs splits the configured Jenkins options into plain command line
+// arguments and secret ones. Secret options are written to a private Winstone
+// properties file, referenced with --config, instead.
+func jenkinsArgs() ([]string, []string, error) {
+	var args, secrets []string
+	var props strings.Builder
+	for _, option := range strings.Fields(jenkinsOptions) {
+		key, value, hasValue := strings.Cut(strings.TrimLeft(option, "-"), "=")
+		if !hasValue || !secretOption.MatchString(key) {
+			args = append(args, option)
+			continue
+		}
+		fmt.Fprintf(&props, "%s=%s\n", key, value)
+		secrets = append(secrets, value)
+	}
+	if len(secrets) == 0 {
+		return args, nil, nil
+	}
+
+	path := filepath.Join(filepath.Dir(jenkinsLogPath), winstoneConfigName)
+	if _, local := target.(localExecutor); local {
+		var err error
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := target.writeFile(path, []byte(props.String()), 0o600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return append(args, "--config="+path), secrets, nil
+}
+
+// checkNoSecrets refuses to launch a command whose arguments contain one of
+// the given secrets, since arguments show up in process listings (ps, Task
+// Manager, /proc) for every user on the machine.
+func checkNoSecrets(args []string, secrets ...string) error {
+	for _, arg := range args {
+		for _, secret := range secrets {
+			if secret != "" && strings.Contains(arg, secret) {
+				return fmt.Errorf("refusing to run %s: a secret would be visible in the process list", filepath.Base(args[0]))
+			}
+		}
+	}
+	return nil
+}
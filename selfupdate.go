@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// selfUpdateRepo is where the wrapper binaries are released.
+const selfUpdateRepo = "manebamol/jenkins-wrapper"
+
+// releaseAssetName is the name of the binary for this platform in a release,
+// e.g. jenkins-wrapper_linux_amd64 or jenkins-wrapper_windows_amd64.exe.
+func releaseAssetName() string {
+	name := fmt.Sprintf("jenkins-wrapper_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetchWrapperRelease looks up a release of the wrapper, the latest when tag
+// is empty.
+func fetchWrapperRelease(tag string) (*githubRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", githubAPI, selfUpdateRepo)
+	if tag != "" {
+		url = fmt.Sprintf("%s/repos/%s/releases/tags/%s", githubAPI, selfUpdateRepo, tag)
+	}
+	req, err := newGitHubRequest(url, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newHTTPStatusError("failed to find the wrapper release", resp)
+	}
+	var release githubRelease
+	return &release, decodeJSON(resp, &release)
+}
+
+// assetChecksum finds the SHA-256 of an asset in the checksums.txt of the
+// release, or failing that in its release notes.
+func assetChecksum(release *githubRelease, name string) (string, error) {
+	for _, asset := range release.Assets {
+		if asset.Name != "checksums.txt" {
+			continue
+		}
+		path := ws.path(downloadsDir, asset.Name)
+		if _, err := downloadGitHubAsset(asset.URL, path); err != nil {
+			return "", err
+		}
+		sums, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if sum := releaseChecksum(string(sums), name); sum != "" {
+			return sum, nil
+		}
+	}
+	if sum := releaseChecksum(release.Body, name); sum != "" {
+		return sum, nil
+	}
+	return "", fmt.Errorf("release %s lists no SHA-256 for %s", release.TagName, name)
+}
+
+// replaceExecutable moves the new binary over the running one. The file in
+// use cannot be overwritten on Windows but it can be renamed, so the old
+// binary is moved aside first and removed on the next update.
+func replaceExecutable(exe, downloaded string) error {
+	old := exe + ".old"
+	os.Remove(old)
+	if runtime.GOOS == "windows" {
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(downloaded, exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(downloaded, exe)
+}
+
+// selfUpdateCommand replaces the running binary with the latest release,
+// or the one given with -version, once its checksum is verified.
+func selfUpdateCommand(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	version := fs.String("version", "", "Release tag to install, e.g. v1.4.0 (default: the latest)")
+	check := fs.Bool("check", false, "Only report whether a newer release exists")
+	force := fs.Bool("force", false, "Install even when the release is not newer than this binary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	release, err := fetchWrapperRelease(*version)
+	if err != nil {
+		return err
+	}
+	current := wrapperVersion()
+	newer := current == "(devel)" || compareVersions(strings.TrimPrefix(release.TagName, "v"), strings.TrimPrefix(current, "v")) > 0
+	if *check {
+		if newer {
+			notify("⬆️", "%s is available, this is %s", release.TagName, current)
+		} else {
+			notify("✅", "%s is up to date", current)
+		}
+		return nil
+	}
+	if !newer && !*force && *version == "" {
+		notify("✅", "%s is up to date", current)
+		return nil
+	}
+
+	name := releaseAssetName()
+	var assetURL string
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			assetURL = asset.URL
+		}
+	}
+	if assetURL == "" {
+		return fmt.Errorf("release %s has no binary for %s/%s (%s)", release.TagName, runtime.GOOS, runtime.GOARCH, name)
+	}
+	want, err := assetChecksum(release, name)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if dryRunning("replace %s with %s %s", exe, name, release.TagName) {
+		return nil
+	}
+
+	// Downloaded next to the binary so the final rename stays on one file system
+	notify("⬇️", "Downloading %s %s...", name, release.TagName)
+	tmp := exe + ".new"
+	got, err := downloadGitHubAsset(assetURL, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("cannot write next to %s, run self-update as its owner: %v", exe, err)
+		}
+		return err
+	}
+	if got != want {
+		os.Remove(tmp)
+		return fmt.Errorf("checksum mismatch for %s: release says %s, downloaded file is %s", name, want, got)
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := replaceExecutable(exe, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	notify("🎉", "Updated %s from %s to %s", exe, current, release.TagName)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// watchdogInterval is how often to ping the systemd watchdog: half the
+// WatchdogSec= of the service, zero when it has none or it is meant for
+// another process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// progress counts the signs of life of a running task: status lines, steps
+// and HTTP exchanges. pausedUntil is the end of a deliberate wait, such as a
+// sleep step, in Unix nanoseconds.
+var (
+	progress    atomic.Int64
+	pausedUntil atomic.Int64
+)
+
+func markProgress() { progress.Add(1) }
+
+// pause sleeps for d, which the watchdog counts as progress.
+func pause(d time.Duration) {
+	pausedUntil.Store(time.Now().Add(d).UnixNano())
+	time.Sleep(d)
+}
+
+// watchdogTicks returns when to ping the systemd watchdog, nil without one.
+func watchdogTicks() <-chan time.Time {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return nil
+	}
+	return time.Tick(interval)
+}
+
+// pingWatchdog tells systemd the scheduler is alive.
+func pingWatchdog() {
+	if err := sdNotify("WATCHDOG=1"); err != nil {
+		debug(1, "Cannot ping the systemd watchdog: %v", err)
+	}
+}
+
+// runWatched runs a task while pinging the watchdog on every tick at which
+// the task made progress since the last one. A task that hangs stops the
+// pings, so systemd restarts the daemon.
+func runWatched(ticks <-chan time.Time, task func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		task()
+	}()
+	last := progress.Load()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticks:
+			now := progress.Load()
+			if now == last && time.Now().UnixNano() > pausedUntil.Load() {
+				debug(1, "No progress since the last watchdog ping, not pinging")
+				last = progress.Load() // The debug line is not progress
+				continue
+			}
+			last = now
+			pingWatchdog()
+		}
+	}
+}
+
+// reloadDaemon re-reads the configuration on SIGHUP. The signal is handled
+// between tasks, so a running task finishes with the configuration it
+// started with. Tasks that keep their name and interval keep their next
+// run; a configuration that does not load leaves the current one in effect.
+func reloadDaemon(tasks []*scheduledTask) []*scheduledTask {
+	sdNotify(sdReloading())
+	defer sdNotify("READY=1")
+
+	saved := map[*string]string{}
+	for _, s := range settings {
+		saved[s.value] = *s.value
+	}
+	err := loadSettings()
+	var fresh []*scheduledTask
+	if err == nil {
+		fresh, err = parseSchedule(scheduleSpec)
+	}
+	if err != nil {
+		for value, v := range saved {
+			*value = v
+		}
+		notify("⚠️", "Reload failed, keeping the current configuration: %v", err)
+		return tasks
+	}
+
+	now := time.Now()
+	for _, task := range fresh {
+		task.next = now.Add(task.every)
+		for _, old := range tasks {
+			if old.name == task.name && old.every == task.every {
+				task.next = old.next
+			}
+		}
+		health.schedule(task.name)
+	}
+	notify("🔄", "Configuration reloaded, %d tasks scheduled", len(fresh))
+	return fresh
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var reuseSession = flag.Bool("reuse-session", true, "Reuse the Jenkins session cookie and CSRF crumb across requests instead of authenticating every call")
+
+// crumb is a CSRF token issued by a controller for the current session.
+type crumb struct {
+	field, value string // Both empty when CSRF protection is off
+}
+
+// sessionTransport keeps the cookies a controller (or an SSO proxy in front
+// of it) hands out, and once Jenkins has issued a session, stops sending
+// basic auth. The CSRF crumb is fetched once per session and controller and
+// added to every state-changing request. A 401 or 403 on a session request
+// starts over with basic auth, which covers sessions lost to a restart.
+type sessionTransport struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	jar    *cookiejar.Jar
+	crumbs map[string]crumb // By host
+}
+
+func newSessionTransport(next http.RoundTripper) *sessionTransport {
+	t := &sessionTransport{next: next}
+	t.reset()
+	return t
+}
+
+func (t *sessionTransport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.jar, _ = cookiejar.New(nil)
+	t.crumbs = map[string]crumb{}
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !*reuseSession || !isJenkinsRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+	usedSession := t.hasSession(req.URL)
+	resp, err := t.send(req)
+	if err != nil || !usedSession || (resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden) {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil // Body cannot be replayed
+	}
+
+	resp.Body.Close()
+	t.reset()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(retry)
+}
+
+func (t *sessionTransport) send(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	t.authenticate(out)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if c := t.crumbFor(out); c.field != "" {
+			out.Header.Set(c.field, c.value)
+		}
+	}
+	resp, err := t.next.RoundTrip(out)
+	if err == nil {
+		t.cookies().SetCookies(req.URL, resp.Cookies())
+	}
+	return resp, err
+}
+
+// authenticate swaps basic auth for the session cookie once there is one.
+func (t *sessionTransport) authenticate(req *http.Request) {
+	if t.hasSession(req.URL) {
+		req.Header.Del("Authorization")
+	}
+	for _, c := range t.cookies().Cookies(req.URL) {
+		req.AddCookie(c)
+	}
+}
+
+func (t *sessionTransport) cookies() *cookiejar.Jar {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jar
+}
+
+// hasSession reports whether Jenkins issued a session cookie for u's host.
+func (t *sessionTransport) hasSession(u *url.URL) bool {
+	for _, c := range t.cookies().Cookies(u) {
+		if strings.HasPrefix(c.Name, "JSESSIONID") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *sessionTransport) crumbFor(req *http.Request) crumb {
+	t.mu.Lock()
+	c, ok := t.crumbs[req.URL.Host]
+	t.mu.Unlock()
+	if ok {
+		return c
+	}
+
+	u := *req.URL
+	u.Path, u.RawPath, u.RawQuery = strings.TrimSuffix(jenkinsURLPath(), "/")+"/crumbIssuer/api/json", "", ""
+	fetch, err := http.NewRequestWithContext(req.Context(), "GET", u.String(), nil)
+	if err != nil {
+		return c
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		fetch.Header.Set("Authorization", auth)
+	}
+	t.authenticate(fetch)
+	resp, err := t.next.RoundTrip(fetch)
+	if err != nil {
+		return c
+	}
+	defer resp.Body.Close()
+	t.cookies().SetCookies(req.URL, resp.Cookies())
+
+	// 404 means CSRF protection is off; other failures are retried next time
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var issued struct {
+			Crumb             string `json:"crumb"`
+			CrumbRequestField string `json:"crumbRequestField"`
+		}
+		if decodeJSON(resp, &issued) != nil {
+			return c
+		}
+		c = crumb{issued.CrumbRequestField, issued.Crumb}
+	case http.StatusNotFound:
+	default:
+		return c
+	}
+	t.mu.Lock()
+	t.crumbs[req.URL.Host] = c
+	t.mu.Unlock()
+	return c
+}
+
+// isJenkinsRequest tells requests to the configured controller apart from
+// downloads and other third-party calls that share the HTTP client.
+func isJenkinsRequest(req *http.Request) bool {
+	u, err := url.Parse(jenkinsURL)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, req.URL.Host)
+}
+
+// jenkinsURLPath is the context path Jenkins is served under, e.g. "/jenkins".
+func jenkinsURLPath() string {
+	u, err := url.Parse(jenkinsURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	simulate = flag.String("simulate", "", "Replay the responses recorded in this directory instead of calling Jenkins, animating a run without a controller, e.g. for training")
+	record   = flag.String("record", "", "Record every response in this directory as fixtures for -simulate")
+)
+
+// fixture is a recorded exchange. Requests are matched by method and path,
+// whatever the host, so fixtures work with any -jenkinsURL. Only the
+// response is kept: credentials and request bodies are never recorded.
+type fixture struct {
+	Method   string      `json:"method"`
+	Path     string      `json:"path"` // With the query
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	Omitted  bool        `json:"bodyOmitted,omitempty"` // Binary body of an artifact, not recorded
+	Error    string      `json:"error,omitempty"`       // E.g. connection refused while Jenkins was down
+	Duration float64     `json:"durationSeconds"`
+}
+
+// wireTransport is the bottom of the transport stack: the network, or the
+// fixtures of -simulate.
+type wireTransport struct {
+	next http.RoundTripper
+}
+
+func (t *wireTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req)
+}
+
+var wire = &wireTransport{next: http.DefaultTransport}
+
+// recordingTransport writes every exchange to a numbered fixture file.
+type recordingTransport struct {
+	dir  string
+	next http.RoundTripper
+
+	mu sync.Mutex
+	n  int
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f := fixture{Method: req.Method, Path: req.URL.RequestURI()}
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		f.Error = err.Error()
+	case binaryBody(req, resp):
+		// Passed through unbuffered; a replay answers with an empty body
+		f.Status, f.Header, f.Omitted = resp.StatusCode, resp.Header.Clone(), true
+		f.Header.Del("Set-Cookie")
+		f.Header.Del("Content-Length")
+	default:
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		f.Status, f.Header, f.Body = resp.StatusCode, resp.Header.Clone(), body
+		f.Header.Del("Set-Cookie")
+	}
+	f.Duration = time.Since(started).Seconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n++
+	data, jsonErr := json.MarshalIndent(f, "", "  ")
+	if jsonErr == nil {
+		jsonErr = os.WriteFile(filepath.Join(t.dir, fmt.Sprintf("%05d.json", t.n)), data, 0o600)
+	}
+	if jsonErr != nil {
+		debug(1, "Cannot record %s %s: %v", f.Method, f.Path, jsonErr)
+	}
+	return resp, err
+}
+
+// binaryBody tells artifacts such as WARs and plugins apart from API
+// responses: they are large and of no use as fixtures.
+func binaryBody(req *http.Request, resp *http.Response) bool {
+	switch strings.ToLower(path.Ext(req.URL.Path)) {
+	case ".war", ".hpi", ".jpi", ".jar", ".zip":
+		return true
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return ct == "application/octet-stream" || ct == "application/java-archive" || ct == "application/zip"
+}
+
+// fixtureTransport answers from recorded fixtures. Repeated requests get the
+// recorded responses in order, then the last one again, so polling loops
+// play out as they did; each answer takes as long as it did when recorded.
+type fixtureTransport struct {
+	mu       sync.Mutex
+	fixtures map[string][]fixture // By method and path
+}
+
+func loadFixtures(dir string) (*fixtureTransport, int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(files) == 0 {
+		return nil, 0, fmt.Errorf("no fixtures in %s, record some with -record", dir)
+	}
+	sort.Strings(files)
+	t := &fixtureTransport{fixtures: map[string][]fixture{}}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		var f fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", file, err)
+		}
+		key := f.Method + " " + f.Path
+		t.fixtures[key] = append(t.fixtures[key], f)
+	}
+	return t, len(files), nil
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.RequestURI()
+	t.mu.Lock()
+	queue := t.fixtures[key]
+	var f fixture
+	if len(queue) > 0 {
+		f = queue[0]
+		if len(queue) > 1 {
+			t.fixtures[key] = queue[1:]
+		}
+	}
+	t.mu.Unlock()
+
+	if f.Method == "" {
+		debug(1, "No fixture for %s, answering 404", key)
+		f = fixture{Status: http.StatusNotFound, Body: []byte("not recorded")}
+	}
+	select {
+	case <-time.After(time.Duration(f.Duration * float64(time.Second))):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	if f.Error != "" {
+		return nil, errors.New(f.Error)
+	}
+	header := f.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
+
+// simulatedExecutor pretends to start Jenkins and to write on its host;
+// reads still go to the wrapped executor.
+type simulatedExecutor struct {
+	executor
+}
+
+func (simulatedExecutor) start(args, env []string, logPath string) (*jenkinsProcess, error) {
+	simulated("start %s", strings.Join(args, " "))
+	return newJenkinsProcess(0), nil
+}
+
+func (simulatedExecutor) writeFile(path string, data []byte, mode os.FileMode) error {
+	return nil
+}
+
+func (simulatedExecutor) mkdir(path string) error {
+	return nil
+}
+
+func (simulatedExecutor) output(args []string) ([]byte, error) {
+	simulated("run %s", strings.Join(args, " "))
+	return nil, nil
+}
+
+// simulated reports an action that -simulate only pretends to take and
+// returns true when it must be skipped.
+func simulated(format string, args ...any) bool {
+	if *simulate == "" {
+		return false
+	}
+	debug(1, "Simulated: "+format, args...)
+	return true
+}
+
+// setupSimulation puts the recorder or the fixtures under the transport
+// stack. A simulation leaves nothing behind, so it keeps no run state or
+// deployment history either.
+func setupSimulation() error {
+	switch {
+	case *simulate != "" && *record != "":
+		return usageError{errors.New("-simulate and -record cannot be combined")}
+	case *record != "":
+		if err := os.MkdirAll(*record, 0o700); err != nil {
+			return err
+		}
+		wire.next = &recordingTransport{dir: *record, next: http.DefaultTransport}
+	case *simulate != "":
+		fixtures, n, err := loadFixtures(*simulate)
+		if err != nil {
+			return err
+		}
+		wire.next = fixtures
+		target = simulatedExecutor{target}
+		*stateFile, runHistory = "", ""
+		notify("🎭", "Simulation: Jenkins is played by the %d responses recorded in %s", n, *simulate)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldSink speaks the native journal protocol, which keeps the level as
+// a proper PRIORITY field instead of a text prefix.
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+func newJournaldSink() (sink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn: conn}, nil
+}
+
+func (s *journaldSink) write(e event) {
+	priority := 6 // info
+	switch e.Level {
+	case "ERROR":
+		priority = 3
+	case "WARNING":
+		priority = 4
+	case "DEBUG":
+		priority = 7
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", e.Text)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(priority))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", syslogTag)
+	writeJournalField(&buf, "JENKINS_WRAPPER_LEVEL", e.Level)
+	s.conn.Write(buf.Bytes())
+}
+
+// writeJournalField encodes a field, using the length-prefixed form for
+// values that contain newlines.
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+func (s *journaldSink) close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func newJournaldSink() (sink, error) {
+	return nil, errors.New("the systemd journal is only available on Linux")
+}
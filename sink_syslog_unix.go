@@ -0,0 +1,36 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink() (sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) write(e event) {
+	switch e.Level {
+	case "ERROR":
+		s.w.Err(e.Text)
+	case "WARNING":
+		s.w.Warning(e.Text)
+	case "DEBUG":
+		s.w.Debug(e.Text)
+	default:
+		s.w.Info(e.Text)
+	}
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	logFilePath = flag.String("log-file", "", "Also append every status line to this file")
+	useSyslog   = flag.Bool("syslog", false, "Also send status lines to syslog")
+	useJournald = flag.Bool("journald", false, "Also send status lines to the systemd journal")
+)
+
+// syslogTag identifies the wrapper in syslog and the journal.
+const syslogTag = "jenkins-wrapper"
+
+// sink receives every event of a run in its own format.
+type sink interface {
+	write(event)
+	close() error
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   = []sink{consoleSink{}}
+)
+
+// stepSink is a sink that also receives the pipeline steps as they start
+// and finish, for consumers that want structured records.
+type stepSink interface {
+	step(stepResult)
+}
+
+// runSink is a sink that also receives the report of every finished run.
+type runSink interface {
+	run(*runReport)
+}
+
+func publish(e event) {
+	markProgress()
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		s.write(e)
+	}
+}
+
+func publishRun(r *runReport) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		if s, ok := s.(runSink); ok {
+			s.run(r)
+		}
+	}
+}
+
+func publishStep(r stepResult) {
+	markProgress()
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		if s, ok := s.(stepSink); ok {
+			s.step(r)
+		}
+	}
+}
+
+// setupSinks picks the console output format and adds the sinks requested
+// on the command line next to it. A sink that cannot be opened is reported
+// but does not stop the run.
+func setupSinks() error {
+	switch *outputFormat {
+	case "text":
+	case "json":
+		sinksMu.Lock()
+		sinks = []sink{newJSONSink()}
+		sinksMu.Unlock()
+	case "cm":
+		cm = &cmSink{}
+		sinksMu.Lock()
+		sinks = []sink{cm}
+		sinksMu.Unlock()
+	default:
+		return fmt.Errorf("unknown -output %q, use text, json or cm", *outputFormat)
+	}
+
+	var extra []sink
+	if *logFilePath != "" {
+		if s, err := newFileSink(*logFilePath); err != nil {
+			notify("⚠️", "Cannot write log file: %v", err)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	if *useSyslog {
+		if s, err := newSyslogSink(); err != nil {
+			notify("⚠️", "Cannot log to syslog: %v", err)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	if *cloudEventsURL != "" {
+		extra = append(extra, newPublishingSink(newHTTPPublisher(*cloudEventsURL), "cloudevents"))
+	}
+	if *busURL != "" {
+		if s, err := newBusSink(*busURL, *busFormat); err != nil {
+			notify("⚠️", "Cannot publish to the message bus: %v", err)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	if *useJournald {
+		if s, err := newJournaldSink(); err != nil {
+			notify("⚠️", "Cannot log to the journal: %v", err)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+
+	sinksMu.Lock()
+	sinks = append(sinks, extra...)
+	sinksMu.Unlock()
+	return nil
+}
+
+func closeSinks() {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		s.close()
+	}
+	sinks = sinks[:1]
+}
+
+// fileSink appends timestamped, emoji-free lines to a log file.
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) write(e event) {
+	for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+		fmt.Fprintf(s.f, "%s %-7s %s\n", e.Time.Format(time.RFC3339), e.Level, line)
+	}
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var pluginSpec = flag.String("plugin", "", "Fetch the plugin from a source instead of -pluginPath, e.g. github:org/repo@v1.2.3, uc:git:5.2.1, maven:org.example:my-plugin:1.4.0 or incrementals:git:5.2.2-rc1234.abcdef012345")
+
+// pluginFetcher downloads a plugin into the run workspace and returns its
+// path. It receives the part of a -plugin spec after the scheme.
+type pluginFetcher func(ref string) (string, error)
+
+// pluginFetchers maps -plugin schemes to their fetchers.
+var pluginFetchers = map[string]pluginFetcher{
+	"file":         func(ref string) (string, error) { return ref, nil },
+	"github":       fetchGitHubRelease,
+	"uc":           fetchUpdateCenterPlugin,
+	"maven":        fetchMavenPlugin,
+	"incrementals": fetchIncrementalPlugin,
+}
+
+// resolvePluginSource turns -build-with, -pluginURL, -pluginGAV or -plugin
+// into pluginPath.
+func resolvePluginSource() error {
+	sources := 0
+	for _, set := range []bool{*buildWith != "", pluginURL != "", pluginGAV != "", *pluginSpec != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of -build-with, -pluginURL, -pluginGAV and -plugin can be given")
+	}
+	if pluginURL != "" {
+		path, err := fetchPluginURL(pluginURL)
+		if err != nil {
+			return err
+		}
+		return usePlugin(path)
+	}
+	if pluginGAV != "" {
+		path, err := fetchMavenPlugin(pluginGAV)
+		if err != nil {
+			return err
+		}
+		return usePlugin(path)
+	}
+	if *buildWith != "" {
+		path, err := buildPlugin()
+		if err != nil {
+			return err
+		}
+		return usePlugin(path)
+	}
+	if *pluginSpec == "" {
+		return nil
+	}
+	scheme, ref, ok := strings.Cut(*pluginSpec, ":")
+	fetch, known := pluginFetchers[scheme]
+	if !ok || !known {
+		schemes := make([]string, 0, len(pluginFetchers))
+		for s := range pluginFetchers {
+			schemes = append(schemes, s+":")
+		}
+		sort.Strings(schemes)
+		return fmt.Errorf("unsupported -plugin %q, expected one of %s", *pluginSpec, strings.Join(schemes, ", "))
+	}
+
+	path, err := fetch(ref)
+	if err != nil {
+		return err
+	}
+	return usePlugin(path)
+}
+
+// pluginFetched tells whether the plugin file comes from a source rather
+// than -pluginPath.
+func pluginFetched() bool {
+	return *buildWith != "" || pluginURL != "" || pluginGAV != "" || *pluginSpec != ""
+}
+
+// usePlugin deploys the plugin at path, taking its name from the manifest
+// when -pluginName was not given.
+func usePlugin(path string) error {
+	pluginPath = path
+
+	if pluginName == "" {
+		manifest, err := readPluginManifest(path)
+		if err != nil {
+			return err
+		}
+		pluginName = manifest.ShortName
+	}
+	return nil
+}
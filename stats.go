@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"Golang/jenkinswrapper"
+)
+
+// statsSample is one observation of controller load.
+type statsSample struct {
+	Time           time.Time `json:"time"`
+	QueueLength    int       `json:"queueLength"`
+	BusyExecutors  int       `json:"busyExecutors"`
+	TotalExecutors int       `json:"totalExecutors"`
+	Utilization    float64   `json:"utilization"`
+	Nodes          int       `json:"nodes"`
+	OnlineNodes    int       `json:"onlineNodes"`
+	BuildsStarted  int       `json:"buildsStarted"` // Builds started since the previous sample
+}
+
+func getJSON(path string, v any) error {
+	req, err := newJenkinsRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newHTTPStatusError("GET "+path+" failed", resp)
+	}
+	return decodeJSON(resp, v)
+}
+
+// buildsStartedSince counts builds of all jobs started after since.
+func buildsStartedSince(since time.Time) (int, error) {
+	n := 0
+	err := forEachBuildSince(since, func(time.Time) { n++ })
+	return n, err
+}
+
+func takeSample(since time.Time) (statsSample, error) {
+	s := statsSample{Time: time.Now()}
+
+	for _, err := range jenkinswrapper.Queue(httpClient, controller{}) {
+		if err != nil {
+			return s, err
+		}
+		s.QueueLength++
+	}
+
+	var computers struct {
+		BusyExecutors  int `json:"busyExecutors"`
+		TotalExecutors int `json:"totalExecutors"`
+	}
+	if err := getJSON("/computer/api/json?tree=busyExecutors,totalExecutors", &computers); err != nil {
+		return s, err
+	}
+	s.BusyExecutors = computers.BusyExecutors
+	s.TotalExecutors = computers.TotalExecutors
+	if s.TotalExecutors > 0 {
+		s.Utilization = float64(s.BusyExecutors) / float64(s.TotalExecutors)
+	}
+	for node, err := range jenkinswrapper.Nodes(httpClient, controller{}) {
+		if err != nil {
+			return s, err
+		}
+		s.Nodes++
+		if !node.Offline {
+			s.OnlineNodes++
+		}
+	}
+
+	started, err := buildsStartedSince(since)
+	if err != nil {
+		return s, err
+	}
+	s.BuildsStarted = started
+	return s, nil
+}
+
+// statsCommand samples queue, executor, node and build activity over a
+// window, so load before and after an update can be compared.
+func statsCommand(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	window := fs.Duration("window", 5*time.Minute, "How long to sample")
+	interval := fs.Duration("interval", 30*time.Second, "Time between samples")
+	format := fs.String("format", "csv", "Output format: csv or json")
+	out := fs.String("out", "", "Write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q, use csv or json", *format)
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		console = os.Stderr // The report goes to stdout
+	}
+	var samples []statsSample
+	since := time.Now().Add(-*interval)
+	deadline := time.Now().Add(*window)
+	for {
+		s, err := takeSample(since)
+		if err != nil {
+			return err
+		}
+		since = s.Time
+		samples = append(samples, s)
+		notify("📊", "queue=%d executors=%d/%d nodes=%d/%d builds=%d",
+			s.QueueLength, s.BusyExecutors, s.TotalExecutors, s.OnlineNodes, s.Nodes, s.BuildsStarted)
+		if time.Now().Add(*interval).After(deadline) {
+			break
+		}
+		time.Sleep(*interval)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(samples)
+	}
+	return writeStatsCSV(w, samples)
+}
+
+func writeStatsCSV(w io.Writer, samples []statsSample) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "queue_length", "busy_executors", "total_executors", "utilization", "nodes", "online_nodes", "builds_started"})
+	for _, s := range samples {
+		cw.Write([]string{
+			s.Time.Format(time.RFC3339),
+			strconv.Itoa(s.QueueLength),
+			strconv.Itoa(s.BusyExecutors),
+			strconv.Itoa(s.TotalExecutors),
+			strconv.FormatFloat(s.Utilization, 'f', 3, 64),
+			strconv.Itoa(s.Nodes),
+			strconv.Itoa(s.OnlineNodes),
+			strconv.Itoa(s.BuildsStarted),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
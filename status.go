@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"Golang/jenkinswrapper"
+)
+
+// controllerStatus is the dashboard shown by the status command.
+type controllerStatus struct {
+	Version        string
+	QuietingDown   bool
+	BusyExecutors  int
+	TotalExecutors int
+	QueueLength    int
+	PluginJobs     []string // Update center jobs still pending or installing
+	Plugin         string   // State of the configured plugin, if any
+}
+
+func fetchStatus() (controllerStatus, error) {
+	var s controllerStatus
+	req, err := newJenkinsRequest("GET", "/api/json?tree=quietingDown", nil)
+	if err != nil {
+		return s, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return s, newHTTPStatusError("failed to read status", resp)
+	}
+	s.Version = resp.Header.Get("X-Jenkins")
+	var root struct {
+		QuietingDown bool `json:"quietingDown"`
+	}
+	if err := decodeJSON(resp, &root); err != nil {
+		return s, err
+	}
+	s.QuietingDown = root.QuietingDown
+
+	if pluginName != "" {
+		plugin, err := findPlugin(pluginName)
+		if err != nil {
+			return s, err
+		}
+		s.Plugin = fmt.Sprintf("%s %s", pluginName, plugin.state())
+		if plugin != nil {
+			s.Plugin = fmt.Sprintf("%s %s %s", pluginName, plugin.Version, plugin.state())
+		}
+	}
+
+	var computers struct {
+		BusyExecutors  int `json:"busyExecutors"`
+		TotalExecutors int `json:"totalExecutors"`
+	}
+	if err := getJSON("/computer/api/json?tree=busyExecutors,totalExecutors", &computers); err != nil {
+		return s, err
+	}
+	s.BusyExecutors, s.TotalExecutors = computers.BusyExecutors, computers.TotalExecutors
+
+	for _, err := range jenkinswrapper.Queue(httpClient, controller{}) {
+		if err != nil {
+			return s, err
+		}
+		s.QueueLength++
+	}
+
+	var updateCenter struct {
+		Jobs []struct {
+			Name   string `json:"name"`
+			Status struct {
+				Type string `json:"type"`
+			} `json:"status"`
+		} `json:"jobs"`
+	}
+	if err := getJSON("/updateCenter/api/json?tree=jobs[name,status[type]]", &updateCenter); err != nil {
+		return s, err
+	}
+	for _, job := range updateCenter.Jobs {
+		if job.Name != "" && (job.Status.Type == "Pending" || job.Status.Type == "Installing") {
+			s.PluginJobs = append(s.PluginJobs, fmt.Sprintf("%s (%s)", job.Name, strings.ToLower(job.Status.Type)))
+		}
+	}
+	return s, nil
+}
+
+func (s controllerStatus) String() string {
+	mode := "running"
+	if s.QuietingDown {
+		mode = "quieting down"
+	}
+	jobs := "none"
+	if len(s.PluginJobs) > 0 {
+		jobs = strings.Join(s.PluginJobs, ", ")
+	}
+	out := fmt.Sprintf("%s  Jenkins %s, %s\nExecutors  %d/%d busy\nQueue      %d waiting\nPlugins    %s\n",
+		jenkinsURL, s.Version, mode, s.BusyExecutors, s.TotalExecutors, s.QueueLength, jobs)
+	if s.Plugin != "" {
+		out += fmt.Sprintf("Plugin     %s\n", s.Plugin)
+	}
+	return out
+}
+
+// statusCommand prints a compact controller dashboard, refreshing it in place
+// with -watch until interrupted.
+func statusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	watch := fs.Bool("watch", false, "Keep refreshing the dashboard")
+	interval := fs.Duration("interval", 5*time.Second, "Time between refreshes with -watch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	clear := ""
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		clear = "\033[H\033[2J"
+	}
+	for {
+		s, err := fetchStatus()
+		if !*watch {
+			if err != nil {
+				return err
+			}
+			fmt.Print(s)
+			return nil
+		}
+		fmt.Print(clear)
+		if err != nil {
+			// Expected while Jenkins restarts, keep watching
+			fmt.Printf("%s  unreachable: %v\n", jenkinsURL, err)
+		} else {
+			fmt.Print(s)
+		}
+		fmt.Printf("\nUpdated %s, every %v. Ctrl+C to stop.\n", time.Now().Format("15:04:05"), *interval)
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"net/http"
+	"os"
+	"runtime"
+)
+
+var (
+	userAgent         = flag.String("user-agent", "", "User-Agent sent with every request (default: jenkins-wrapper/<version> (<os>/<arch>; run <correlation-id>), without the run for hosts other than Jenkins)")
+	correlationID     = flag.String("correlation-id", os.Getenv("JENKINS_WRAPPER_CORRELATION_ID"), "ID sent with every request to Jenkins so access logs can be matched to this run, e.g. from an upstream CI job (default: random per run; env JENKINS_WRAPPER_CORRELATION_ID)")
+	correlationHeader = flag.String("correlation-header", "X-Correlation-ID", "Header carrying -correlation-id on requests to Jenkins, empty to send none")
+)
+
+// newCorrelationID returns the ID for a new run: the supplied one, or a
+// random one per run when none was.
+func newCorrelationID() string {
+	if *correlationID != "" {
+		return *correlationID
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// runCorrelationID returns the correlation ID of the current run report,
+// assigning one on first use.
+func runCorrelationID() string {
+	if report.CorrelationID == "" {
+		report.CorrelationID = newCorrelationID()
+	}
+	return report.CorrelationID
+}
+
+// taggingTransport sets the User-Agent on every request, and the correlation
+// header on requests to the controller, so its access logs can attribute the
+// traffic. The default User-Agent carries the correlation ID too, since the
+// common combined log format records it but no custom headers; other hosts
+// get neither.
+type taggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t taggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	jenkins := isJenkinsRequest(req)
+	ua := *userAgent
+	if ua == "" {
+		platform := runtime.GOOS + "/" + runtime.GOARCH
+		if jenkins {
+			platform += "; run " + runCorrelationID()
+		}
+		ua = "jenkins-wrapper/" + wrapperVersion() + " (" + platform + ")"
+	}
+	req.Header.Set("User-Agent", ua)
+	if jenkins && *correlationHeader != "" {
+		req.Header.Set(*correlationHeader, runCorrelationID())
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var templatesDir string // Where saved invocations are kept
+
+var (
+	templateName        = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+)
+
+// templateDir returns the directory of saved templates: -templates-dir, e.g.
+// a directory in a shared repository, or the user's config directory.
+func templateDir() (string, error) {
+	if templatesDir != "" {
+		return templatesDir, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "jenkins-wrapper", "templates"), nil
+}
+
+// A template is a text file with one command line argument per line, so no
+// quoting is involved; lines starting with # are comments, the first one
+// describes the template. {{name}} placeholders are filled in with -var.
+func templatePath(name string) (string, error) {
+	if !templateName.MatchString(name) {
+		return "", usageError{fmt.Errorf("invalid template name %q, use letters, digits, - and _", name)}
+	}
+	dir, err := templateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".args"), nil
+}
+
+// readTemplate returns the arguments and description of a saved template.
+func readTemplate(name string) ([]string, string, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("no template %s in %s", name, filepath.Dir(path))
+	} else if err != nil {
+		return nil, "", err
+	}
+	var args []string
+	description := ""
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			if description == "" {
+				description = strings.TrimSpace(comment)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			args = append(args, line)
+		}
+	}
+	return args, description, nil
+}
+
+// expandTemplate fills in the placeholders, naming all that have no value.
+func expandTemplate(args []string, vars map[string]string) ([]string, error) {
+	var missing []string
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = templatePlaceholder.ReplaceAllStringFunc(arg, func(m string) string {
+			name := templatePlaceholder.FindStringSubmatch(m)[1]
+			value, ok := vars[name]
+			if !ok && !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return value
+		})
+	}
+	if len(missing) > 0 {
+		return nil, usageError{fmt.Errorf("missing -var for %s", strings.Join(missing, ", "))}
+	}
+	return expanded, nil
+}
+
+// templateCommand manages saved templates: save, list and show.
+func templateCommand(args []string) error {
+	usage := usageError{errors.New("usage: template save [-description <text>] <name> <arguments...> | list | show <name>")}
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "save":
+		// Flags go before the name: everything after it is the template
+		fs := flag.NewFlagSet("template save", flag.ContinueOnError)
+		description := fs.String("description", "", "Description shown by template list")
+		if err := fs.Parse(args[1:]); err != nil {
+			return usageError{err}
+		}
+		if fs.NArg() < 2 {
+			return usage
+		}
+		name, rest := fs.Arg(0), fs.Args()[1:]
+		if rest[0] == "-description" || rest[0] == "--description" {
+			return usageError{errors.New("-description goes before the template name")}
+		}
+		path, err := templatePath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		var b strings.Builder
+		if *description != "" {
+			if strings.Contains(*description, "\n") {
+				return usageError{errors.New("template descriptions cannot span lines")}
+			}
+			fmt.Fprintf(&b, "# %s\n", *description)
+		}
+		for _, arg := range rest {
+			if strings.Contains(arg, "\n") {
+				return usageError{fmt.Errorf("template arguments cannot span lines: %q", arg)}
+			}
+			b.WriteString(arg + "\n")
+		}
+		if err := writeFileAtomic(path, []byte(b.String()), 0o644); err != nil {
+			return err
+		}
+		notify("💾", "Saved template %s to %s", name, path)
+		return nil
+	case "list":
+		dir, err := templateDir()
+		if err != nil {
+			return err
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.args"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			notify("ℹ️", "No templates in %s", dir)
+			return nil
+		}
+		var lines []string
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".args")
+			_, description, err := readTemplate(name)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, fmt.Sprintf("%-20s %s", name, description))
+		}
+		printOutput(strings.Join(lines, "\n"))
+		return nil
+	case "show":
+		if len(args) != 2 {
+			return usage
+		}
+		templateArgs, description, err := readTemplate(args[1])
+		if err != nil {
+			return err
+		}
+		var vars []string
+		for _, arg := range templateArgs {
+			for _, m := range templatePlaceholder.FindAllStringSubmatch(arg, -1) {
+				if !slices.Contains(vars, m[1]) {
+					vars = append(vars, m[1])
+				}
+			}
+		}
+		printOutput(fmt.Sprintf("%s\n  %s\nvariables: %s", description, strings.Join(templateArgs, " "), strings.Join(vars, ", ")))
+		return nil
+	}
+	return usage
+}
+
+// runTemplateCommand runs a saved template as if its arguments had been
+// given on the command line, after the ones that were. Options read before
+// any command runs, such as -output, -config or -simulate, must be given on
+// the command line itself; -dry-run, -read-only and -remote-host work in
+// templates too.
+func runTemplateCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usageError{errors.New("usage: run-template <name> [-var name=value]...")}
+	}
+	vars := map[string]string{}
+	fs := flag.NewFlagSet("run-template", flag.ContinueOnError)
+	fs.Func("var", "Value of a template placeholder, as name=value; repeatable", func(v string) error {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("expected name=value, got %q", v)
+		}
+		vars[name] = value
+		return nil
+	})
+	if err := fs.Parse(args[1:]); err != nil {
+		return usageError{err}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))}
+	}
+
+	templateArgs, _, err := readTemplate(args[0])
+	if err != nil {
+		return err
+	}
+	expanded, err := expandTemplate(templateArgs, vars)
+	if err != nil {
+		return err
+	}
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError) // Report, do not exit
+	if err := flag.CommandLine.Parse(expanded); err != nil {
+		return usageError{err}
+	}
+	target = localExecutor{} // Set up again for the options of the template
+	if err := setupExecutor(); err != nil {
+		return err
+	}
+	command := flag.Args()
+	switch {
+	case len(command) == 0:
+		command = []string{"update"}
+	case command[0] == "run-template":
+		return usageError{errors.New("a template cannot run another template")}
+	}
+	notify("📋", "Running template %s", args[0]) // Its arguments may hold secrets
+	return runCommand(command)
+}
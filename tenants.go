@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var tenantQuotas = flag.String("tenant-quotas", "", "Per-tenant API quotas of the daemon as tenant=requests-per-second:burst, comma-separated; * applies to tenants not listed (default: unlimited)")
+
+// defaultTenant owns scheduled tasks whose name has no tenant/ prefix.
+const defaultTenant = "default"
+
+// tokenBucket allows rate requests per second on average and bursts of up
+// to burst requests.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// tenantLimiter holds a token bucket per tenant, created on first use from
+// -tenant-quotas.
+type tenantLimiter struct {
+	mu      sync.Mutex
+	quotas  map[string][2]float64
+	buckets map[string]*tokenBucket
+	current string // Tenant whose task is running, "" outside the daemon
+}
+
+var tenants = &tenantLimiter{buckets: map[string]*tokenBucket{}}
+
+// parseTenantQuotas reads "tenant=rate:burst,..." specs.
+func parseTenantQuotas(spec string) (map[string][2]float64, error) {
+	quotas := map[string][2]float64{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tenant, quota, ok := strings.Cut(entry, "=")
+		rate, burst, ok2 := strings.Cut(quota, ":")
+		r, err := strconv.ParseFloat(rate, 64)
+		b, err2 := strconv.ParseFloat(burst, 64)
+		if !ok || !ok2 || err != nil || err2 != nil || r <= 0 || b < 1 {
+			return nil, fmt.Errorf("invalid tenant quota %q, expected tenant=requests-per-second:burst", entry)
+		}
+		quotas[strings.TrimSpace(tenant)] = [2]float64{r, b}
+	}
+	return quotas, nil
+}
+
+// enter makes the tenant's quota apply to the requests that follow.
+func (l *tenantLimiter) enter(tenant string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = tenant
+}
+
+// wait blocks until the running tenant may send another request.
+func (l *tenantLimiter) wait(req *http.Request) error {
+	l.mu.Lock()
+	if l.current == "" || l.quotas == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	b, ok := l.buckets[l.current]
+	if !ok {
+		q, ok := l.quotas[l.current]
+		if !ok {
+			q, ok = l.quotas["*"]
+		}
+		if ok {
+			b = newTokenBucket(q[0], q[1])
+		}
+		l.buckets[l.current] = b
+	}
+	tenant := l.current
+	l.mu.Unlock()
+	if b == nil {
+		return nil // Unlimited
+	}
+
+	delay := b.reserve()
+	if delay == 0 {
+		return nil
+	}
+	debug(1, "Tenant %s is over its API quota, waiting %s", tenant, delay.Round(time.Millisecond))
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// quotaTransport holds back requests of a tenant that used up its quota.
+// It sits below the session, so crumb requests and retries count as well.
+type quotaTransport struct {
+	next http.RoundTripper
+}
+
+func (t quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := tenants.wait(req); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// nextTask picks the task to run among those due: the one whose tenant has
+// used the daemon for the shortest time so far, so a tenant with slow, many
+// or frequent tasks cannot keep the others waiting. Without a due task it
+// returns the one due soonest.
+func nextTask(tasks []*scheduledTask, used map[string]time.Duration, now time.Time) *scheduledTask {
+	var pick *scheduledTask
+	for _, task := range tasks {
+		switch {
+		case pick == nil:
+			pick = task
+		case !task.next.After(now) && !pick.next.After(now):
+			if used[task.tenant] < used[pick.tenant] {
+				pick = task
+			}
+		case task.next.Before(pick.next):
+			pick = task
+		}
+	}
+	return pick
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpTrace is a single request/response exchange with Jenkins. Credentials
+// are never recorded.
+type httpTrace struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Status   int       `json:"status,omitempty"`
+	Duration float64   `json:"durationSeconds"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// maxTraces is how many of the latest requests a support bundle shows, so
+// long-running modes such as the daemon do not grow without bound.
+const maxTraces = 1000
+
+// tracingTransport records the latest maxTraces requests that go through it.
+type tracingTransport struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	traces []httpTrace
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.User = nil
+	trace := httpTrace{Time: time.Now(), Method: req.Method, URL: u.String()}
+
+	debug(2, "%s %s%s", req.Method, trace.URL, formatHeaders(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	markProgress()
+	trace.Duration = time.Since(trace.Time).Seconds()
+	if err != nil {
+		trace.Error = err.Error()
+		debug(1, "%s %s: %v (%.2fs)", req.Method, trace.URL, err, trace.Duration)
+	} else {
+		trace.Status = resp.StatusCode
+		var headers string
+		if verbosity() >= 2 {
+			headers = formatHeaders(resp.Header)
+		}
+		debug(1, "%s %s: %s (%.2fs)%s", req.Method, trace.URL, resp.Status, trace.Duration, headers)
+	}
+
+	t.mu.Lock()
+	t.traces = append(t.traces, trace)
+	if len(t.traces) >= 2*maxTraces {
+		// Copied, so the dropped ones are not kept alive by the array
+		t.traces = append([]httpTrace(nil), t.traces[len(t.traces)-maxTraces:]...)
+	}
+	t.mu.Unlock()
+	return resp, err
+}
+
+// sensitiveHeaders are masked when headers are printed.
+var sensitiveHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true, "Jenkins-Crumb": true}
+
+// formatHeaders lists headers one per line, each starting with a newline.
+func formatHeaders(h http.Header) string {
+	var b strings.Builder
+	for _, name := range sortedKeys(h) {
+		for _, value := range h[name] {
+			if sensitiveHeaders[name] {
+				value = "****"
+			}
+			fmt.Fprintf(&b, "\n  %s: %s", name, value)
+		}
+	}
+	return b.String()
+}
+
+func (t *tracingTransport) snapshot() []httpTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]httpTrace(nil), t.traces[max(0, len(t.traces)-maxTraces):]...)
+}
+
+var traces = &tracingTransport{next: readOnlyTransport{next: dryRunTransport{next: wire}}}
+
+// session is shared by both clients so they use the same Jenkins session.
+var session = newSessionTransport(quotaTransport{next: taggingTransport{next: traces}})
+
+var (
+	httpTimeout     = flag.Duration("http-timeout", 2*time.Minute, "Longest an HTTP call may take, retries included (0 for no limit)")
+	downloadTimeout = flag.Duration("download-timeout", 30*time.Minute, "Longest a download or plugin upload may take, retries included (0 for no limit)")
+)
+
+// httpClient is shared by every call to Jenkins so all traffic is traced,
+// including each retry.
+var httpClient = &http.Client{Transport: &retryTransport{next: session}}
+
+// pollClient skips retries, for callers that poll on their own.
+var pollClient = &http.Client{Transport: session}
+
+// downloadClient is httpClient with the longer -download-timeout, for
+// transfers of plugins, WARs and other artifacts.
+var downloadClient = &http.Client{Transport: httpClient.Transport}
+
+// setHTTPTimeouts applies the timeout flags to the shared clients.
+func setHTTPTimeouts() {
+	httpClient.Timeout = *httpTimeout
+	pollClient.Timeout = *httpTimeout
+	actionClient.Timeout = *httpTimeout
+	downloadClient.Timeout = *downloadTimeout
+}
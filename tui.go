@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tuiActions are the operations the dashboard offers, by key.
+var tuiActions = map[byte]struct {
+	name string
+	run  func(args []string) error
+}{
+	'i': {"install", pipelineCommand([]string{"install"})},
+	'u': {"uninstall", pipelineCommand([]string{"uninstall"})},
+	'r': {"restart", pipelineCommand(restartPipeline)},
+	'U': {"update", pipelineCommand(nil)},
+}
+
+// tuiLogLines is how many status lines of the running action stay visible.
+const tuiLogLines = 8
+
+// tuiSink stands in for the console while the dashboard runs, keeping the
+// last status lines for the log pane instead of scrolling the screen.
+type tuiSink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *tuiSink) write(e event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+		s.lines = append(s.lines, time.Now().Format("15:04:05 ")+strings.TrimSpace(e.Prefix+" "+line))
+	}
+	if len(s.lines) > tuiLogLines {
+		s.lines = s.lines[len(s.lines)-tuiLogLines:]
+	}
+}
+
+func (s *tuiSink) close() error { return nil }
+
+func (s *tuiSink) tail() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// runningBuilds lists what the executors of the controller are building.
+func runningBuilds() ([]string, error) {
+	type executor struct {
+		CurrentExecutable *struct {
+			FullDisplayName string `json:"fullDisplayName"`
+		} `json:"currentExecutable"`
+	}
+	var computers struct {
+		Computer []struct {
+			DisplayName     string     `json:"displayName"`
+			Executors       []executor `json:"executors"`
+			OneOffExecutors []executor `json:"oneOffExecutors"`
+		} `json:"computer"`
+	}
+	if err := getJSON("/computer/api/json?tree=computer[displayName,executors[currentExecutable[fullDisplayName]],oneOffExecutors[currentExecutable[fullDisplayName]]]", &computers); err != nil {
+		return nil, err
+	}
+	var builds []string
+	for _, c := range computers.Computer {
+		for _, e := range append(c.Executors, c.OneOffExecutors...) {
+			if e.CurrentExecutable != nil {
+				builds = append(builds, fmt.Sprintf("%s on %s", e.CurrentExecutable.FullDisplayName, c.DisplayName))
+			}
+		}
+	}
+	return builds, nil
+}
+
+// tuiState is what the dashboard shows of the controller, fetched in the
+// background so keys are answered at once even while Jenkins is down.
+type tuiState struct {
+	fetched    bool // False until the first fetch finished
+	status     controllerStatus
+	statusErr  error
+	builds     []string
+	buildsErr  error
+	plugins    []installedPlugin
+	pluginsErr error
+}
+
+func fetchTUIState() tuiState {
+	s := tuiState{fetched: true}
+	s.status, s.statusErr = fetchStatus()
+	s.builds, s.buildsErr = runningBuilds()
+	s.plugins, s.pluginsErr = listPlugins()
+	return s
+}
+
+// tuiCommand runs an interactive dashboard of the controller: its status,
+// installed plugins and running builds, with keys to install, uninstall or
+// restart while developing a plugin.
+func tuiCommand(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	interval := fs.Duration("interval", 5*time.Second, "Time between refreshes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !interactive() || runtime.GOOS == "windows" {
+		return errors.New("tui needs an interactive Unix terminal, use status -watch instead")
+	}
+	if err := ensureJenkinsURL(); err != nil {
+		return err
+	}
+
+	stty := func(args ...string) {
+		if checkLaunch("stty") != nil {
+			return // Keys then need Enter
+		}
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-icanon", "-echo", "min", "1")
+	fmt.Print("\033[?25l") // Hide the cursor
+	var restored sync.Once
+	restore := func() {
+		restored.Do(func() {
+			stty("icanon", "echo")
+			fmt.Print("\033[?25h\n")
+		})
+	}
+	defer restore()
+	onInterrupt(restore) // Ctrl+C and SIGTERM exit without running defers
+
+	// The rescue prompt would compete with the dashboard for keys, and
+	// actions are confirmed by the dashboard itself
+	*rescueTimeout = 0
+	assumeYes = true
+
+	log := &tuiSink{}
+	sinksMu.Lock()
+	console := sinks[0]
+	sinks[0] = log
+	sinksMu.Unlock()
+	var reattached sync.Once
+	reattach := func() {
+		reattached.Do(func() {
+			sinksMu.Lock()
+			sinks[0] = console
+			sinksMu.Unlock()
+		})
+	}
+	defer reattach()
+	onInterrupt(reattach) // So the interrupt is reported on the terminal
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buf); err != nil || n == 0 {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	// Fetched every -interval, and right after an action finished
+	states, refresh, stop := make(chan tuiState), make(chan struct{}, 1), make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case states <- fetchTUIState():
+			case <-stop:
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-refresh:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var (
+		running string   // Action in progress, "" when idle
+		pending byte     // Action key waiting for confirmation
+		offset  int      // First plugin row shown
+		state   tuiState // Latest fetched state of the controller
+		done    = make(chan error, 1)
+	)
+	for {
+		prompt := "[i]nstall  [u]ninstall  [r]estart  [U]pdate  [j/k] scroll plugins  [q]uit"
+		switch {
+		case running != "":
+			prompt = "Running " + running + "..."
+		case pending != 0:
+			prompt = fmt.Sprintf("%s %s on %s? [y/N]", tuiActions[pending].name, pluginName, jenkinsURL)
+		}
+		drawTUI(state, prompt, &offset, log.tail())
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch {
+			case pending != 0:
+				if key == 'y' || key == 'Y' {
+					action := tuiActions[pending]
+					running = action.name
+					go func() { done <- action.run(nil) }()
+				}
+				pending = 0
+			case key == 'q':
+				if running != "" {
+					log.write(event{Prefix: "⚠️", Text: "Wait for " + running + " to finish before quitting"})
+					continue
+				}
+				return nil
+			case key == 'j':
+				offset++
+			case key == 'k' && offset > 0:
+				offset--
+			case running == "":
+				if _, ok := tuiActions[key]; ok {
+					pending = key
+				}
+			}
+		case err := <-done:
+			if err != nil {
+				log.write(event{Prefix: "❌", Text: running + " failed: " + err.Error()})
+			}
+			running = ""
+			select {
+			case refresh <- struct{}{}:
+			default:
+			}
+		case state = <-states:
+		}
+	}
+}
+
+// drawTUI repaints the whole dashboard from the fetched state. offset is
+// clamped to the plugins available.
+func drawTUI(state tuiState, prompt string, offset *int, logLines []string) {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	switch {
+	case !state.fetched:
+		fmt.Fprintf(&b, "%s  connecting...\n", jenkinsURL)
+	case state.statusErr != nil:
+		fmt.Fprintf(&b, "%s  unreachable: %v\n", jenkinsURL, state.statusErr)
+	default:
+		b.WriteString(state.status.String())
+	}
+
+	b.WriteString("\nRunning builds\n")
+	if !state.fetched {
+		b.WriteString("  loading...\n")
+	} else if state.buildsErr != nil {
+		fmt.Fprintf(&b, "  unavailable: %v\n", state.buildsErr)
+	} else if len(state.builds) == 0 {
+		b.WriteString("  none\n")
+	} else {
+		for _, build := range state.builds {
+			fmt.Fprintf(&b, "  %s\n", build)
+		}
+	}
+
+	const rows = 10
+	plugins := state.plugins
+	fmt.Fprintf(&b, "\nInstalled plugins (%d)\n", len(plugins))
+	if state.pluginsErr != nil {
+		fmt.Fprintf(&b, "  unavailable: %v\n", state.pluginsErr)
+	}
+	*offset = max(0, min(*offset, len(plugins)-rows))
+	for _, p := range plugins[*offset:min(len(plugins), *offset+rows)] {
+		marker := " "
+		if p.ShortName == pluginName {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, " %s%-40s %-20s %s\n", marker, p.ShortName, p.Version, p.state())
+	}
+
+	b.WriteString("\nLog\n")
+	for _, line := range logLines {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	fmt.Fprintf(&b, "\n%s\n", prompt)
+	fmt.Print(b.String())
+}
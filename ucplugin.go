@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// fetchUpdateCenterPlugin downloads a plugin release from the update center,
+// given as "name:version", or "name" for the latest release. Downloads are
+// checked against the checksum the update center publishes, and kept in the
+// artifact cache with the ones of the matrix and the mirror. Incremental
+// builds, e.g. git:5.2.2-rc1234.abcdef012345, come from the incrementals
+// repository instead. A renamed plugin is installed under its new name; a
+// pinned version of the old name is refused, as it is not a release of the
+// successor.
+func fetchUpdateCenterPlugin(ref string) (string, error) {
+	name, version, _ := strings.Cut(ref, ":")
+	if name == "" {
+		return "", usageError{fmt.Errorf("invalid plugin %q, expected name:version", ref)}
+	}
+	if incrementalVersion.MatchString(version) {
+		return fetchIncrementalPlugin(ref)
+	}
+	uc, err := fetchUpdateCenter()
+	if err != nil {
+		return "", err
+	}
+	current, err := uc.resolvePluginName(name)
+	if err != nil {
+		return "", err
+	}
+	if current != name {
+		if version != "" {
+			return "", usageError{fmt.Errorf("%s was renamed to %s, version %s is a release of the old plugin; pin a release of %s instead", name, current, version, current)}
+		}
+		if pluginName == name {
+			pluginName = current // Later steps act on the successor
+		}
+		name = current
+	}
+	latest := uc.Plugins[name]
+	if version == "" {
+		version = latest.Version
+	}
+
+	want, _ := uc.checksum(name, version)
+	return cachedPlugin(name, version, want)
+}
+
+// checksum returns the SHA-256 the update center publishes for a plugin
+// release, which it only does for the latest one.
+func (uc *updateCenter) checksum(name, version string) (string, bool) {
+	latest, ok := uc.Plugins[name]
+	if !ok || latest.Version != version {
+		return "", false
+	}
+	sum, err := base64.StdEncoding.DecodeString(latest.Sha256)
+	if err != nil || len(sum) != 32 {
+		return "", false
+	}
+	return hex.EncodeToString(sum), true
+}
+
+// pluginChecksum fetches the SHA-256 the download mirrors publish next to a
+// plugin release, from the first that has it; update-center.json only lists
+// the latest release.
+func pluginChecksum(name, version string) (string, error) {
+	var failed []error
+	for _, u := range pluginDownloadURLs(name, version) {
+		want, err := fetchChecksum(u + ".sha256")
+		if err == nil {
+			return want, nil
+		}
+		failed = append(failed, fmt.Errorf("failed to find %s %s: %w", name, version, err))
+	}
+	if len(failed) == 0 {
+		return "", errors.New("no -plugin-mirrors to download from")
+	}
+	return "", errors.Join(failed...)
+}
+
+func fetchChecksum(u string) (string, error) {
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError(u, resp)
+	}
+	sum, err := io.ReadAll(limitBody(resp))
+	if err != nil {
+		return "", err
+	}
+	want, _, _ := strings.Cut(strings.TrimSpace(string(sum)), " ")
+	return strings.ToLower(want), nil
+}
+
+// installPluginCommand installs a plugin release from the update center,
+// e.g. install-plugin git:5.2.1, like install does with a local file.
+func installPluginCommand(args []string) error {
+	if len(args) != 1 {
+		return usageError{errors.New("usage: install-plugin <name>[:<version>]")}
+	}
+	if *buildWith != "" {
+		return usageError{errors.New("install-plugin cannot be combined with -build-with")}
+	}
+	*pluginSpec = "uc:" + args[0]
+	pluginName, _, _ = strings.Cut(args[0], ":")
+	return pipelineCommand([]string{"install"})(nil)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Where plugins are resolved and downloaded from: updates.jenkins.io, or
+// e.g. an internal update center and mirrors behind a firewall that blocks it
+var (
+	updateCenterURL     string
+	updateCenterChannel string
+	pluginMirrors       string // Comma-separated download sites, tried in order
+)
+
+// updateCenterChannels are the update centers of updates.jenkins.io -channel
+// picks from. Experimental also has the alpha and beta releases of plugins.
+var updateCenterChannels = map[string]string{
+	"stable":       "https://updates.jenkins.io/update-center.actual.json",
+	"experimental": "https://updates.jenkins.io/experimental/update-center.actual.json",
+}
+
+// updateCenterSource returns the update-center.json plugins are resolved
+// from: -update-center, or the one of -channel.
+func updateCenterSource() (string, error) {
+	channel, ok := updateCenterChannels[updateCenterChannel]
+	switch {
+	case !ok:
+		return "", usageError{fmt.Errorf("unknown -channel %q, use %s", updateCenterChannel, strings.Join(sortedKeys(updateCenterChannels), " or "))}
+	case updateCenterURL == "":
+		return channel, nil
+	case updateCenterChannel != "stable":
+		return "", usageError{errors.New("-channel cannot be combined with -update-center, which has its own channel")}
+	}
+	return updateCenterURL, nil
+}
+
+// pluginDownloadURLs returns where a plugin release can be downloaded, from
+// each of -plugin-mirrors in order, laid out like updates.jenkins.io/download.
+func pluginDownloadURLs(name, version string) []string {
+	var urls []string
+	for _, mirror := range strings.Split(pluginMirrors, ",") {
+		if mirror = strings.TrimSpace(mirror); mirror != "" {
+			urls = append(urls, fmt.Sprintf("%s/plugins/%s/%s/%s.hpi", strings.TrimSuffix(mirror, "/"), url.PathEscape(name), url.PathEscape(version), url.PathEscape(name)))
+		}
+	}
+	return urls
+}
+
+// updateCenter is the subset of update-center.json the wrapper uses.
+type updateCenter struct {
+	GenerationTimestamp string                   `json:"generationTimestamp"`
+	Plugins             map[string]ucPlugin      `json:"plugins"`
+	Deprecations        map[string]ucDeprecation `json:"deprecations"`
+}
+
+type ucPlugin struct {
+	Name         string         `json:"name"`
+	Version      string         `json:"version"`
+	URL          string         `json:"url"`
+	GAV          string         `json:"gav"` // groupId:artifactId:version
+	Sha256       string         `json:"sha256"`
+	Dependencies []ucDependency `json:"dependencies"`
+}
+
+type ucDependency struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Optional bool   `json:"optional"`
+}
+
+// cacheDir returns the per-user cache directory of the wrapper, creating it
+// (and any subdirectories) if needed.
+func cacheDir(sub ...string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(append([]string{base, "jenkins-wrapper"}, sub...)...)
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// fetchUpdateCenter returns the update center metadata, downloading it only
+// when it changed since the cached copy (using its ETag).
+func fetchUpdateCenter() (*updateCenter, error) {
+	dataPath, err := refreshUpdateCenter()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var uc updateCenter
+	if err := json.NewDecoder(f).Decode(&uc); err != nil {
+		return nil, fmt.Errorf("failed to parse update center metadata: %v", err)
+	}
+	if uc.GenerationTimestamp == "" {
+		return nil, errors.New("update center metadata has no generationTimestamp")
+	}
+	return &uc, nil
+}
+
+// refreshUpdateCenter brings the cached update-center.json up to date and
+// returns its path.
+func refreshUpdateCenter() (string, error) {
+	source, err := updateCenterSource()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(source)) // A copy per update center
+	dir, err := cacheDir("update-center", hex.EncodeToString(sum[:6]))
+	if err != nil {
+		return "", err
+	}
+	dataPath := filepath.Join(dir, "update-center.json")
+	etagPath := dataPath + ".etag"
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return "", err
+	}
+	if etag, err := os.ReadFile(etagPath); err == nil && fileExists(dataPath) {
+		req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+	case http.StatusOK:
+		if err := writeBody(resp, dataPath); err != nil {
+			return "", err
+		}
+		os.WriteFile(etagPath, []byte(resp.Header.Get("ETag")), 0o644)
+	default:
+		return "", newHTTPStatusError("failed to fetch update center", resp)
+	}
+	return dataPath, nil
+}
+
+// writeBody streams a response body to a file, subject to the size cap. The
+// file only replaces an existing one once it was downloaded completely.
+func writeBody(resp *http.Response, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, limitBody(resp)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", resp.Request.URL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
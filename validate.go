@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiTokenPattern matches Jenkins API tokens: 32 hex digits, prefixed with
+// the token version "11" since Jenkins 2.129.
+var apiTokenPattern = regexp.MustCompile(`^(11)?[0-9a-f]{32}$`)
+
+// pipelineCommands maps the commands that run pipeline steps to their
+// steps, nil for the configured pipeline.
+var pipelineCommands = map[string][]string{
+	"update":    nil,
+	"install":   {"install"},
+	"uninstall": {"uninstall"},
+	"restart":   restartPipeline,
+	"reload":    reloadPipeline,
+	"watch":     nil,
+	"tui":       nil,
+}
+
+// commandSettings lists the settings the other commands cannot do without.
+var commandSettings = map[string][]string{
+	"ensure-plugin": {"jenkinsUser", "jenkinsToken"},
+	"load-times":    {"jenkinsUser", "jenkinsToken"},
+	"promote":       {"env"},
+	"daemon":        {"schedule"},
+}
+
+// requiredSettings returns the settings the command needs: for pipeline
+// commands, those of the steps they run.
+func requiredSettings(command string) []string {
+	steps, ok := pipelineCommands[command]
+	if !ok {
+		return commandSettings[command]
+	}
+	if steps == nil {
+		steps, _ = configuredPipeline() // A bad -pipeline is reported on its own
+	}
+	var names []string
+	for _, step := range steps {
+		for _, name := range stepSettings[step] {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func settingValue(name string) string {
+	for _, s := range settings {
+		if s.flag == name {
+			return *s.value
+		}
+	}
+	return ""
+}
+
+// validation collects what config validate found.
+type validation struct {
+	problems, warnings int
+}
+
+func (v *validation) ok(format string, args ...any) {
+	notify("✅", format, args...)
+}
+
+func (v *validation) problem(format string, args ...any) {
+	v.problems++
+	notify("❌", format, args...)
+}
+
+func (v *validation) warn(format string, args ...any) {
+	v.warnings++
+	notify("⚠️", format, args...)
+}
+
+func (v *validation) checkURL() {
+	if jenkinsURL == "" {
+		v.warn("-jenkinsURL is not set, a local Jenkins will be discovered at run time")
+		return
+	}
+	u, err := url.Parse(jenkinsURL)
+	switch {
+	case err != nil:
+		v.problem("-jenkinsURL: %v", err)
+		return
+	case u.Scheme != "http" && u.Scheme != "https":
+		v.problem("-jenkinsURL %s: scheme must be http or https", jenkinsURL)
+		return
+	case u.Host == "":
+		v.problem("-jenkinsURL %s has no host", jenkinsURL)
+		return
+	case u.RawQuery != "" || u.Fragment != "":
+		v.problem("-jenkinsURL %s must not have a query or fragment", jenkinsURL)
+		return
+	}
+	v.ok("-jenkinsURL %s", jenkinsURL)
+
+	// Only open a connection: nothing is sent to Jenkins
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), 5*time.Second)
+	if err != nil {
+		v.problem("%s is not reachable: %v", u.Host, err)
+		return
+	}
+	conn.Close()
+	v.ok("%s is reachable", u.Host)
+}
+
+func (v *validation) checkToken() {
+	switch {
+	case jenkinsToken == "":
+		return
+	case apiTokenPattern.MatchString(jenkinsToken):
+		v.ok("-jenkinsToken looks like an API token")
+	default:
+		v.warn("-jenkinsToken does not look like an API token; passwords work but are slower and break with SSO, create a token under <jenkins>/me/configure")
+	}
+}
+
+func (v *validation) checkFile(name string) {
+	path := settingValue(name)
+	if path == "" {
+		return
+	}
+	if _, err := checkFile(path, "-"+name); err != nil {
+		v.problem("%v", err)
+		return
+	}
+	v.ok("-%s %s", name, path)
+}
+
+func (v *validation) checkDir(name string) {
+	path := settingValue(name)
+	if path == "" {
+		return
+	}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		v.warn("-%s %s does not exist yet and will be created", name, path)
+	case err != nil:
+		v.problem("-%s: %v", name, err)
+	case !info.IsDir():
+		v.problem("-%s %s is not a directory", name, path)
+	default:
+		v.ok("-%s %s", name, path)
+	}
+}
+
+// checkParent checks that the directory a file setting is written to exists.
+func (v *validation) checkParent(name string) {
+	path := settingValue(name)
+	if path == "" {
+		return
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		v.problem("-%s %s: directory %s does not exist", name, path, filepath.Dir(path))
+	}
+}
+
+// validateConfigCommand checks the configuration as loaded from flags, the
+// environment, .env and the YAML file without doing anything to Jenkins, so
+// a bad value is found before a run has uninstalled the plugin.
+func validateConfigCommand(args []string) error {
+	command := "update"
+	switch len(args) {
+	case 0:
+	case 1:
+		command = args[0]
+	default:
+		return usageError{fmt.Errorf("usage: config validate [command]")}
+	}
+
+	v := &validation{}
+	var missing []string
+	for _, name := range requiredSettings(command) {
+		if settingValue(name) == "" && !(name == "pluginPath" && pluginFetched()) {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		v.problem("%s needs %s", command, strings.Join(missing, ", "))
+	}
+
+	v.checkURL()
+	v.checkToken()
+	v.checkFile("jenkinsCLIPath")
+	v.checkFile("pluginPath")
+	if *remoteHost == "" {
+		// Otherwise these are paths on the Jenkins host
+		v.checkFile("jenkinsWarPath")
+		v.checkDir("jenkinsHome")
+	}
+	v.checkDir("backup-dir")
+	v.checkParent("jenkinsLogPath")
+	v.checkParent("promotion-ledger")
+	if pipelineSteps != "" {
+		if _, err := configuredPipeline(); err != nil {
+			v.problem("-pipeline: %v", err)
+		}
+	}
+	for _, d := range []string{"stabilize", "settle", "shutdown"} {
+		if _, err := sleepDuration(d); err != nil {
+			v.problem("%v", err)
+		}
+	}
+	if _, err := settingDuration("startup-wait", startupWait); err != nil {
+		v.problem("%v", err)
+	}
+
+	if v.problems > 0 {
+		return usageError{fmt.Errorf("%d problems in the configuration", v.problems)}
+	}
+	notify("🎉", "Configuration is valid for %s (%d warnings)", command, v.warnings)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersions orders Jenkins/plugin version strings such as "4.11.3",
+// "2.440.3" or "1.28-rc123.abcdef". Numeric parts compare numerically, other
+// parts lexically, and a release sorts after its qualified builds
+// ("1.2" > "1.2-beta-1"). It returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		switch {
+		case i >= len(pa):
+			return qualifierOrder(pb[i])
+		case i >= len(pb):
+			return -qualifierOrder(pa[i])
+		}
+		if c := comparePart(pa[i], pb[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+}
+
+// qualifierOrder is how a version with an extra trailing part compares to one
+// without it: "1.2.1" is newer than "1.2", "1.2-beta" is older.
+func qualifierOrder(extra string) int {
+	if _, err := strconv.Atoi(extra); err == nil {
+		return -1
+	}
+	return 1
+}
+
+func comparePart(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return 1 // Numbers sort after qualifiers
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
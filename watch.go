@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// newestMatch returns the most recently modified file matching the glob.
+func newestMatch(pattern string) (string, os.FileInfo, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	var newest string
+	var newestInfo os.FileInfo
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if newestInfo == nil || info.ModTime().After(newestInfo.ModTime()) {
+			newest, newestInfo = m, info
+		}
+	}
+	if newestInfo == nil {
+		return "", nil, fmt.Errorf("no file matches %s", pattern)
+	}
+	return newest, newestInfo, nil
+}
+
+// watchCommand redeploys the plugin whenever a new build of it appears:
+// -pluginPath may be a glob such as target/*.hpi, and the newest match is
+// deployed with the configured pipeline once it stopped changing.
+func watchCommand(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", 2*time.Second, "How often to look for a new build")
+	settle := fs.Duration("settle", 2*time.Second, "How long a new build must stay unchanged before it is deployed, so half-written files are skipped")
+	now := fs.Bool("now", false, "Deploy the current build right away instead of waiting for the next one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if pluginPath == "" {
+		return usageError{errors.New("watch needs -pluginPath, e.g. -pluginPath 'target/*.hpi'")}
+	}
+	pattern := pluginPath
+	deploy := pipelineCommand(nil)
+
+	var deployed string // Checksum of the build last deployed
+	if !*now {
+		if path, _, err := newestMatch(pattern); err == nil {
+			deployed, _ = fileSha256(path)
+		}
+	}
+	notify("👀", "Watching %s, Ctrl+C to stop", pattern)
+	for ; ; time.Sleep(*interval) {
+		path, info, err := newestMatch(pattern)
+		if err != nil {
+			continue // Between a clean and the next build
+		}
+		sum, err := fileSha256(path)
+		if err != nil || sum == deployed {
+			continue
+		}
+
+		time.Sleep(*settle)
+		if again, err := os.Stat(path); err != nil || again.Size() != info.Size() || !again.ModTime().Equal(info.ModTime()) {
+			continue // Still being written, look again next round
+		}
+		if sum, err = fileSha256(path); err != nil {
+			continue
+		}
+
+		notify("🔨", "New build %s (%s), deploying", path, info.ModTime().Format("15:04:05"))
+		// Each redeploy is a run of its own, with a report of its own
+		report = &runReport{Started: time.Now(), CorrelationID: newCorrelationID(), Wrapper: currentBuild(), attempt: 1}
+		if err := usePlugin(path); err != nil {
+			notify("⚠️", "Cannot deploy %s: %v", path, err)
+		} else if err := deploy(nil); err != nil {
+			printError(err)
+			notify("👀", "Watching for the next build")
+		}
+		// A failed build is not retried until it changes again
+		deployed = sum
+	}
+}
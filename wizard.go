@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// restartStrategies are the pipelines init offers, by the answer that picks them.
+var restartStrategies = map[string]string{
+	"restart": "", // defaultPipeline
+	"safe":    "backup,uninstall,sleep:stabilize,install,safeRestart,sleep:shutdown,wait,verify,monitors,durability",
+	"none":    "backup,install", // Nothing to verify until the next restart loads it
+}
+
+// initCommand asks for the basics interactively and writes them to the .env
+// file, so a first run does not need every flag spelled out.
+func initCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: init")
+	}
+	in := bufio.NewReader(os.Stdin)
+	values, err := loadEnv(*envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	fmt.Print(msg("initIntro", *envFile) + "\n\n")
+	for {
+		if jenkinsURL == "" {
+			// Suggest a local controller if there is one
+			discoverJenkinsURL()
+		}
+		if jenkinsURL, err = ask(in, msg("initURL"), jenkinsURL); err != nil {
+			return err
+		}
+		jenkinsURL = strings.TrimRight(jenkinsURL, "/")
+		if jenkinsUser, err = ask(in, msg("initUser"), jenkinsUser); err != nil {
+			return err
+		}
+		if jenkinsToken, err = askSecret(in, msg("initToken"), jenkinsToken); err != nil {
+			return err
+		}
+		// The steps that update plugins need both, whatever Jenkins allows
+		// anonymously
+		if jenkinsUser == "" || jenkinsToken == "" {
+			fmt.Print(msg("initNeedCredentials") + "\n\n")
+			continue
+		}
+		who, err := whoAmI()
+		if err == nil {
+			fmt.Print(msg("initAuthenticated", who) + "\n\n")
+			break
+		}
+		fmt.Print(msg("initLoginFailed", err) + "\n\n")
+	}
+
+	strategy := ""
+	for strategy == "" {
+		answer, err := ask(in, msg("initStrategy"), "restart")
+		if err != nil {
+			return err
+		}
+		if _, ok := restartStrategies[answer]; ok {
+			strategy = answer
+		}
+	}
+	if backupDir, err = ask(in, msg("initBackupDir"), backupDir); err != nil {
+		return err
+	}
+
+	values["JENKINS_URL"] = jenkinsURL
+	values["JENKINS_USER"] = jenkinsUser
+	values["JENKINS_TOKEN"] = jenkinsToken
+	setOrDelete(values, "PIPELINE_STEPS", restartStrategies[strategy])
+	setOrDelete(values, "BACKUP_DIR", backupDir)
+	if err := saveEnv(*envFile, values); err != nil {
+		return err
+	}
+	notify("✅", "Saved %s, run with -pluginName and -pluginPath to update a plugin", *envFile)
+	return nil
+}
+
+func setOrDelete(values map[string]string, key, value string) {
+	if value == "" {
+		delete(values, key)
+	} else {
+		values[key] = value
+	}
+}
+
+// whoAmI checks the credentials, since Jenkins answers anonymously rather
+// than failing when they are wrong on some security realms.
+func whoAmI() (string, error) {
+	var who struct {
+		Name          string `json:"name"`
+		Anonymous     bool   `json:"anonymous"`
+		Authenticated bool   `json:"authenticated"`
+	}
+	if err := getJSON("/whoAmI/api/json", &who); err != nil {
+		return "", err
+	}
+	if who.Anonymous || !who.Authenticated {
+		return "", errors.New("jenkins treats these credentials as anonymous")
+	}
+	return who.Name, nil
+}
+
+// ask prompts for a value, keeping current on an empty answer. It fails
+// when the input ends, e.g. with Ctrl+D or a closed pipe, so no prompt
+// loops on it.
+func ask(in *bufio.Reader, question, current string) (string, error) {
+	if current != "" {
+		fmt.Printf("%s [%s]: ", question, current)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	return readAnswer(in, current)
+}
+
+func readAnswer(in *bufio.Reader, current string) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		return "", errors.New(msg("initInputEnded"))
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return current, nil
+	}
+	return line, nil
+}
+
+// askSecret is ask without echoing the answer, where the terminal allows it.
+func askSecret(in *bufio.Reader, question, current string) (string, error) {
+	if interactive() && runtime.GOOS != "windows" && checkLaunch("stty") == nil {
+		stty := func(arg string) {
+			cmd := exec.Command("stty", arg)
+			cmd.Stdin = os.Stdin
+			cmd.Run()
+		}
+		stty("-echo")
+		defer func() {
+			stty("echo")
+			fmt.Println()
+		}()
+	}
+	if current != "" {
+		fmt.Printf("%s [%s]: ", question, msg("initKeep"))
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	return readAnswer(in, current)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+var (
+	interruptMu    sync.Mutex
+	interruptHooks []func()
+)
+
+// onInterrupt registers f to run when the run is interrupted, for state a
+// deferred call would otherwise restore, like the terminal mode. Hooks run
+// newest first and must be safe to run after their defer already has.
+func onInterrupt(f func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	interruptHooks = append(interruptHooks, f)
+}
+
+// Subdirectories created inside every run workspace.
+const (
+	downloadsDir = "downloads"
+	manifestsDir = "manifests"
+)
+
+// workspace is a scratch directory owned by a single run. Every run gets a
+// uniquely named one so concurrent runs on a shared CI agent never see each
+// other's downloads or extracted manifests. Backups live on the Jenkins
+// host and support bundles outlive the run, so neither is kept here.
+type workspace struct {
+	root string
+}
+
+var ws *workspace
+
+func newWorkspace() (*workspace, error) {
+	root, err := os.MkdirTemp("", "jenkins-wrapper-run-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run workspace: %v", err)
+	}
+	for _, dir := range []string{downloadsDir, manifestsDir} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o700); err != nil {
+			os.RemoveAll(root)
+			return nil, fmt.Errorf("failed to create run workspace: %v", err)
+		}
+	}
+	return &workspace{root: root}, nil
+}
+
+// path returns the location of name inside one of the workspace subdirectories.
+func (w *workspace) path(dir, name string) string {
+	return filepath.Join(w.root, dir, name)
+}
+
+func (w *workspace) cleanup() {
+	if err := os.RemoveAll(w.root); err != nil {
+		notify("⚠️", "Failed to remove workspace %s: %v", w.root, err)
+	}
+}
+
+// cleanupOnSignal removes the workspace when the run is interrupted, since
+// deferred calls in main do not run in that case.
+func (w *workspace) cleanupOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		interruptMu.Lock()
+		for i := len(interruptHooks) - 1; i >= 0; i-- {
+			interruptHooks[i]()
+		}
+		interruptMu.Unlock()
+		notify("🛑", "Received %v, cleaning up...", sig)
+		w.cleanup()
+		os.Exit(exitInterrupted)
+	}()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadYAML reads the subset of YAML the configuration file uses: nested
+// mappings of scalars, with comments and quoted strings. Keys are returned
+// as dotted paths, e.g. "server.url".
+func loadYAML(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type level struct {
+		indent int
+		prefix string
+	}
+	values := map[string]string{}
+	stack := []level{{indent: -1}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		raw := scanner.Text()
+		line := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.HasPrefix(line[indent:], "\t") {
+			return nil, fmt.Errorf("%s:%d: tabs are not allowed for indentation", path, n)
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			return nil, fmt.Errorf("%s:%d: lists are not supported", path, n)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || key == "" || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		full := stack[len(stack)-1].prefix + strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			stack = append(stack, level{indent, full + "."})
+			continue
+		}
+		if values[full], err = yamlScalar(value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func yamlScalar(value string) (string, error) {
+	switch value[0] {
+	case '"':
+		return strconv.Unquote(value)
+	case '\'':
+		if len(value) < 2 || value[len(value)-1] != '\'' {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case '[', '{', '|', '>', '&', '*', '!':
+		return "", fmt.Errorf("unsupported value %s", value)
+	}
+	return value, nil
+}